@@ -0,0 +1,188 @@
+// Package admin serves the control API of the miner in a Unix socket, HTTP with JSON
+// bodies, and is its client.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+// Controller is what the API controls, the miner.
+type Controller interface {
+	// Status returns the state of the session.
+	Status() Status
+	// Pause stops the search of the POW until Resume.
+	Pause() error
+	// Resume continues the search stopped by Pause.
+	Resume() error
+	// SetWorkers changes the number of workers.
+	SetWorkers(n int) error
+	// Cancel ends the session and the miner.
+	Cancel() error
+	// DumpState returns everything known about the miner, encoded as JSON.
+	DumpState() interface{}
+}
+
+// Status is the state of the session.
+type Status struct {
+	Session        string  `json:"session"`
+	Endpoint       string  `json:"endpoint"`
+	State          string  `json:"state"`
+	Command        string  `json:"command"`
+	Authdata       string  `json:"authdata,omitempty"`
+	Difficulty     int     `json:"difficulty,omitempty"`
+	Paused         bool    `json:"paused"`
+	Workers        int     `json:"workers"`
+	Hashes         uint64  `json:"hashes"`
+	Hashrate       float64 `json:"hashrate"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// Workers is the body of set-workers.
+type Workers struct {
+	Workers int `json:"workers"`
+}
+
+// errorBody is the body of the responses that failed.
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// ErrSocketInUse is returned by Listen when another process serves in the socket.
+var ErrSocketInUse = errors.New("admin socket in use")
+
+// ErrNotSocket is returned by Listen when the path is a file that is not a socket, it is
+// never removed.
+var ErrNotSocket = errors.New("admin socket path is not a socket")
+
+// Handler returns the API of the controller:
+//
+//	GET  /status       the Status
+//	POST /pause        pause the search
+//	POST /resume       resume the search
+//	POST /set-workers  change the number of workers to the Workers of the body
+//	POST /cancel       end the miner
+//	GET  /dump-state   the whole state of the miner
+func Handler(c Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, c.Status())
+	}))
+	mux.HandleFunc("/dump-state", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, c.DumpState())
+	}))
+	mux.HandleFunc("/pause", only(http.MethodPost, control("pause", c.Pause, c)))
+	mux.HandleFunc("/resume", only(http.MethodPost, control("resume", c.Resume, c)))
+	mux.HandleFunc("/cancel", only(http.MethodPost, control("cancel", c.Cancel, c)))
+	mux.HandleFunc("/set-workers", only(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		var body Workers
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			reply(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("invalid body: %v", err)})
+			return
+		}
+		if body.Workers < 1 {
+			reply(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("workers must be at least 1, got %d", body.Workers)})
+			return
+		}
+		control("set-workers", func() error { return c.SetWorkers(body.Workers) }, c)(w, r)
+	}))
+	return mux
+}
+
+// control runs the action and replies with the status after it, or with its error.
+func control(name string, action func() error, c Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := action(); err != nil {
+			logger.Warn("control failed", "control", name, logging.KeyError, err)
+			reply(w, http.StatusConflict, errorBody{Error: err.Error()})
+			return
+		}
+		logger.Info("control applied", "control", name)
+		reply(w, http.StatusOK, c.Status())
+	}
+}
+
+// only rejects the requests with another method.
+func only(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			reply(w, http.StatusMethodNotAllowed, errorBody{Error: fmt.Sprintf("use %s", method)})
+			return
+		}
+		h(w, r)
+	}
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Warn("failed to write the reply", logging.KeyError, err)
+	}
+}
+
+// Listen serves the API of the controller in the Unix socket at path, only accessible by
+// the user. A socket left by a process that exited is replaced, any other file fails. Closing the listener stops
+// serving and removes the socket.
+func Listen(path string, c Controller) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNotSocket, path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %s", ErrSocketInUse, path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The socket is created in a directory only the user can enter and moved to the path
+	// once only the user can connect to it, the umask could let others connect before.
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".admin")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	l := &socketListener{Listener: listener, path: path}
+	go http.Serve(l, Handler(c))
+	return l, nil
+}
+
+// socketListener removes the socket, which was moved after it was created, when it is closed.
+type socketListener struct {
+	net.Listener
+	path string
+	once sync.Once
+}
+
+func (l *socketListener) Close() error {
+	err := l.Listener.Close()
+	l.once.Do(func() { os.Remove(l.path) })
+	return err
+}
@@ -0,0 +1,203 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeController records the controls applied.
+type fakeController struct {
+	mu       sync.Mutex
+	status   Status
+	canceled bool
+	err      error
+}
+
+func (c *fakeController) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+func (c *fakeController) Pause() error {
+	return c.apply(func() { c.status.Paused = true })
+}
+
+func (c *fakeController) Resume() error {
+	return c.apply(func() { c.status.Paused = false })
+}
+
+func (c *fakeController) SetWorkers(n int) error {
+	return c.apply(func() { c.status.Workers = n })
+}
+
+func (c *fakeController) Cancel() error {
+	return c.apply(func() { c.canceled = true })
+}
+
+func (c *fakeController) DumpState() interface{} {
+	return map[string]interface{}{"status": c.Status(), "goroutines": 3}
+}
+
+func (c *fakeController) apply(change func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	change()
+	return nil
+}
+
+// socketPath returns a path for a socket, short enough for the limit of the Unix sockets.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "miner.sock")
+}
+
+// serve serves the controller in a new socket and returns its path.
+func serve(t *testing.T, c Controller) string {
+	t.Helper()
+	path := socketPath(t)
+	listener, err := Listen(path, c)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return path
+}
+
+func TestClient(t *testing.T) {
+	c := &fakeController{status: Status{State: "pow", Workers: 4}}
+	client := NewClient(serve(t, c))
+
+	status, err := client.Status()
+	if err != nil || status.State != "pow" || status.Workers != 4 {
+		t.Fatalf("Status() = %+v, %v; want the status of the controller", status, err)
+	}
+	if status, err = client.Pause(); err != nil || !status.Paused {
+		t.Errorf("Pause() = %+v, %v; want paused", status, err)
+	}
+	if status, err = client.Resume(); err != nil || status.Paused {
+		t.Errorf("Resume() = %+v, %v; want resumed", status, err)
+	}
+	if status, err = client.SetWorkers(8); err != nil || status.Workers != 8 {
+		t.Errorf("SetWorkers(8) = %+v, %v; want 8 workers", status, err)
+	}
+	if _, err = client.Cancel(); err != nil || !c.canceled {
+		t.Errorf("Cancel() error = %v, canceled = %t; want canceled", err, c.canceled)
+	}
+	state, err := client.DumpState()
+	if err != nil || !strings.Contains(string(state), `"goroutines":3`) {
+		t.Errorf("DumpState() = %s, %v; want the state of the controller", state, err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	c := &fakeController{err: errors.New("the POW is searched by the remote hash workers")}
+	client := NewClient(serve(t, c))
+
+	if _, err := client.Pause(); err == nil || !strings.Contains(err.Error(), "remote hash workers") {
+		t.Errorf("Pause() error = %v, want the error of the controller", err)
+	}
+	if _, err := client.SetWorkers(0); err == nil || !strings.Contains(err.Error(), "at least 1") {
+		t.Errorf("SetWorkers(0) error = %v, want an invalid number of workers", err)
+	}
+	if err := client.call("GET", "/pause", nil, nil); err == nil || !strings.Contains(err.Error(), "use POST") {
+		t.Errorf("GET /pause error = %v, want the method rejected", err)
+	}
+	if _, err := NewClient(socketPath(t)).Status(); err == nil {
+		t.Errorf("Status() of a missing socket error = nil")
+	}
+}
+
+func TestListen_Socket(t *testing.T) {
+	path := serve(t, &fakeController{})
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, %v; want 0600", info.Mode(), err)
+	}
+	if files, err := ioutil.ReadDir(filepath.Dir(path)); err != nil || len(files) != 1 {
+		t.Errorf("directory of the socket has %d files, %v; want only the socket", len(files), err)
+	}
+	if _, err := Listen(path, &fakeController{}); !errors.Is(err, ErrSocketInUse) {
+		t.Errorf("Listen() of a socket in use error = %v, want %v", err, ErrSocketInUse)
+	}
+
+	// A socket left by a process that exited is replaced.
+	stale := socketPath(t)
+	listener, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	listener, err = Listen(stale, &fakeController{})
+	if err != nil {
+		t.Fatalf("Listen() of a stale socket error = %v", err)
+	}
+	listener.Close()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("socket not removed on Close: %v", err)
+	}
+
+	// Any other file is kept.
+	file := socketPath(t)
+	if err := ioutil.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(file, &fakeController{}); !errors.Is(err, ErrNotSocket) {
+		t.Errorf("Listen() of a regular file error = %v, want %v", err, ErrNotSocket)
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != "data" {
+		t.Errorf("regular file = %q, %v; want it untouched", b, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	path := serve(t, &fakeController{status: Status{State: "handshake", Workers: 2}})
+
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{args: []string{"-socket", path, "status"}, want: `"state": "handshake"`},
+		{args: []string{"-socket", path, "set-workers", "6"}, want: `"workers": 6`},
+		{args: []string{"-socket", path, "dump-state"}, want: `"goroutines": 3`},
+		{args: []string{"-socket", path, "set-workers"}, wantErr: "needs the number of workers"},
+		{args: []string{"-socket", path, "set-workers", "many"}, wantErr: "invalid number of workers"},
+		{args: []string{"-socket", path, "restart"}, wantErr: "unknown minerctl command"},
+		{args: nil, wantErr: "usage: minerctl"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var out bytes.Buffer
+			err := Run(tt.args, &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) || !json.Valid(out.Bytes()) {
+				t.Errorf("Run() printed %s, want JSON with %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout is how long the client waits for a reply of the miner.
+const DefaultTimeout = time.Second * 10
+
+// Client calls the API served in a Unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client of the API served in the Unix socket at path.
+func NewClient(path string) *Client {
+	return &Client{http: &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}}
+}
+
+// Status returns the state of the session.
+func (c *Client) Status() (Status, error) {
+	var status Status
+	err := c.call(http.MethodGet, "/status", nil, &status)
+	return status, err
+}
+
+// Pause stops the search of the POW until Resume, and returns the status after it.
+func (c *Client) Pause() (Status, error) {
+	var status Status
+	err := c.call(http.MethodPost, "/pause", nil, &status)
+	return status, err
+}
+
+// Resume continues the search stopped by Pause, and returns the status after it.
+func (c *Client) Resume() (Status, error) {
+	var status Status
+	err := c.call(http.MethodPost, "/resume", nil, &status)
+	return status, err
+}
+
+// SetWorkers changes the number of workers, and returns the status after it.
+func (c *Client) SetWorkers(n int) (Status, error) {
+	var status Status
+	err := c.call(http.MethodPost, "/set-workers", Workers{Workers: n}, &status)
+	return status, err
+}
+
+// Cancel ends the session and the miner, and returns the status after it.
+func (c *Client) Cancel() (Status, error) {
+	var status Status
+	err := c.call(http.MethodPost, "/cancel", nil, &status)
+	return status, err
+}
+
+// DumpState returns the whole state of the miner.
+func (c *Client) DumpState() (json.RawMessage, error) {
+	var state json.RawMessage
+	err := c.call(http.MethodGet, "/dump-state", nil, &state)
+	return state, err
+}
+
+// call sends the request with the body encoded as JSON and decodes the reply into out.
+func (c *Client) call(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	// The host is ignored, the transport always dials the socket.
+	req, err := http.NewRequest(method, "http://miner"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorBody
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
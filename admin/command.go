@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultSocket is the path of the socket of the API when none is given.
+const DefaultSocket = "./miner.sock"
+
+const usage = `usage: minerctl [-socket path] <command>
+
+commands:
+  status          print the state of the session
+  pause           stop the workers until resume
+  resume          start the workers stopped by pause
+  set-workers N   change the number of workers
+  cancel          end the session and the miner
+  dump-state      print the whole state of the miner`
+
+// Run executes the minerctl command with its arguments, the replies of the miner are
+// printed as JSON.
+func Run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("minerctl", flag.ContinueOnError)
+	socket := flags.String("socket", DefaultSocket, "Unix socket of the admin API of the miner, its -admin flag")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New(usage)
+	}
+	c := NewClient(*socket)
+
+	var reply interface{}
+	var err error
+	switch command := flags.Arg(0); command {
+	case "status":
+		reply, err = c.Status()
+	case "pause":
+		reply, err = c.Pause()
+	case "resume":
+		reply, err = c.Resume()
+	case "cancel":
+		reply, err = c.Cancel()
+	case "dump-state":
+		reply, err = c.DumpState()
+	case "set-workers":
+		if flags.NArg() != 2 {
+			return fmt.Errorf("set-workers needs the number of workers\n%s", usage)
+		}
+		n, convErr := strconv.Atoi(flags.Arg(1))
+		if convErr != nil {
+			return fmt.Errorf("invalid number of workers %q: %w", flags.Arg(1), convErr)
+		}
+		reply, err = c.SetWorkers(n)
+	default:
+		return fmt.Errorf("unknown minerctl command %q\n%s", command, usage)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(reply, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", b)
+	return err
+}
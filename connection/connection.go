@@ -1,11 +1,15 @@
 package connection
 
 import (
+	"context"
 	"crypto/sha1"
 	"crypto/tls"
 	"encoding/hex"
-	"fmt"
-	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
 )
 
 // TODO: Test connection.
@@ -15,36 +19,75 @@ type Connection struct {
 	conn     *tls.Conn
 	conf     *tls.Config
 	endpoint string
+	failover *Failover
+	reloader *Reloader
+	// reloadInterval is how often the reloader checks the files while connected, 0 never.
+	reloadInterval time.Duration
+	reader         *LineReader
+
+	mu        sync.Mutex
+	deadlines DeadlinePolicy
+	// answerBy is when the answer to the last command read must be written.
+	answerBy time.Time
 }
 
 // Dial will connect using with the server endpoint using the cert and key provided.
+// The certificate of the server is verified with the system roots.
 func Dial(certFile, keyFile, endpoint string) (*Connection, error) {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	return DialEndpoints(Credentials{CertFile: certFile, KeyFile: keyFile}, []string{endpoint}, Verification{})
+}
+
+// DialEndpoints will connect to the first of the server endpoints that accepts the connection
+// using the credentials provided, and verifies the server as configured. Reconnecte tries
+// first the endpoint that worked the last time. The credentials are loaded again when their
+// files change, the new certificate is used from the next handshake.
+func DialEndpoints(credentials Credentials, endpoints []string, verification Verification, opts ...FailoverOption) (*Connection, error) {
+	reloader, err := NewReloader(credentials)
 	if err != nil {
-		fmt.Printf("load cert failed: %s", err.Error())
+		logger.Error("failed to load the client certificate", logging.KeyError, err)
 		return nil, err
 	}
 
-	tlsConf := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		// TODO: Investigate Error: 2021/07/27 18:24:27 failed to connect: x509: cannot validate certificate for 18.202.148.130 because it doesn't contain any IP SANs
-		// Posible problem with using the IP.
-		InsecureSkipVerify: true,
+	tlsConf, err := verification.TLSConfig(nil)
+	if err != nil {
+		logger.Error("failed to configure the verification of the server", logging.KeyError, err)
+		return nil, err
 	}
-	conn, err := tls.Dial("tcp", endpoint, tlsConf)
+	tlsConf.GetClientCertificate = reloader.GetClientCertificate
+	failover := NewFailover(endpoints, tlsConf, opts...)
+	conn, endpoint, err := failover.Dial(context.Background())
 	if err != nil {
-		fmt.Printf("failed to connect: %s", err.Error())
+		logger.Error("failed to connect", logging.KeyError, err)
 		return nil, err
 	}
+	if credentials.ReloadInterval > 0 {
+		reloader.Watch(credentials.ReloadInterval)
+	}
 	return &Connection{
-		conn:     conn,
-		conf:     tlsConf,
-		endpoint: endpoint,
+		conn:           conn,
+		conf:           tlsConf,
+		endpoint:       endpoint,
+		failover:       failover,
+		reloader:       reloader,
+		reloadInterval: credentials.ReloadInterval,
+		reader:         NewLineReader(conn, DefaultMaxLineSize),
+		deadlines:      DefaultDeadlinePolicy(),
 	}, nil
 }
 
-// Close the connection
+// Certificate returns the client certificate used in the next handshake.
+func (c *Connection) Certificate() *tls.Certificate {
+	return c.reloader.Certificate()
+}
+
+// Endpoint returns the endpoint of the server the connection is connected to.
+func (c *Connection) Endpoint() string {
+	return c.endpoint
+}
+
+// Close the connection and stop watching the files of the credentials until Reconnecte.
 func (c *Connection) Close() error {
+	c.reloader.Stop()
 	return c.conn.Close()
 }
 
@@ -58,10 +101,63 @@ func (c *Connection) Write(b []byte) (int, error) {
 	return c.conn.Write(b)
 }
 
+// SetDeadlinePolicy sets the budgets of the commands, DefaultDeadlinePolicy by default.
+func (c *Connection) SetDeadlinePolicy(policy DeadlinePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadlines = policy
+}
+
+// ReadLine reads the next line of the protocol without the newline. Lines longer than
+// DefaultMaxLineSize or that are not valid UTF-8 fail with ErrLineTooLong or ErrInvalidUTF8.
+// The line must arrive at most the default budget after the answer to the previous one is
+// due, and the budget of its command starts for the answer.
+func (c *Connection) ReadLine() (string, error) {
+	c.mu.Lock()
+	readBy := c.answerBy
+	if now := time.Now(); readBy.Before(now) {
+		readBy = now
+	}
+	c.conn.SetReadDeadline(readBy.Add(c.deadlines.Default))
+	c.mu.Unlock()
+
+	line, err := c.reader.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.answerBy = time.Now().Add(c.deadlines.Budget(line))
+	c.mu.Unlock()
+	return line, nil
+}
+
+// WriteLine writes the line and a new line at the end before the answer to the last command
+// is due. A line that is too long, is not valid UTF-8 or has a newline is not written and
+// fails with the error of the framing.
+func (c *Connection) WriteLine(line string) error {
+	if err := checkLine(line, DefaultMaxLineSize); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	writeBy := c.answerBy
+	if writeBy.IsZero() {
+		writeBy = time.Now().Add(c.deadlines.Default)
+	}
+	c.conn.SetWriteDeadline(writeBy)
+	c.mu.Unlock()
+
+	_, err := c.Write([]byte(line + "\n"))
+	return err
+}
+
 // WriteString writes a string to the connection and append a new line at the end.
+// It is checked like in WriteLine.
 func (c *Connection) WriteString(b string) (int, error) {
-	log.Println(b)
-	return c.Write([]byte(b + "\n"))
+	logger.Debug("sent", "line", b)
+	if err := c.WriteLine(b); err != nil {
+		return 0, err
+	}
+	return len(b) + 1, nil
 }
 
 // WriteSHA1String writes a two string seperated by a space where
@@ -71,33 +167,51 @@ func (c *Connection) WriteSHA1String(authdata, shaArg, stringArg string) (int, e
 	return c.WriteString(hex.EncodeToString(hash[:]) + " " + stringArg)
 }
 
-// Reconnecte will reconnect to the server.
+// Reconnecte will close the connection and reconnect to the server.
 func (c *Connection) Reconnecte() error {
-	conn, err := tls.Dial("tcp", c.endpoint, c.conf)
+	c.conn.Close()
+	conn, endpoint, err := c.failover.Dial(context.Background())
 	if err != nil {
-		fmt.Printf("failed to reconnect: %s", err.Error())
+		logger.Error("failed to reconnect", logging.KeyError, err)
 		return err
 	}
 	c.conn = conn
+	c.endpoint = endpoint
+	c.reader = NewLineReader(conn, DefaultMaxLineSize)
+	if c.reloadInterval > 0 {
+		c.reloader.Watch(c.reloadInterval)
+	}
+	c.mu.Lock()
+	c.answerBy = time.Time{}
+	c.mu.Unlock()
 	return nil
 }
 
+// Diagnose returns the report of the TLS connection: the negotiated parameters, the chain
+// of the server and how long the dial took.
+func (c *Connection) Diagnose() *Report {
+	state := c.conn.ConnectionState()
+	if state.ServerName == "" {
+		// IP addresses are not sent in the SNI, the name verified is the configured one or the host.
+		state.ServerName = c.conf.ServerName
+		if host, _, err := net.SplitHostPort(c.endpoint); err == nil && state.ServerName == "" {
+			state.ServerName = host
+		}
+	}
+	return NewReport(c.endpoint, state, c.failover.Timings())
+}
+
 // PrintConnState will print the TLS connection state.
 func (c *Connection) PrintConnState() {
-	log.Print(">>>>>>>>>>>>>>>> State <<<<<<<<<<<<<<<<")
-	state := c.conn.ConnectionState()
-	log.Printf("Version: %x", state.Version)
-	log.Printf("HandshakeComplete: %t", state.HandshakeComplete)
-	log.Printf("DidResume: %t", state.DidResume)
-	log.Printf("CipherSuite: %x", state.CipherSuite)
-	log.Printf("NegotiatedProtocol: %s", state.NegotiatedProtocol)
-
-	log.Print("Certificate chain:")
-	for i, cert := range state.PeerCertificates {
-		subject := cert.Subject
-		issuer := cert.Issuer
-		log.Printf(" %d s:/C=%v/ST=%v/L=%v/O=%v/OU=%v/CN=%s", i, subject.Country, subject.Province, subject.Locality, subject.Organization, subject.OrganizationalUnit, subject.CommonName)
-		log.Printf("   i:/C=%v/ST=%v/L=%v/O=%v/OU=%v/CN=%s", issuer.Country, issuer.Province, issuer.Locality, issuer.Organization, issuer.OrganizationalUnit, issuer.CommonName)
+	r := c.Diagnose()
+	keyvals := []interface{}{logging.KeyEndpoint, r.Endpoint, "server_name", r.ServerName, "version", r.Version,
+		"cipher_suite", r.CipherSuite, "resumed", r.DidResume}
+	if len(r.Chain) > 0 {
+		keyvals = append(keyvals, "server_key", r.Chain[0].Pin)
+	}
+	logger.Info("TLS connection state", keyvals...)
+	for i, cert := range r.Chain {
+		logger.Debug("certificate of the server", "depth", i, "subject", cert.Subject, "issuer", cert.Issuer,
+			"not_after", cert.NotAfter.Format(time.RFC3339), "sha256", cert.SHA256)
 	}
-	log.Print(">>>>>>>>>>>>>>>> State End <<<<<<<<<<<<<<<<")
 }
@@ -0,0 +1,303 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+)
+
+var (
+	// ErrExpired is returned when the certificate is expired or not valid yet.
+	ErrExpired = errors.New("certificate is not valid now")
+	// ErrKeyMismatch is returned when the private key is not the key of the certificate.
+	ErrKeyMismatch = errors.New("private key does not match the certificate")
+)
+
+// expiryWarning is how long before the expiration of the certificate a warning is logged.
+const expiryWarning = time.Hour * 24 * 30
+
+// Credentials is where the client certificate and key are loaded from: a PKCS#12 bundle,
+// the PEM embedded in the configuration or the PEM files, in this order.
+type Credentials struct {
+	CertFile   string
+	KeyFile    string
+	PKCS12File string
+	CertPEM    string
+	KeyPEM     string
+	// Passphrase returns the passphrase of encrypted keys and PKCS#12 bundles.
+	Passphrase func() ([]byte, error)
+	// ReloadInterval is how often the files are checked for a rotated pair during a
+	// connection, 0 only checks them before each handshake.
+	ReloadInterval time.Duration
+}
+
+// Load returns the certificate and key after checking that they match and that the
+// certificate is valid now. Its errors are permanent.
+func (c Credentials) Load() (tls.Certificate, error) {
+	cert, source, err := c.load()
+	if err != nil {
+		return tls.Certificate{}, retry.Permanent(fmt.Errorf("load cert failed: %w", err))
+	}
+	if err := checkValidity(cert.Leaf, time.Now()); err != nil {
+		return tls.Certificate{}, retry.Permanent(fmt.Errorf("load cert failed: %s: %w", source, err))
+	}
+	return cert, nil
+}
+
+// load returns the certificate and a description of where it was loaded from.
+func (c Credentials) load() (tls.Certificate, string, error) {
+	switch {
+	case c.PKCS12File != "":
+		data, err := ioutil.ReadFile(c.PKCS12File)
+		if err != nil {
+			return tls.Certificate{}, c.PKCS12File, err
+		}
+		passphrase, err := c.passphrase()
+		if err != nil {
+			return tls.Certificate{}, c.PKCS12File, err
+		}
+		certs, key, err := parsePKCS12(data, passphrase)
+		if err != nil {
+			return tls.Certificate{}, c.PKCS12File, fmt.Errorf("%s: %w", c.PKCS12File, err)
+		}
+		cert, err := keyPair(certs, key)
+		if err != nil {
+			return tls.Certificate{}, c.PKCS12File, fmt.Errorf("%s: %w", c.PKCS12File, err)
+		}
+		return cert, c.PKCS12File, nil
+	case c.CertPEM != "" || c.KeyPEM != "":
+		cert, err := c.pemKeyPair([]byte(c.CertPEM), []byte(c.KeyPEM))
+		if err != nil {
+			return tls.Certificate{}, "embedded certificate", fmt.Errorf("embedded certificate: %w", err)
+		}
+		return cert, "embedded certificate", nil
+	default:
+		certPEM, err := ioutil.ReadFile(c.CertFile)
+		if err != nil {
+			return tls.Certificate{}, c.CertFile, err
+		}
+		keyPEM, err := ioutil.ReadFile(c.KeyFile)
+		if err != nil {
+			return tls.Certificate{}, c.CertFile, err
+		}
+		cert, err := c.pemKeyPair(certPEM, keyPEM)
+		if err != nil {
+			return tls.Certificate{}, c.CertFile, fmt.Errorf("%s and %s: %w", c.CertFile, c.KeyFile, err)
+		}
+		return cert, c.CertFile, nil
+	}
+}
+
+// ErrNoPassphrase is returned for an encrypted key when the credentials have no passphrase.
+var ErrNoPassphrase = errors.New("the private key is encrypted and no passphrase was given")
+
+func (c Credentials) passphrase() ([]byte, error) {
+	if c.Passphrase == nil {
+		return nil, nil
+	}
+	return c.Passphrase()
+}
+
+// pemKeyPair parses the PEM certificates and key, which can be encrypted.
+func (c Credentials) pemKeyPair(certPEM, keyPEM []byte) (tls.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return tls.Certificate{}, errors.New("no certificate found")
+	}
+
+	var block *pem.Block
+	for rest := keyPEM; ; {
+		block, rest = pem.Decode(rest)
+		if block == nil || strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			break
+		}
+	}
+	if block == nil {
+		return tls.Certificate{}, errors.New("no private key found")
+	}
+	der := block.Bytes
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if c.Passphrase == nil {
+			return tls.Certificate{}, ErrNoPassphrase
+		}
+		passphrase, err := c.passphrase()
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		if der, err = decryptPKCS8(der, passphrase); err != nil {
+			return tls.Certificate{}, err
+		}
+	case x509.IsEncryptedPEMBlock(block):
+		if c.Passphrase == nil {
+			return tls.Certificate{}, ErrNoPassphrase
+		}
+		passphrase, err := c.passphrase()
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+			return tls.Certificate{}, ErrPassphrase
+		}
+	}
+	key, err := parsePrivateKey(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return keyPair(certs, key)
+}
+
+// parsePrivateKey parses a PKCS#8, PKCS#1 or EC key.
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key")
+}
+
+// keyPair returns the certificate of the key, followed by the rest of the chain.
+func keyPair(certs []*x509.Certificate, key crypto.PrivateKey) (tls.Certificate, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, errors.New("unsupported private key")
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return tls.Certificate{}, errors.New("unsupported private key")
+	}
+
+	leaf := -1
+	for i, cert := range certs {
+		if public.Equal(cert.PublicKey) {
+			leaf = i
+			break
+		}
+	}
+	if leaf < 0 {
+		return tls.Certificate{}, fmt.Errorf("%w %q", ErrKeyMismatch, certs[0].Subject.CommonName)
+	}
+
+	cert := tls.Certificate{PrivateKey: key, Leaf: certs[leaf]}
+	cert.Certificate = append(cert.Certificate, certs[leaf].Raw)
+	for i, c := range certs {
+		if i != leaf {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+	}
+	return cert, nil
+}
+
+// checkValidity fails if the certificate is not valid at the time, and warns if it expires soon.
+func checkValidity(cert *x509.Certificate, now time.Time) error {
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("%w: %q is valid from %s", ErrExpired, cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: %q expired on %s", ErrExpired, cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+	}
+	if left := cert.NotAfter.Sub(now); left < expiryWarning {
+		logger.Warn("certificate expires soon", "subject", cert.Subject.CommonName, "left", left.Round(time.Hour))
+	}
+	return nil
+}
+
+// PassphraseFrom returns a function that reads the passphrase once from the source:
+// "prompt" asks in the terminal, "env:NAME" reads the environment variable and "fd:N"
+// reads the file descriptor until its end. An empty source has no passphrase.
+func PassphraseFrom(source string) (func() ([]byte, error), error) {
+	var read func() ([]byte, error)
+	switch {
+	case source == "":
+		return nil, nil
+	case source == "prompt":
+		read = prompt
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		read = func() ([]byte, error) {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return nil, fmt.Errorf("passphrase variable %s is not set", name)
+			}
+			return []byte(value), nil
+		}
+	case strings.HasPrefix(source, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(source, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid passphrase file descriptor %q", source)
+		}
+		read = func() ([]byte, error) {
+			file := os.NewFile(uintptr(fd), "passphrase")
+			defer file.Close()
+			data, err := ioutil.ReadAll(file)
+			if err != nil {
+				return nil, fmt.Errorf("read passphrase: %w", err)
+			}
+			return bytes.TrimRight(data, "\r\n"), nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid passphrase source %q, use prompt, env:NAME or fd:N", source)
+	}
+
+	var once sync.Once
+	var passphrase []byte
+	var err error
+	return func() ([]byte, error) {
+		once.Do(func() { passphrase, err = read() })
+		return passphrase, err
+	}, nil
+}
+
+// prompt asks for the passphrase in the terminal without echoing it.
+func prompt() ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to ask for the passphrase: %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, "Passphrase of the private key: ")
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = tty
+		return cmd.Run()
+	}
+	if stty("-echo") == nil {
+		defer stty("echo")
+	}
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
@@ -0,0 +1,139 @@
+package connection
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+)
+
+// The files in testdata were created with OpenSSL, the passphrase is "secret".
+func testdata(name string) string {
+	return filepath.Join("testdata", name)
+}
+
+func readTestdata(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(testdata(name))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return string(data)
+}
+
+func TestCredentials_Load(t *testing.T) {
+	secret := func() ([]byte, error) { return []byte("secret"), nil }
+	wrong := func() ([]byte, error) { return []byte("wrong"), nil }
+
+	tests := []struct {
+		name       string
+		creds      Credentials
+		wantChain  int
+		wantErr    error
+		wantFailed bool
+	}{
+		{name: "PEM files", creds: Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client.key")}, wantChain: 1},
+		{name: "PKCS#8 AES", creds: Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client-aes.key"), Passphrase: secret}, wantChain: 1},
+		{name: "PKCS#8 3DES", creds: Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client-3des.key"), Passphrase: secret}, wantChain: 1},
+		{name: "traditional encrypted PEM", creds: Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client-traditional.key"), Passphrase: secret}, wantChain: 1},
+		{name: "encrypted without passphrase", creds: Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client-aes.key")}, wantErr: ErrNoPassphrase},
+		{name: "PKCS#8 wrong passphrase", creds: Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client-aes.key"), Passphrase: wrong}, wantErr: ErrPassphrase},
+		{name: "PKCS#12", creds: Credentials{PKCS12File: testdata("client.p12"), Passphrase: secret}, wantChain: 2},
+		{name: "PKCS#12 3DES", creds: Credentials{PKCS12File: testdata("client-3des.p12"), Passphrase: secret}, wantChain: 2},
+		{name: "PKCS#12 wrong passphrase", creds: Credentials{PKCS12File: testdata("client.p12"), Passphrase: wrong}, wantErr: ErrPassphrase},
+		{name: "PKCS#12 RC2", creds: Credentials{PKCS12File: testdata("client-rc2.p12"), Passphrase: secret}, wantErr: ErrUnsupportedPKCS12},
+		{name: "embedded", creds: Credentials{CertPEM: readTestdata(t, "client.crt"), KeyPEM: readTestdata(t, "client.key")}, wantChain: 1},
+		{name: "embedded chain", creds: Credentials{CertPEM: readTestdata(t, "ca.crt") + readTestdata(t, "client.crt"), KeyPEM: readTestdata(t, "client.key")}, wantChain: 2},
+		{name: "key of another certificate", creds: Credentials{CertFile: testdata("ca.crt"), KeyFile: testdata("client.key")}, wantErr: ErrKeyMismatch},
+		{name: "missing file", creds: Credentials{CertFile: testdata("missing.crt"), KeyFile: testdata("client.key")}, wantFailed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := tt.creds.Load()
+			if tt.wantErr != nil || tt.wantFailed {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) || retry.Retryable(err) {
+					t.Errorf("Load() error = %v, want a permanent %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cert.Leaf.Subject.CommonName != "client" || len(cert.Certificate) != tt.wantChain {
+				t.Errorf("Load() = %q with %d certificates, want %q with %d", cert.Leaf.Subject.CommonName, len(cert.Certificate), "client", tt.wantChain)
+			}
+		})
+	}
+}
+
+func TestCheckValidity(t *testing.T) {
+	cert, err := Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client.key")}.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr error
+	}{
+		{name: "valid", now: cert.Leaf.NotBefore.Add(time.Hour)},
+		{name: "not valid yet", now: cert.Leaf.NotBefore.Add(-time.Hour), wantErr: ErrExpired},
+		{name: "expired", now: cert.Leaf.NotAfter.Add(time.Hour), wantErr: ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkValidity(cert.Leaf, tt.now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkValidity() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPassphraseFrom(t *testing.T) {
+	os.Setenv("MINER_TEST_PASSPHRASE", "from env")
+	defer os.Unsetenv("MINER_TEST_PASSPHRASE")
+
+	// The descriptor is opened without an *os.File, which would close it again when collected.
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := ioutil.WriteFile(path, []byte("from fd\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	fd, err := syscall.Open(path, syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	tests := []struct {
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{source: "env:MINER_TEST_PASSPHRASE", want: "from env"},
+		{source: "env:MINER_TEST_MISSING", wantErr: true},
+		{source: "fd:" + strconv.Itoa(int(fd)), want: "from fd"},
+		{source: "fd:x", wantErr: true},
+		{source: "secret", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			passphrase, err := PassphraseFrom(tt.source)
+			if err == nil {
+				var got []byte
+				got, err = passphrase()
+				if err == nil && string(got) != tt.want {
+					t.Errorf("passphrase() = %q, want %q", got, tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PassphraseFrom(%q) error = %v, want error %v", tt.source, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package connection
+
+import (
+	"strings"
+	"time"
+)
+
+// DeadlinePolicy is the time to answer each command of the server. The answer must be
+// written before the budget of the command ends, and the next command must arrive at most
+// Default after it, so a stalled write or a half-open connection fails instead of hanging.
+type DeadlinePolicy struct {
+	// Default is the budget of the commands not in Commands.
+	Default time.Duration
+	// Commands are the budgets of the commands that take longer.
+	Commands map[string]time.Duration
+}
+
+// DefaultDeadlinePolicy returns the limits of the server: 2 hours for POW and 6 seconds
+// for the rest of the commands.
+func DefaultDeadlinePolicy() DeadlinePolicy {
+	return DeadlinePolicy{
+		Default:  time.Second * 6,
+		Commands: map[string]time.Duration{"POW": time.Hour * 2},
+	}
+}
+
+// Budget returns the time to answer the line of the server, by its command.
+func (p DeadlinePolicy) Budget(line string) time.Duration {
+	command := line
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		command = line[:i]
+	}
+	if budget, ok := p.Commands[command]; ok {
+		return budget
+	}
+	return p.Default
+}
@@ -0,0 +1,135 @@
+package connection
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlinePolicy_Budget(t *testing.T) {
+	p := DefaultDeadlinePolicy()
+	tests := []struct {
+		line string
+		want time.Duration
+	}{
+		{line: "POW abcdef 9", want: time.Hour * 2},
+		{line: "HELO", want: time.Second * 6},
+		{line: "NAME abcdef", want: time.Second * 6},
+		{line: "POWER abcdef", want: time.Second * 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := p.Budget(tt.line); got != tt.want {
+				t.Errorf("Budget(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+// stallingPeer returns the address of a server that sends the lines and then neither
+// sends nor reads anything until the test ends.
+func stallingPeer(t *testing.T, lines ...string) string {
+	t.Helper()
+	done := make(chan struct{})
+	addr, _ := serveTLS(t, []string{"127.0.0.1"}, func(conn *tls.Conn) {
+		if err := conn.Handshake(); err != nil {
+			return
+		}
+		for _, line := range lines {
+			conn.Write([]byte(line + "\n"))
+		}
+		<-done
+	})
+	t.Cleanup(func() { close(done) })
+	return addr
+}
+
+// drainingPeer returns the address of a server that sends the lines and reads everything.
+func drainingPeer(t *testing.T, lines ...string) string {
+	t.Helper()
+	addr, _ := serveTLS(t, []string{"127.0.0.1"}, func(conn *tls.Conn) {
+		for _, line := range lines {
+			conn.Write([]byte(line + "\n"))
+		}
+		io.Copy(ioutil.Discard, conn)
+	})
+	return addr
+}
+
+func dialPeer(t *testing.T, addr string, policy DeadlinePolicy) *Connection {
+	t.Helper()
+	conn, err := DialEndpoints(Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client.key")}, []string{addr}, Verification{Insecure: true})
+	if err != nil {
+		t.Fatalf("DialEndpoints() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadlinePolicy(policy)
+	return conn
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func TestConnection_ReadLineTimesOutWhenThePeerStalls(t *testing.T) {
+	conn := dialPeer(t, stallingPeer(t, "HELO"), DeadlinePolicy{Default: time.Millisecond * 100})
+
+	if line, err := conn.ReadLine(); line != "HELO" || err != nil {
+		t.Fatalf("ReadLine() = %q, %v; want HELO", line, err)
+	}
+	start := time.Now()
+	_, err := conn.ReadLine()
+	if !isTimeout(err) {
+		t.Fatalf("ReadLine() error = %v, want a timeout", err)
+	}
+	// The next command is due the default budget after the answer to HELO is.
+	if elapsed := time.Since(start); elapsed < time.Millisecond*150 || elapsed > time.Second*2 {
+		t.Errorf("ReadLine() timed out after %v, want about 200ms", elapsed)
+	}
+}
+
+func TestConnection_WriteLineTimesOutWhenThePeerDoesNotRead(t *testing.T) {
+	conn := dialPeer(t, stallingPeer(t), DeadlinePolicy{Default: time.Millisecond * 100})
+
+	line := strings.Repeat("a", DefaultMaxLineSize)
+	start := time.Now()
+	var err error
+	for err == nil && time.Since(start) < time.Second*10 {
+		err = conn.WriteLine(line)
+	}
+	if !isTimeout(err) {
+		t.Errorf("WriteLine() error = %v, want a timeout once the buffers are full", err)
+	}
+}
+
+func TestConnection_WriteLineHasTheBudgetOfTheCommand(t *testing.T) {
+	policy := DeadlinePolicy{
+		Default:  time.Millisecond * 50,
+		Commands: map[string]time.Duration{"POW": time.Second * 5},
+	}
+	tests := []struct {
+		command     string
+		wantTimeout bool
+	}{
+		{command: "NAME abcdef", wantTimeout: true},
+		{command: "POW abcdef 9", wantTimeout: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			conn := dialPeer(t, drainingPeer(t, tt.command), policy)
+			if _, err := conn.ReadLine(); err != nil {
+				t.Fatalf("ReadLine() error = %v", err)
+			}
+			time.Sleep(time.Millisecond * 100)
+			if err := conn.WriteLine("answer"); isTimeout(err) != tt.wantTimeout {
+				t.Errorf("WriteLine() error = %v, want timeout %v", err, tt.wantTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package connection
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Formats of the diagnostics report.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ErrUnknownFormat is returned for a format of the report that is not text or json.
+var ErrUnknownFormat = errors.New("unknown format, use text or json")
+
+// Timings is how long each step of a dial took. Through a proxy, the name is resolved by the
+// proxy and the tunnel is the TCP time.
+type Timings struct {
+	DNS time.Duration
+	TCP time.Duration
+	TLS time.Duration
+}
+
+// MarshalJSON writes the timings in milliseconds.
+func (t Timings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]float64{
+		"dns_ms": milliseconds(t.DNS),
+		"tcp_ms": milliseconds(t.TCP),
+		"tls_ms": milliseconds(t.TLS),
+	})
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// CertificateInfo describes one certificate of the chain of the server.
+type CertificateInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	// SHA256 is the fingerprint of the certificate, as shown by openssl x509 -fingerprint -sha256.
+	SHA256 string `json:"sha256"`
+	// Pin is the fingerprint of the public key, as used by -tls-pin.
+	Pin string `json:"pin"`
+}
+
+// Report is the state of the TLS connection to the server.
+type Report struct {
+	Endpoint           string            `json:"endpoint"`
+	ServerName         string            `json:"server_name"`
+	Version            string            `json:"version"`
+	CipherSuite        string            `json:"cipher_suite"`
+	NegotiatedProtocol string            `json:"negotiated_protocol"`
+	DidResume          bool              `json:"did_resume"`
+	Timings            Timings           `json:"timings"`
+	Chain              []CertificateInfo `json:"chain"`
+	// Error is why the handshake failed, empty for a connection.
+	Error string `json:"error,omitempty"`
+}
+
+// NewReport returns the report of the connection state.
+func NewReport(endpoint string, state tls.ConnectionState, timings Timings) *Report {
+	r := &Report{
+		Endpoint:           endpoint,
+		ServerName:         state.ServerName,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		DidResume:          state.DidResume,
+		Timings:            timings,
+	}
+	// A handshake that failed before the server hello has no version.
+	if state.Version != 0 {
+		r.Version = versionName(state.Version)
+		r.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	}
+	for _, cert := range state.PeerCertificates {
+		r.Chain = append(r.Chain, certificateInfo(cert))
+	}
+	return r
+}
+
+func certificateInfo(cert *x509.Certificate) CertificateInfo {
+	sum := sha256.Sum256(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return CertificateInfo{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+		SHA256:    strings.Join(hex, ":"),
+		Pin:       Fingerprint(cert),
+	}
+}
+
+// versionName returns the name of the TLS version, or its number in hex when unknown.
+func versionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// Write writes the report to w in the format, text or json.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return r.WriteText(w)
+	case FormatJSON:
+		return r.WriteJSON(w)
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// WriteJSON writes the report to w as one JSON object.
+func (r *Report) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// WriteText writes the report to w for a human to read.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Endpoint: %s\n", r.Endpoint)
+	if r.Error != "" {
+		fmt.Fprintf(&b, "Handshake failed: %s\n", r.Error)
+	}
+	fmt.Fprintf(&b, "Server name: %s\n", r.ServerName)
+	fmt.Fprintf(&b, "Version: %s\n", r.Version)
+	fmt.Fprintf(&b, "Cipher suite: %s\n", r.CipherSuite)
+	fmt.Fprintf(&b, "Negotiated protocol: %s\n", r.NegotiatedProtocol)
+	fmt.Fprintf(&b, "Resumed: %t\n", r.DidResume)
+	fmt.Fprintf(&b, "Timings: DNS %v, TCP %v, TLS %v\n", r.Timings.DNS, r.Timings.TCP, r.Timings.TLS)
+	b.WriteString("Certificate chain:\n")
+	for i, cert := range r.Chain {
+		fmt.Fprintf(&b, " %d s:%s\n", i, cert.Subject)
+		fmt.Fprintf(&b, "   i:%s\n", cert.Issuer)
+		fmt.Fprintf(&b, "   valid: %s to %s\n", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		fmt.Fprintf(&b, "   SHA256: %s\n", cert.SHA256)
+		fmt.Fprintf(&b, "   key: %s\n", cert.Pin)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,133 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersionName(t *testing.T) {
+	tests := []struct {
+		version uint16
+		want    string
+	}{
+		{version: tls.VersionTLS12, want: "TLS 1.2"},
+		{version: tls.VersionTLS13, want: "TLS 1.3"},
+		{version: 0x7f1c, want: "0x7F1C"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := versionName(tt.version); got != tt.want {
+				t.Errorf("versionName(%x) = %q, want %q", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnection_Diagnose(t *testing.T) {
+	conn := dialPeer(t, drainingPeer(t), DefaultDeadlinePolicy())
+
+	report := conn.Diagnose()
+	if report.Version != "TLS 1.3" || report.CipherSuite != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("Diagnose() version %q and cipher suite %q, want the names of TLS 1.3", report.Version, report.CipherSuite)
+	}
+	if report.Endpoint != conn.Endpoint() || report.ServerName != "127.0.0.1" {
+		t.Errorf("Diagnose() endpoint %q and server name %q, want %q", report.Endpoint, report.ServerName, conn.Endpoint())
+	}
+	if report.Timings.TCP <= 0 || report.Timings.TLS <= 0 {
+		t.Errorf("Diagnose() timings = %+v, want the TCP and TLS times", report.Timings)
+	}
+	if len(report.Chain) != 1 {
+		t.Fatalf("Diagnose() chain = %+v, want the leaf of the server", report.Chain)
+	}
+	leaf := conn.conn.ConnectionState().PeerCertificates[0]
+	if cert := report.Chain[0]; cert.Pin != Fingerprint(leaf) || len(cert.SHA256) != 95 || !cert.NotAfter.Equal(leaf.NotAfter) {
+		t.Errorf("Diagnose() chain[0] = %+v, want the details of the leaf", cert)
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	report := &Report{
+		Endpoint:    "127.0.0.1:3336",
+		Version:     "TLS 1.3",
+		CipherSuite: "TLS_AES_128_GCM_SHA256",
+		Timings:     Timings{DNS: time.Millisecond, TCP: time.Millisecond * 2, TLS: time.Millisecond * 15},
+		Chain:       []CertificateInfo{{Subject: "CN=server", Issuer: "CN=ca", Pin: "sha256/abc"}},
+	}
+	tests := []struct {
+		format  string
+		want    []string
+		wantErr error
+	}{
+		{format: FormatText, want: []string{"Version: TLS 1.3\n", "Timings: DNS 1ms, TCP 2ms, TLS 15ms\n", " 0 s:CN=server\n", "   key: sha256/abc\n"}},
+		{format: FormatJSON, want: []string{`"cipher_suite":"TLS_AES_128_GCM_SHA256"`, `"tls_ms":15`, `"pin":"sha256/abc"`}},
+		{format: "yaml", wantErr: ErrUnknownFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := report.Write(&b, tt.format); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Write() error = %v, want %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("Write() = %s, want it to contain %q", b.String(), want)
+				}
+			}
+			if tt.format == FormatJSON && !json.Valid(b.Bytes()) {
+				t.Errorf("Write() = %s, want valid JSON", b.String())
+			}
+		})
+	}
+}
+
+func TestWithKeyLog(t *testing.T) {
+	var keyLog bytes.Buffer
+	conn, err := DialEndpoints(Credentials{CertFile: testdata("client.crt"), KeyFile: testdata("client.key")},
+		[]string{drainingPeer(t)}, Verification{Insecure: true}, WithKeyLog(&keyLog))
+	if err != nil {
+		t.Fatalf("DialEndpoints() error = %v", err)
+	}
+	defer conn.Close()
+
+	// The secrets of TLS 1.3 in the NSS key log format: label, client random and secret.
+	for _, label := range []string{"CLIENT_HANDSHAKE_TRAFFIC_SECRET ", "CLIENT_TRAFFIC_SECRET_0 "} {
+		if !strings.Contains(keyLog.String(), label) {
+			t.Errorf("key log = %q, want a %sline", keyLog.String(), label)
+		}
+	}
+}
+
+func TestFailover_ReportsFailedHandshake(t *testing.T) {
+	untrusted := tlsListener(t)
+	refused := refusingListener(t)
+	config, err := Verification{}.TLSConfig(nil)
+	if err != nil {
+		t.Fatalf("TLSConfig() error = %v", err)
+	}
+	_, _, err = NewFailover([]string{untrusted, refused}, config).Dial(context.TODO())
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) || len(dialErr.Errors) != 2 {
+		t.Fatalf("Dial() error = %v, want a DialError of two endpoints", err)
+	}
+
+	report := dialErr.Errors[0].Report
+	if report == nil {
+		t.Fatalf("no report of the failed handshake")
+	}
+	if report.Version != "TLS 1.3" || report.ServerName != "127.0.0.1" || len(report.Chain) == 0 || report.Error == "" || report.Timings.TCP == 0 {
+		t.Errorf("report = %+v, want the version, the server name, the chain and the error", report)
+	}
+	var b bytes.Buffer
+	if err := report.WriteText(&b); err != nil || !strings.Contains(b.String(), "Handshake failed: ") {
+		t.Errorf("WriteText() = %q, %v; want the failure", b.String(), err)
+	}
+	if report := dialErr.Errors[1].Report; report != nil {
+		t.Errorf("report of a refused endpoint = %+v, want nil", report)
+	}
+}
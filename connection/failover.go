@@ -0,0 +1,473 @@
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+)
+
+// DefaultDialTimeout is how long each endpoint has to connect and complete the TLS handshake.
+const DefaultDialTimeout = time.Second * 10
+
+// DefaultParallelDelay is how long a parallel dial waits for an endpoint before it also
+// tries the next one, as in happy eyeballs.
+const DefaultParallelDelay = time.Millisecond * 250
+
+// ErrNoEndpoints is returned when there is no endpoint to dial.
+var ErrNoEndpoints = errors.New("no endpoints to dial")
+
+// ErrDialTimeout is the error of an endpoint that did not connect before the dial timeout,
+// a server that stalls may answer the next time so it is retryable.
+var ErrDialTimeout = errors.New("dial timed out")
+
+// EndpointError is the failure of one endpoint.
+type EndpointError struct {
+	Endpoint string
+	Err      error
+	// Report is the state of the TLS connection when the handshake failed, with the chain
+	// of the server if it was received. It is nil when the endpoint was not reached.
+	Report *Report
+}
+
+func (e *EndpointError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Endpoint, e.Err)
+}
+
+func (e *EndpointError) Unwrap() error {
+	return e.Err
+}
+
+// DialError is returned when every endpoint failed, with the failure of each one.
+type DialError struct {
+	Errors []*EndpointError
+}
+
+func (e *DialError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "all endpoints failed: " + strings.Join(msgs, "; ")
+}
+
+// Permanent is true when the error of every endpoint is permanent, as when the server
+// failed the verification or sent a TLS alert, retrying with the same certificates fails
+// again. Timeouts and refused connections are retryable.
+func (e *DialError) Permanent() bool {
+	for _, err := range e.Errors {
+		var p interface{ Permanent() bool }
+		if !errors.As(err.Err, &p) || !p.Permanent() {
+			return false
+		}
+	}
+	return len(e.Errors) > 0
+}
+
+// FailoverOption configures the failover.
+type FailoverOption func(*Failover)
+
+// WithParallel tries the next endpoint when the current one did not connect after the
+// delay, without waiting for it to fail. The first endpoint to connect is used.
+func WithParallel(delay time.Duration) FailoverOption {
+	return func(f *Failover) {
+		f.parallel = true
+		f.delay = delay
+	}
+}
+
+// WithDialTimeout sets how long each endpoint has to connect and complete the TLS handshake.
+func WithDialTimeout(timeout time.Duration) FailoverOption {
+	return func(f *Failover) {
+		f.timeout = timeout
+	}
+}
+
+// WithKeyLog writes the TLS secrets of the connections to w in the NSS key log format,
+// so a capture of the traffic can be decrypted. Anyone with the file can read the traffic.
+func WithKeyLog(w io.Writer) FailoverOption {
+	return func(f *Failover) {
+		f.config = f.config.Clone()
+		f.config.KeyLogWriter = w
+	}
+}
+
+// WithObserver calls observe after each endpoint is dialed, with the error of the dial or
+// nil if it connected. It is called from the gorutines of a parallel dial.
+func WithObserver(observe func(endpoint string, err error)) FailoverOption {
+	return func(f *Failover) {
+		f.observe = observe
+	}
+}
+
+// WithProxy connects to the endpoints through the proxies returned by the function,
+// the TLS connection runs through the tunnel.
+func WithProxy(proxy ProxyFunc) FailoverOption {
+	return func(f *Failover) {
+		f.proxy = proxy
+	}
+}
+
+// Failover dials the first endpoint of a list that accepts the connection. The endpoint
+// that worked the last time is tried first.
+type Failover struct {
+	endpoints []string
+	config    *tls.Config
+	parallel  bool
+	delay     time.Duration
+	timeout   time.Duration
+	proxy     ProxyFunc
+	observe   func(endpoint string, err error)
+
+	mu      sync.Mutex
+	last    string
+	timings Timings
+}
+
+// NewFailover returns a failover for the endpoints, in the order they are tried.
+func NewFailover(endpoints []string, config *tls.Config, opts ...FailoverOption) *Failover {
+	f := &Failover{
+		endpoints: endpoints,
+		config:    config,
+		delay:     DefaultParallelDelay,
+		timeout:   DefaultDialTimeout,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Last returns the endpoint of the last successful dial.
+func (f *Failover) Last() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last
+}
+
+// Timings returns how long each step of the last successful dial took.
+func (f *Failover) Timings() Timings {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.timings
+}
+
+// Dial connects to the first endpoint that accepts the connection and returns it with
+// the endpoint. It returns a *DialError with the failure of every endpoint if none did.
+func (f *Failover) Dial(ctx context.Context) (*tls.Conn, string, error) {
+	endpoints := f.order()
+	if len(endpoints) == 0 {
+		return nil, "", ErrNoEndpoints
+	}
+
+	var a attempt
+	if f.parallel {
+		a = f.dialParallel(ctx, endpoints)
+	} else {
+		a = f.dialOrdered(ctx, endpoints)
+	}
+	if a.err != nil {
+		return nil, "", a.err
+	}
+
+	f.mu.Lock()
+	f.last = a.endpoint
+	f.timings = a.timings
+	f.mu.Unlock()
+	return a.conn, a.endpoint, nil
+}
+
+// order returns the endpoints with the last one that worked first.
+func (f *Failover) order() []string {
+	last := f.Last()
+	endpoints := make([]string, 0, len(f.endpoints))
+	if last != "" {
+		endpoints = append(endpoints, last)
+	}
+	for _, endpoint := range f.endpoints {
+		if endpoint != last {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// attempt is the result of dialing one endpoint.
+type attempt struct {
+	endpoint string
+	conn     *tls.Conn
+	timings  Timings
+	// state is the state of the connection when the handshake failed.
+	state *tls.ConnectionState
+	err   error
+}
+
+// dialOrdered tries the endpoints one after the other.
+func (f *Failover) dialOrdered(ctx context.Context, endpoints []string) attempt {
+	dialErr := &DialError{}
+	for _, endpoint := range endpoints {
+		a := f.dialOne(ctx, endpoint)
+		if a.err == nil {
+			return a
+		}
+		dialErr.Errors = append(dialErr.Errors, f.failed(a))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return attempt{err: dialErr}
+}
+
+// dialParallel starts an endpoint every delay, or as soon as one fails,
+// and returns the first connection. The connections that succeed later are closed.
+func (f *Failover) dialParallel(ctx context.Context, endpoints []string) attempt {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	attempts := make(chan attempt, len(endpoints))
+	var tick <-chan time.Time
+	next, pending := 0, 0
+	startNext := func() {
+		if next == len(endpoints) || ctx.Err() != nil {
+			return
+		}
+		endpoint := endpoints[next]
+		go func() {
+			attempts <- f.dialOne(ctx, endpoint)
+		}()
+		next++
+		pending++
+		tick = time.After(f.delay)
+	}
+
+	dialErr := &DialError{}
+	for {
+		if pending == 0 {
+			startNext()
+		}
+		if pending == 0 {
+			return attempt{err: dialErr}
+		}
+
+		select {
+		case a := <-attempts:
+			pending--
+			if a.err == nil {
+				cancel()
+				go closeLate(attempts, pending)
+				return a
+			}
+			dialErr.Errors = append(dialErr.Errors, f.failed(a))
+			startNext()
+		case <-tick:
+			startNext()
+		}
+	}
+}
+
+// closeLate closes the connections of the attempts still pending when the dial returned.
+func closeLate(attempts <-chan attempt, pending int) {
+	for ; pending > 0; pending-- {
+		if a := <-attempts; a.conn != nil {
+			a.conn.Close()
+		}
+	}
+}
+
+// dial connects to the endpoint and completes the TLS handshake before the timeout,
+// timing each step.
+func (f *Failover) dial(parent context.Context, endpoint string) (a attempt) {
+	ctx, cancel := context.WithTimeout(parent, f.timeout)
+	defer cancel()
+
+	a = attempt{endpoint: endpoint}
+	defer func() {
+		// The timeout of the endpoint is not the one of the caller, which stays fatal. The
+		// deadline of the connection can expire just before the one of the context.
+		timedOut := ctx.Err() == context.DeadlineExceeded || errors.Is(a.err, os.ErrDeadlineExceeded)
+		if a.err != nil && timedOut && parent.Err() == nil {
+			a.err = fmt.Errorf("%w after %v", ErrDialTimeout, f.timeout)
+		}
+	}()
+	config := f.config
+	if host, _, err := net.SplitHostPort(endpoint); err == nil && config.ServerName == "" && config.VerifyConnection != nil {
+		// The connection state has no server name for IP addresses, because they are not
+		// sent in the SNI, so it is set here for the verification.
+		config = config.Clone()
+		config.ServerName = host
+		verifyConnection := config.VerifyConnection
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if cs.ServerName == "" {
+				cs.ServerName = host
+			}
+			return verifyConnection(cs)
+		}
+	}
+	var proxy *url.URL
+	if f.proxy != nil {
+		var err error
+		if proxy, err = f.proxy(endpoint); err != nil {
+			a.err = retry.Permanent(err)
+			return a
+		}
+	}
+
+	var raw net.Conn
+	if proxy == nil {
+		raw, a.err = dialTCP(ctx, endpoint, &a.timings)
+	} else {
+		// The proxy resolves the name of the endpoint, the time of the tunnel is the TCP time.
+		logger.Info("connecting through proxy", logging.KeyEndpoint, endpoint, "proxy", proxy.Redacted())
+		start := time.Now()
+		raw, a.err = dialProxy(ctx, proxy, endpoint)
+		a.timings.TCP = time.Since(start)
+	}
+	if a.err != nil {
+		return a
+	}
+	start := time.Now()
+	var state tls.ConnectionState
+	a.conn, state, a.err = handshake(ctx, raw, config, endpoint)
+	a.timings.TLS = time.Since(start)
+	if a.err != nil {
+		// IP addresses are not sent in the SNI, the name verified is the configured one or the host.
+		if state.ServerName == "" {
+			state.ServerName = config.ServerName
+		}
+		if host, _, err := net.SplitHostPort(endpoint); err == nil && state.ServerName == "" {
+			state.ServerName = host
+		}
+		a.state = &state
+	}
+	return a
+}
+
+// dialOne dials the endpoint and reports the result to the observer.
+func (f *Failover) dialOne(ctx context.Context, endpoint string) attempt {
+	a := f.dial(ctx, endpoint)
+	if f.observe != nil {
+		f.observe(endpoint, a.err)
+	}
+	return a
+}
+
+// dialTCP resolves the host of the endpoint and connects to the first of its addresses
+// that accepts the connection.
+func dialTCP(ctx context.Context, endpoint string, timings *Timings) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	timings.DNS = time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+
+	start = time.Now()
+	defer func() { timings.TCP = time.Since(start) }()
+	var dialer net.Dialer
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, port)); err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// interruptOnDone sets the deadline of the connection to the one of the context, and to now
+// when the context is done, so the reads and writes blocked in it return. The function
+// returned stops watching the context and returns once the deadline is no longer changed,
+// so the caller can clear it.
+func interruptOnDone(ctx context.Context, conn net.Conn) (stop func()) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// handshake runs the TLS handshake of the client in the connection before the context is done.
+// When it fails, it returns the state of the connection reached by the handshake.
+func handshake(ctx context.Context, raw net.Conn, config *tls.Config, endpoint string) (*tls.Conn, tls.ConnectionState, error) {
+	if host, _, err := net.SplitHostPort(endpoint); err == nil && config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = host
+	}
+	conn := tls.Client(raw, config)
+
+	stop := interruptOnDone(ctx, conn)
+	err := conn.Handshake()
+	stop()
+	if err != nil {
+		state := conn.ConnectionState()
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, state, ctx.Err()
+		}
+		return nil, state, permanentHandshake(err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, tls.ConnectionState{}, nil
+}
+
+// permanentHandshake marks the failures of the handshake that happen again with the same
+// certificates as permanent: the certificate of the server is not valid, or the server sent
+// an alert, as when it refuses the certificate of the client.
+func permanentHandshake(err error) error {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalid          x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		opErr            *net.OpError
+	)
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalid), errors.As(err, &hostname):
+		return retry.Permanent(err)
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// The alerts received from the peer are the only errors crypto/tls wraps in an
+		// *net.OpError with this operation.
+		return retry.Permanent(err)
+	}
+	return err
+}
+
+// failed logs the failure of the attempt and returns it, with the report of the handshake
+// if it was reached.
+func (f *Failover) failed(a attempt) *EndpointError {
+	logger.Warn("failed to connect", logging.KeyEndpoint, a.endpoint, logging.KeyError, a.err)
+	e := &EndpointError{Endpoint: a.endpoint, Err: a.err}
+	if a.state != nil {
+		e.Report = NewReport(a.endpoint, *a.state, a.timings)
+		e.Report.Error = a.err.Error()
+	}
+	return e
+}
@@ -0,0 +1,322 @@
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/pki"
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+)
+
+// tlsListener returns the address of a server that completes the TLS handshake.
+func tlsListener(t *testing.T) string {
+	t.Helper()
+	addr, _ := pkiListener(t, []string{"127.0.0.1"})
+	return addr
+}
+
+// pkiListener returns the address of a server that completes the TLS handshake with a
+// certificate for the hosts, and the directory of the CA that issued it.
+func pkiListener(t *testing.T, hosts []string) (string, string) {
+	t.Helper()
+	return serveTLS(t, hosts, func(conn *tls.Conn) {
+		conn.Handshake()
+		conn.Read(make([]byte, 1))
+	})
+}
+
+// serveTLS runs the handler in every connection of a server with a certificate for the
+// hosts, and returns its address and the directory of the CA that issued it.
+func serveTLS(t *testing.T, hosts []string, handle func(conn *tls.Conn)) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := pki.Init(dir, hosts); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	cert, err := LoadCertificate(filepath.Join(dir, pki.CoordinatorCertFile), filepath.Join(dir, pki.CoordinatorKeyFile))
+	if err != nil {
+		t.Fatalf("LoadCertificate() error = %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn.(*tls.Conn))
+			}()
+		}
+	}()
+	return listener.Addr().String(), dir
+}
+
+// hangingListener returns the address of a server that accepts connections but never answers.
+func hangingListener(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	var conns []net.Conn
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		listener.Close()
+		<-done
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		defer close(done)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// refusingListener returns the address of a closed port.
+func refusingListener(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestFailover_Dial(t *testing.T) {
+	good := tlsListener(t)
+	hanging := hangingListener(t)
+	refused := refusingListener(t)
+	config := &tls.Config{InsecureSkipVerify: true}
+
+	tests := []struct {
+		name       string
+		endpoints  []string
+		opts       []FailoverOption
+		want       string
+		wantFailed []string
+		maxElapsed time.Duration
+	}{
+		{
+			name:       "first endpoint works",
+			endpoints:  []string{good, refused},
+			want:       good,
+			maxElapsed: time.Second,
+		},
+		{
+			name:       "in order after refused and hanging",
+			endpoints:  []string{refused, hanging, good},
+			opts:       []FailoverOption{WithDialTimeout(time.Millisecond * 200)},
+			want:       good,
+			maxElapsed: time.Second * 2,
+		},
+		{
+			name:       "parallel does not wait for the hanging endpoint",
+			endpoints:  []string{hanging, good},
+			opts:       []FailoverOption{WithParallel(time.Millisecond * 50), WithDialTimeout(time.Second * 10)},
+			want:       good,
+			maxElapsed: time.Second * 2,
+		},
+		{
+			name:       "every endpoint fails",
+			endpoints:  []string{refused, hanging},
+			opts:       []FailoverOption{WithDialTimeout(time.Millisecond * 200)},
+			wantFailed: []string{refused, hanging},
+			maxElapsed: time.Second * 2,
+		},
+		{
+			name:       "every endpoint fails in parallel",
+			endpoints:  []string{hanging, refused},
+			opts:       []FailoverOption{WithParallel(time.Millisecond * 50), WithDialTimeout(time.Millisecond * 200)},
+			wantFailed: []string{refused, hanging},
+			maxElapsed: time.Second * 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFailover(tt.endpoints, config, tt.opts...)
+			start := time.Now()
+			conn, endpoint, err := f.Dial(context.TODO())
+			if elapsed := time.Since(start); elapsed > tt.maxElapsed {
+				t.Errorf("Dial() took %v, want less than %v", elapsed, tt.maxElapsed)
+			}
+
+			if tt.wantFailed != nil {
+				var dialErr *DialError
+				if !errors.As(err, &dialErr) {
+					t.Fatalf("Dial() error = %v, want a *DialError", err)
+				}
+				if len(dialErr.Errors) != len(tt.wantFailed) {
+					t.Fatalf("Dial() failures = %v, want %v", dialErr.Errors, tt.wantFailed)
+				}
+				for i, failed := range tt.wantFailed {
+					if dialErr.Errors[i].Endpoint != failed {
+						t.Errorf("failure %d = %s, want %s", i, dialErr.Errors[i].Endpoint, failed)
+					}
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+			if endpoint != tt.want || f.Last() != tt.want {
+				t.Errorf("Dial() endpoint = %s, Last() = %s, want %s", endpoint, f.Last(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFailover_TriesLastWorkingEndpointFirst(t *testing.T) {
+	good := tlsListener(t)
+	hanging := hangingListener(t)
+
+	f := NewFailover([]string{hanging, good}, &tls.Config{InsecureSkipVerify: true}, WithDialTimeout(time.Millisecond*500))
+	conn, _, err := f.Dial(context.TODO())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	conn.Close()
+
+	start := time.Now()
+	conn, endpoint, err := f.Dial(context.TODO())
+	if err != nil {
+		t.Fatalf("second Dial() error = %v", err)
+	}
+	conn.Close()
+	if endpoint != good || time.Since(start) > time.Millisecond*400 {
+		t.Errorf("second Dial() = %s after %v, want %s without waiting for %s", endpoint, time.Since(start), good, hanging)
+	}
+}
+
+func TestFailover_Observer(t *testing.T) {
+	good := tlsListener(t)
+	refused := refusingListener(t)
+
+	var observed []string
+	observe := func(endpoint string, err error) {
+		observed = append(observed, fmt.Sprintf("%s %t", endpoint, err == nil))
+	}
+	f := NewFailover([]string{refused, good}, &tls.Config{InsecureSkipVerify: true}, WithObserver(observe))
+	conn, _, err := f.Dial(context.TODO())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	conn.Close()
+
+	want := []string{refused + " false", good + " true"}
+	if strings.Join(observed, ",") != strings.Join(want, ",") {
+		t.Errorf("observed %v, want %v", observed, want)
+	}
+}
+
+func TestFailover_NoEndpoints(t *testing.T) {
+	if _, _, err := NewFailover(nil, &tls.Config{}).Dial(context.TODO()); err != ErrNoEndpoints {
+		t.Errorf("Dial() error = %v, want %v", err, ErrNoEndpoints)
+	}
+}
+
+func TestFailover_TimeoutsAreRetryable(t *testing.T) {
+	f := NewFailover([]string{hangingListener(t)}, &tls.Config{InsecureSkipVerify: true}, WithDialTimeout(time.Millisecond*100))
+	_, _, err := f.Dial(context.TODO())
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) || !errors.Is(dialErr.Errors[0].Err, ErrDialTimeout) {
+		t.Fatalf("Dial() error = %v, want %v", err, ErrDialTimeout)
+	}
+	if dialErr.Permanent() || !retry.Retryable(err) {
+		t.Errorf("Dial() error = %v is permanent, want a retryable error", err)
+	}
+}
+
+// alertListener returns the address of a server that requires a certificate of the client
+// and sends an alert to the clients that have none.
+func alertListener(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := pki.Init(dir, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	cert, err := LoadCertificate(filepath.Join(dir, pki.CoordinatorCertFile), filepath.Join(dir, pki.CoordinatorKeyFile))
+	if err != nil {
+		t.Fatalf("LoadCertificate() error = %v", err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		// In TLS 1.3 the client reads the alert after its handshake completed.
+		MaxVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDialError_Permanent(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		config    *tls.Config
+		permanent bool
+	}{
+		{name: "refused", endpoint: refusingListener(t), config: &tls.Config{InsecureSkipVerify: true}},
+		{name: "unknown authority", endpoint: tlsListener(t), config: &tls.Config{}, permanent: true},
+		{name: "alert from the server", endpoint: alertListener(t), config: &tls.Config{InsecureSkipVerify: true}, permanent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewFailover([]string{tt.endpoint}, tt.config).Dial(context.TODO())
+			var dialErr *DialError
+			if !errors.As(err, &dialErr) {
+				t.Fatalf("Dial() error = %v, want a *DialError", err)
+			}
+			if dialErr.Permanent() != tt.permanent || retry.Retryable(err) == tt.permanent {
+				t.Errorf("Dial() error = %v, Permanent() = %v, want %v", err, dialErr.Permanent(), tt.permanent)
+			}
+		})
+	}
+}
+
+func TestDialEndpoints_CertificateErrorsArePermanent(t *testing.T) {
+	_, err := DialEndpoints(Credentials{CertFile: "missing.crt", KeyFile: "missing.key"}, []string{refusingListener(t)}, Verification{})
+	if err == nil || retry.Retryable(err) {
+		t.Errorf("DialEndpoints() error = %v, want a permanent error", err)
+	}
+}
@@ -0,0 +1,97 @@
+package connection
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxLineSize is the longest line, without the newline, read from or written to the server.
+const DefaultMaxLineSize = 4096
+
+var (
+	// ErrLineTooLong is returned for a line longer than the limit.
+	ErrLineTooLong = errors.New("line too long")
+	// ErrInvalidUTF8 is returned for a line that is not valid UTF-8.
+	ErrInvalidUTF8 = errors.New("line is not valid UTF-8")
+	// ErrNewline is returned for an outgoing value with a newline, which would split it in two lines.
+	ErrNewline = errors.New("newline in the value")
+)
+
+// FieldError is returned when an outgoing field can not be sent in one line.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateField checks that the value of the field is valid UTF-8 without newlines.
+func ValidateField(field, value string) error {
+	if !utf8.ValidString(value) {
+		return &FieldError{Field: field, Err: ErrInvalidUTF8}
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return &FieldError{Field: field, Err: ErrNewline}
+	}
+	return nil
+}
+
+// LineReader reads the lines of the protocol, ended by \n or \r\n.
+type LineReader struct {
+	r   *bufio.Reader
+	max int
+}
+
+// NewLineReader returns a reader of lines of at most max bytes.
+func NewLineReader(r io.Reader, max int) *LineReader {
+	// The buffer fits the longest line with its \r\n.
+	return &LineReader{r: bufio.NewReaderSize(r, max+2), max: max}
+}
+
+// ReadLine returns the next line without the newline. It fails with ErrLineTooLong or
+// ErrInvalidUTF8 for a line that breaks the protocol.
+func (l *LineReader) ReadLine() (string, error) {
+	data, err := l.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("%w: more than %d bytes", ErrLineTooLong, l.max)
+	}
+	if err != nil {
+		if err == io.EOF && len(data) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	line := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if len(line) > l.max {
+		return "", fmt.Errorf("%w: %d bytes, limit %d", ErrLineTooLong, len(line), l.max)
+	}
+	if !utf8.ValidString(line) {
+		return "", ErrInvalidUTF8
+	}
+	return line, nil
+}
+
+// checkLine checks that the line can be sent as one line of the protocol.
+func checkLine(line string, max int) error {
+	if len(line) > max {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrLineTooLong, len(line), max)
+	}
+	if !utf8.ValidString(line) {
+		return ErrInvalidUTF8
+	}
+	if strings.ContainsAny(line, "\r\n") {
+		return ErrNewline
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineReader_ReadLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{name: "lines", input: "HELO\nPOW abc 9\n", want: []string{"HELO", "POW abc 9"}, wantErr: io.EOF},
+		{name: "CRLF", input: "HELO\r\n", want: []string{"HELO"}, wantErr: io.EOF},
+		{name: "UTF-8", input: "NAME Jürgen\n", want: []string{"NAME Jürgen"}, wantErr: io.EOF},
+		{name: "longest line", input: strings.Repeat("a", 16) + "\r\n", want: []string{strings.Repeat("a", 16)}, wantErr: io.EOF},
+		{name: "too long", input: "HELO\n" + strings.Repeat("a", 17) + "\n", want: []string{"HELO"}, wantErr: ErrLineTooLong},
+		{name: "too long without newline", input: strings.Repeat("a", 40), wantErr: ErrLineTooLong},
+		{name: "invalid UTF-8", input: "NAME \xff\n", wantErr: ErrInvalidUTF8},
+		{name: "line without newline", input: "HELO", wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewLineReader(strings.NewReader(tt.input), 16)
+			var got []string
+			var err error
+			for {
+				var line string
+				if line, err = r.ReadLine(); err != nil {
+					break
+				}
+				got = append(got, line)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadLine() = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateField(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr error
+	}{
+		{value: "My name"},
+		{value: "Große Straße 3"},
+		{value: "Long street 3\nEND", wantErr: ErrNewline},
+		{value: "Long street 3\r", wantErr: ErrNewline},
+		{value: "\xc3\x28", wantErr: ErrInvalidUTF8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			err := ValidateField("Address[0]", tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateField() error = %v, want %v", err, tt.wantErr)
+			}
+			var field *FieldError
+			if err != nil && (!errors.As(err, &field) || field.Field != "Address[0]") {
+				t.Errorf("ValidateField() error = %v, want a FieldError of Address[0]", err)
+			}
+		})
+	}
+}
+
+func TestCheckLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		wantErr error
+	}{
+		{line: "EHLO"},
+		{line: strings.Repeat("a", 16)},
+		{line: strings.Repeat("a", 17), wantErr: ErrLineTooLong},
+		{line: "OK\nEND", wantErr: ErrNewline},
+		{line: "\xff", wantErr: ErrInvalidUTF8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if err := checkLine(tt.line, 16); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkLine() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
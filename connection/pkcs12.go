@@ -0,0 +1,280 @@
+package connection
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+)
+
+// ErrUnsupportedPKCS12 is returned for bundles that use algorithms only found in legacy
+// tools, they can be converted with: openssl pkcs12 -export -certpbe AES-256-CBC -keypbe AES-256-CBC.
+var ErrUnsupportedPKCS12 = errors.New("unsupported PKCS#12 bundle")
+
+var (
+	oidDataContent          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContent = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPBEWithSHA3DES       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// The structures of a PKCS#12 bundle, RFC 7292.
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue   `asn1:"tag:0,explicit"`
+	Attributes []asn1.RawValue `asn1:"set,optional"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// parsePKCS12 returns the certificates and the private key of the bundle, after checking
+// its integrity with the passphrase.
+func parsePKCS12(der, passphrase []byte) ([]*x509.Certificate, crypto.PrivateKey, error) {
+	var bundle pfx
+	if _, err := asn1.Unmarshal(der, &bundle); err != nil {
+		return nil, nil, fmt.Errorf("invalid PKCS#12 bundle: %w", err)
+	}
+	if bundle.Version != 3 || !bundle.AuthSafe.ContentType.Equal(oidDataContent) {
+		return nil, nil, fmt.Errorf("%w: version %d, content %v", ErrUnsupportedPKCS12, bundle.Version, bundle.AuthSafe.ContentType)
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(bundle.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, nil, fmt.Errorf("invalid PKCS#12 content: %w", err)
+	}
+	if len(bundle.MacData.Mac.Algorithm.Algorithm) > 0 {
+		if err := verifyMac(bundle.MacData, authSafe, passphrase); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, nil, fmt.Errorf("invalid PKCS#12 content: %w", err)
+	}
+	var certs []*x509.Certificate
+	var key crypto.PrivateKey
+	for _, content := range contents {
+		var data []byte
+		switch {
+		case content.ContentType.Equal(oidDataContent):
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &data); err != nil {
+				return nil, nil, fmt.Errorf("invalid PKCS#12 content: %w", err)
+			}
+		case content.ContentType.Equal(oidEncryptedDataContent):
+			var encrypted encryptedData
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &encrypted); err != nil {
+				return nil, nil, fmt.Errorf("invalid PKCS#12 encrypted content: %w", err)
+			}
+			info := encrypted.EncryptedContentInfo
+			var err error
+			data, err = decrypt(info.ContentEncryptionAlgorithm, info.EncryptedContent, passphrase)
+			if errors.Is(err, ErrPassphrase) || errors.Is(err, ErrTooManyIterations) {
+				return nil, nil, err
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedPKCS12, err)
+			}
+		default:
+			return nil, nil, fmt.Errorf("%w: content %v", ErrUnsupportedPKCS12, content.ContentType)
+		}
+
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(data, &bags); err != nil {
+			return nil, nil, fmt.Errorf("invalid PKCS#12 bags: %w", err)
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var cb certBag
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+					return nil, nil, fmt.Errorf("invalid PKCS#12 certificate: %w", err)
+				}
+				if !cb.ID.Equal(oidX509Certificate) {
+					continue
+				}
+				cert, err := x509.ParseCertificate(cb.Data)
+				if err != nil {
+					return nil, nil, err
+				}
+				certs = append(certs, cert)
+			case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidShroudedKeyBag):
+				keyDER := bag.Value.Bytes
+				if bag.ID.Equal(oidShroudedKeyBag) {
+					var err error
+					if keyDER, err = decryptPKCS8(keyDER, passphrase); err != nil {
+						return nil, nil, err
+					}
+				}
+				var err error
+				if key, err = x509.ParsePKCS8PrivateKey(keyDER); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+	if key == nil || len(certs) == 0 {
+		return nil, nil, errors.New("PKCS#12 bundle without a certificate and a private key")
+	}
+	return certs, key, nil
+}
+
+// verifyMac checks the MAC of the content, a mismatch means a wrong passphrase or a corrupted bundle.
+func verifyMac(mac macData, content, passphrase []byte) error {
+	var h func() hash.Hash
+	switch algorithm := mac.Mac.Algorithm.Algorithm; {
+	case algorithm.Equal(oidSHA1):
+		h = sha1.New
+	case algorithm.Equal(oidSHA256):
+		h = sha256.New
+	case algorithm.Equal(oidSHA384):
+		h = sha512.New384
+	case algorithm.Equal(oidSHA512):
+		h = sha512.New
+	default:
+		return fmt.Errorf("%w: MAC %v", ErrUnsupportedPKCS12, algorithm)
+	}
+	if err := checkIterations(mac.Iterations); err != nil {
+		return err
+	}
+	key := pkcs12KDF(h, bmpString(passphrase), mac.MacSalt, mac.Iterations, 3, h().Size())
+	m := hmac.New(h, key)
+	m.Write(content)
+	if !hmac.Equal(m.Sum(nil), mac.Mac.Digest) {
+		return ErrPassphrase
+	}
+	return nil
+}
+
+// pkcs12PBECipher returns the 3DES cipher and IV of pbeWithSHAAnd3-KeyTripleDES-CBC.
+func pkcs12PBECipher(params, passphrase []byte) (cipher.Block, []byte, error) {
+	var p pbeParams
+	if _, err := asn1.Unmarshal(params, &p); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBE parameters: %w", err)
+	}
+	if err := checkIterations(p.Iterations); err != nil {
+		return nil, nil, err
+	}
+	password := bmpString(passphrase)
+	block, err := des.NewTripleDESCipher(pkcs12KDF(sha1.New, password, p.Salt, p.Iterations, 1, 24))
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, pkcs12KDF(sha1.New, password, p.Salt, p.Iterations, 2, 8), nil
+}
+
+// pkcs12KDF derives size bytes for the purpose id, RFC 7292 appendix B.2.
+func pkcs12KDF(h func() hash.Hash, password, salt []byte, iterations int, id byte, size int) []byte {
+	u := h().Size()
+	v := h().BlockSize()
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(data)+v-1)/v))
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	in := append(fill(salt), fill(password)...)
+
+	var out []byte
+	for len(out) < size {
+		digest := h()
+		digest.Write(d)
+		digest.Write(in)
+		a := digest.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			digest = h()
+			digest.Write(a)
+			a = digest.Sum(a[:0])
+		}
+		out = append(out, a...)
+
+		// Every block of the input is incremented by the digest plus one.
+		b := make([]byte, v)
+		for i := range b {
+			b[i] = a[i%u]
+		}
+		for j := 0; j < len(in); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(in[j+k]) + int(b[k]) + carry
+				in[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// bmpString encodes the password as a big endian UTF-16 string with a terminating zero.
+func bmpString(password []byte) []byte {
+	var out []byte
+	for _, r := range utf16.Encode([]rune(string(password))) {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return append(out, 0, 0)
+}
@@ -0,0 +1,203 @@
+package connection
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// ErrPassphrase is returned when a key or bundle can not be decrypted with the passphrase.
+var ErrPassphrase = errors.New("wrong passphrase")
+
+// ErrTooManyIterations is returned for a key or bundle whose key derivation asks for more than
+// MaxIterations, which would hang the miner while loading it.
+var ErrTooManyIterations = errors.New("too many key derivation iterations")
+
+// MaxIterations is the most iterations of a key derivation accepted from a key or bundle. Tools
+// use from 2048, the default of OpenSSL, to a few hundred thousands.
+const MaxIterations = 1 << 20
+
+// checkIterations rejects the iteration counts that are not positive or above MaxIterations.
+func checkIterations(iterations int) error {
+	if iterations < 1 || iterations > MaxIterations {
+		return fmt.Errorf("%w: %d, limit %d", ErrTooManyIterations, iterations, MaxIterations)
+	}
+	return nil
+}
+
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// encryptedPrivateKeyInfo is the PKCS#8 encrypted key, RFC 5958.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the parameters of the PBES2 scheme, RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts the DER of an encrypted PKCS#8 key and returns the DER of the key.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted PKCS#8 key: %w", err)
+	}
+	return decrypt(info.Algorithm, info.EncryptedData, passphrase)
+}
+
+// decrypt decrypts the data with the password based encryption algorithm.
+func decrypt(algorithm pkix.AlgorithmIdentifier, data, passphrase []byte) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	switch {
+	case algorithm.Algorithm.Equal(oidPBES2):
+		var err error
+		block, iv, err = pbes2Cipher(algorithm.Parameters.FullBytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	case algorithm.Algorithm.Equal(oidPBEWithSHA3DES):
+		var err error
+		block, iv, err = pkcs12PBECipher(algorithm.Parameters.FullBytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm %v", algorithm.Algorithm)
+	}
+
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted data is not a multiple of the block size")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	return unpad(plain, block.BlockSize())
+}
+
+// pbes2Cipher returns the block cipher and IV of the PBES2 parameters.
+func pbes2Cipher(params, passphrase []byte) (cipher.Block, []byte, error) {
+	var p pbes2Params
+	if _, err := asn1.Unmarshal(params, &p); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBES2 parameters: %w", err)
+	}
+	if !p.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("unsupported key derivation function %v", p.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(p.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBKDF2 parameters: %w", err)
+	}
+
+	if err := checkIterations(kdf.IterationCount); err != nil {
+		return nil, nil, err
+	}
+
+	var prf func() hash.Hash
+	switch algorithm := kdf.PRF.Algorithm; {
+	case len(algorithm) == 0 || algorithm.Equal(oidHMACSHA1):
+		prf = sha1.New
+	case algorithm.Equal(oidHMACSHA256):
+		prf = sha256.New
+	case algorithm.Equal(oidHMACSHA384):
+		prf = sha512.New384
+	case algorithm.Equal(oidHMACSHA512):
+		prf = sha512.New
+	default:
+		return nil, nil, fmt.Errorf("unsupported PBKDF2 function %v", algorithm)
+	}
+
+	var keyLength int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch scheme := p.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLength, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLength, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLength, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLength, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, nil, fmt.Errorf("unsupported cipher %v", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(p.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("invalid IV: %w", err)
+	}
+
+	block, err := newCipher(pbkdf2(prf, passphrase, kdf.Salt, kdf.IterationCount, keyLength))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, nil, errors.New("invalid IV length")
+	}
+	return block, iv, nil
+}
+
+// pbkdf2 derives a key of the length from the password, RFC 8018 section 5.2.
+func pbkdf2(prf func() hash.Hash, password, salt []byte, iterations, length int) []byte {
+	mac := hmac.New(prf, password)
+	var key []byte
+	for block := uint32(1); len(key) < length; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := mac.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
+
+// unpad removes the PKCS#7 padding. Invalid padding is almost always a wrong passphrase.
+func unpad(data []byte, blockSize int) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) {
+		return nil, ErrPassphrase
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, ErrPassphrase
+		}
+	}
+	return data[:len(data)-n], nil
+}
@@ -0,0 +1,130 @@
+package connection
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The vectors were created with OpenSSL 3.0, like:
+// openssl kdf -keylen 40 -kdfopt digest:SHA1 -kdfopt pass:secret -kdfopt hexsalt:0102030405060708 -kdfopt iter:2048 PBKDF2
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		name       string
+		prf        func() hash.Hash
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{name: "SHA1 two blocks", prf: sha1.New, password: "secret", salt: "\x01\x02\x03\x04\x05\x06\x07\x08", iterations: 2048,
+			want: "dfd4e5639b12238af4ff0f17407489cac54ce460b06aacc865ab46b14594e2dc787144c6337c5d9f"},
+		{name: "SHA256", prf: sha256.New, password: "password", salt: "salt", iterations: 4096,
+			want: "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pbkdf2(tt.prf, []byte(tt.password), []byte(tt.salt), tt.iterations, len(tt.want)/2)
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("pbkdf2() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The vectors were created with OpenSSL 3.0, with the passphrase "secret" as a BMPString, like:
+// openssl kdf -keylen 24 -kdfopt digest:SHA1 -kdfopt hexpass:0073006500630072006500740000 -kdfopt hexsalt:0102030405060708 -kdfopt iter:2048 -kdfopt id:1 PKCS12KDF
+func TestPKCS12KDF(t *testing.T) {
+	salt := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	tests := []struct {
+		name string
+		h    func() hash.Hash
+		id   byte
+		want string
+	}{
+		{name: "3DES key", h: sha1.New, id: 1, want: "46b7220edfa6b4bcfe35292f7f4888c97ff731e06932a6a2"},
+		{name: "3DES IV", h: sha1.New, id: 2, want: "38f3a9b371c53b70"},
+		{name: "SHA256 MAC key of two blocks", h: sha256.New, id: 3,
+			want: "f5482fd03f702689b4e96cbbea867c6b16e5bda934929f2ecaf4da9e1c67be8f8dee9cfb585912e7ca73a160b53eaa43363f4f2a503724b121da835f5f4551af"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pkcs12KDF(tt.h, bmpString([]byte("secret")), salt, 2048, tt.id, len(tt.want)/2)
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("pkcs12KDF() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecrypt_TooManyIterations(t *testing.T) {
+	data, err := ioutil.ReadFile(testdata("client-aes.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+	kdf.IterationCount = 1 << 30
+	params.KeyDerivationFunc.Parameters = marshalRaw(t, kdf)
+	info.Algorithm.Parameters = marshalRaw(t, params)
+	crafted, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := decryptPKCS8(crafted, []byte("secret")); !errors.Is(err, ErrTooManyIterations) {
+		t.Errorf("decryptPKCS8() error = %v, want %v", err, ErrTooManyIterations)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("decryptPKCS8() took %v", elapsed)
+	}
+}
+
+func TestParsePKCS12_TooManyIterations(t *testing.T) {
+	der, err := ioutil.ReadFile(testdata("client.p12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle pfx
+	if _, err := asn1.Unmarshal(der, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	bundle.MacData.Iterations = 1 << 30
+	crafted, err := asn1.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parsePKCS12(crafted, []byte("secret")); !errors.Is(err, ErrTooManyIterations) || !strings.Contains(err.Error(), "1073741824") {
+		t.Errorf("parsePKCS12() error = %v, want %v", err, ErrTooManyIterations)
+	}
+}
+
+// marshalRaw returns the DER of v as the raw value of a parameter.
+func marshalRaw(t *testing.T, v interface{}) asn1.RawValue {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{FullBytes: der}
+}
@@ -0,0 +1,145 @@
+package connection
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+// DefaultReloadInterval is how often the files of the credentials are checked for a new pair.
+const DefaultReloadInterval = time.Second * 30
+
+// Reloader keeps the client certificate of the credentials and loads it again when its
+// files change, so rotated certificates are used without a restart. A new pair that
+// can not be loaded is logged and the last good one stays in use.
+type Reloader struct {
+	credentials Credentials
+
+	mu    sync.Mutex
+	cert  *tls.Certificate
+	stamp string
+
+	// stop ends the current Watch, it is nil when the files are not watched.
+	stop chan struct{}
+}
+
+// NewReloader loads the certificate of the credentials.
+func NewReloader(credentials Credentials) (*Reloader, error) {
+	r := &Reloader{credentials: credentials}
+	r.stamp = r.files()
+	cert, err := credentials.Load()
+	if err != nil {
+		return nil, err
+	}
+	r.cert = &cert
+	logger.Info("client certificate", describe(&cert)...)
+	return r, nil
+}
+
+// Certificate returns the certificate in use.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert
+}
+
+// GetClientCertificate is the tls.Config callback, it checks the files before every handshake.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.Reload()
+	return r.Certificate(), nil
+}
+
+// Reload loads the certificate again if its files changed since the last attempt, and
+// returns whether a new certificate is in use.
+func (r *Reloader) Reload() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp := r.files()
+	if stamp == r.stamp {
+		return false
+	}
+	// The attempt is recorded even if it fails, the pair is tried again when a file changes,
+	// like the key written after the certificate.
+	r.stamp = stamp
+
+	cert, err := r.credentials.Load()
+	if err != nil {
+		logger.Warn("keeping client certificate", append(describe(r.cert), logging.KeyError, err)...)
+		return false
+	}
+	if r.cert.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) == 0 {
+		return false
+	}
+	logger.Info("reloaded client certificate", append(describe(&cert), "previous_serial", r.cert.Leaf.SerialNumber)...)
+	r.cert = &cert
+	return true
+}
+
+// Watch checks the files every interval until Stop. It does nothing if the files are
+// already watched.
+func (r *Reloader) Watch(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	r.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Reload()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends Watch, it can be started again.
+func (r *Reloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// files returns the modification time and size of the files of the credentials.
+// Embedded certificates have no files and are never reloaded.
+func (r *Reloader) files() string {
+	var paths []string
+	switch c := r.credentials; {
+	case c.PKCS12File != "":
+		paths = []string{c.PKCS12File}
+	case c.CertPEM != "" || c.KeyPEM != "":
+	default:
+		paths = []string{c.CertFile, c.KeyFile}
+	}
+
+	var stamp strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&stamp, "%s missing;", path)
+			continue
+		}
+		fmt.Fprintf(&stamp, "%s %d %d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp.String()
+}
+
+// describe returns the name, serial and expiration of the certificate for the logs.
+func describe(cert *tls.Certificate) []interface{} {
+	return []interface{}{"subject", cert.Leaf.Subject.CommonName, "serial", cert.Leaf.SerialNumber, "expires", cert.Leaf.NotAfter.Format(time.RFC3339)}
+}
@@ -0,0 +1,200 @@
+package connection
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/pki"
+)
+
+// rotate copies the pair to the files with a later modification time, like a rotation
+// would. An empty file is removed.
+func rotate(t *testing.T, certFile, keyFile, newCert, newKey string, at time.Time) {
+	t.Helper()
+	for _, file := range [][2]string{{newCert, certFile}, {newKey, keyFile}} {
+		if file[0] == "" {
+			os.Remove(file[1])
+			continue
+		}
+		data, err := ioutil.ReadFile(file[0])
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if err := ioutil.WriteFile(file[1], data, 0600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		if err := os.Chtimes(file[1], at, at); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+}
+
+// issueWorkers issues the certificates of the workers and returns their files.
+func issueWorkers(t *testing.T, dir string, names ...string) [][2]string {
+	t.Helper()
+	var pairs [][2]string
+	for _, name := range names {
+		certFile, keyFile, err := pki.IssueWorker(dir, name)
+		if err != nil {
+			t.Fatalf("IssueWorker() error = %v", err)
+		}
+		pairs = append(pairs, [2]string{certFile, keyFile})
+	}
+	return pairs
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	if err := pki.Init(dir, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	pairs := issueWorkers(t, dir, "first", "second", "third")
+	certFile := filepath.Join(t.TempDir(), "client.crt")
+	keyFile := filepath.Join(t.TempDir(), "client.key")
+	now := time.Now()
+	rotate(t, certFile, keyFile, pairs[0][0], pairs[0][1], now)
+
+	r, err := NewReloader(Credentials{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		cert, key  string
+		wantReload bool
+		wantName   string
+	}{
+		{name: "unchanged", wantName: "first"},
+		{name: "rotated", cert: pairs[1][0], key: pairs[1][1], wantReload: true, wantName: "second"},
+		{name: "key of another certificate", cert: pairs[2][0], key: pairs[0][1], wantName: "second"},
+		{name: "missing key", cert: pairs[2][0], key: "", wantName: "second"},
+		{name: "fixed", cert: pairs[2][0], key: pairs[2][1], wantReload: true, wantName: "third"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cert != "" {
+				rotate(t, certFile, keyFile, tt.cert, tt.key, now.Add(time.Second*time.Duration(i)))
+			}
+			if got := r.Reload(); got != tt.wantReload {
+				t.Errorf("Reload() = %v, want %v", got, tt.wantReload)
+			}
+			if got := r.Certificate().Leaf.Subject.CommonName; got != tt.wantName {
+				t.Errorf("Certificate() = %q, want %q", got, tt.wantName)
+			}
+		})
+	}
+}
+
+// mutualTLSListener returns the address of a server of the CA in the directory, which
+// sends the serial of the client certificate of each connection.
+func mutualTLSListener(t *testing.T, dir string) (string, chan *big.Int) {
+	t.Helper()
+	config, err := MutualTLSServerConfig(filepath.Join(dir, pki.CoordinatorCertFile), filepath.Join(dir, pki.CoordinatorKeyFile),
+		filepath.Join(dir, pki.CAFile), filepath.Join(dir, pki.CRLFile))
+	if err != nil {
+		t.Fatalf("MutualTLSServerConfig() error = %v", err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	serials := make(chan *big.Int, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				tlsConn := conn.(*tls.Conn)
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				serials <- tlsConn.ConnectionState().PeerCertificates[0].SerialNumber
+				conn.Read(make([]byte, 1))
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), serials
+}
+
+func TestConnection_ReconnectUsesRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	if err := pki.Init(dir, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	addr, serials := mutualTLSListener(t, dir)
+	pairs := issueWorkers(t, dir, "first", "second")
+	certFile := filepath.Join(t.TempDir(), "client.crt")
+	keyFile := filepath.Join(t.TempDir(), "client.key")
+	now := time.Now()
+	rotate(t, certFile, keyFile, pairs[0][0], pairs[0][1], now)
+
+	conn, err := DialEndpoints(Credentials{CertFile: certFile, KeyFile: keyFile}, []string{addr}, Verification{CAFile: filepath.Join(dir, pki.CAFile)})
+	if err != nil {
+		t.Fatalf("DialEndpoints() error = %v", err)
+	}
+	defer conn.Close()
+	first := conn.Certificate().Leaf.SerialNumber
+	if got := <-serials; got.Cmp(first) != 0 {
+		t.Errorf("server got serial %s, want %s", got, first)
+	}
+
+	rotate(t, certFile, keyFile, pairs[1][0], pairs[1][1], now.Add(time.Second))
+	if err := conn.Reconnecte(); err != nil {
+		t.Fatalf("Reconnecte() error = %v", err)
+	}
+	second := conn.Certificate().Leaf.SerialNumber
+	if got := <-serials; got.Cmp(second) != 0 || second.Cmp(first) == 0 {
+		t.Errorf("server got serial %s after the rotation, want %s", got, second)
+	}
+}
+
+// watching returns whether the reloader checks its files.
+func watching(r *Reloader) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stop != nil
+}
+
+func TestConnection_CloseStopsWatching(t *testing.T) {
+	dir := t.TempDir()
+	if err := pki.Init(dir, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	addr, _ := mutualTLSListener(t, dir)
+	pairs := issueWorkers(t, dir, "first")
+
+	creds := Credentials{CertFile: pairs[0][0], KeyFile: pairs[0][1], ReloadInterval: time.Hour}
+	conn, err := DialEndpoints(creds, []string{addr}, Verification{CAFile: filepath.Join(dir, pki.CAFile)})
+	if err != nil {
+		t.Fatalf("DialEndpoints() error = %v", err)
+	}
+	if !watching(conn.reloader) {
+		t.Errorf("files not watched after DialEndpoints()")
+	}
+	conn.Close()
+	if watching(conn.reloader) {
+		t.Errorf("files still watched after Close()")
+	}
+	if err := conn.Reconnecte(); err != nil {
+		t.Fatalf("Reconnecte() error = %v", err)
+	}
+	if !watching(conn.reloader) {
+		t.Errorf("files not watched after Reconnecte()")
+	}
+	conn.Close()
+	if watching(conn.reloader) {
+		t.Errorf("files still watched after the second Close()")
+	}
+}
@@ -0,0 +1,126 @@
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// LoadCertificate loads the PEM certificate and key pair. Its errors are permanent,
+// retrying does not fix a missing or invalid certificate.
+func LoadCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	return Credentials{CertFile: certFile, KeyFile: keyFile}.Load()
+}
+
+// LoadCertPool loads the PEM CA certificates of the file.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// MutualTLSServerConfig returns the configuration of a server that only accepts clients
+// with a certificate signed by the CA that is not revoked in the CRL file. The CRL file is
+// read in every handshake, so revocations apply to new connections without a restart.
+func MutualTLSServerConfig(certFile, keyFile, caFile, crlFile string) (*tls.Config, error) {
+	cert, err := LoadCertificate(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := LoadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			for _, chain := range verifiedChains {
+				if err := checkRevoked(crlFile, chain); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+// MutualTLSClientConfig returns the configuration of a client that presents its certificate
+// and only trusts servers with a certificate signed by the CA.
+func MutualTLSClientConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := LoadCertificate(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := LoadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ErrRevoked is returned when the peer certificate is in the CRL.
+var ErrRevoked = errors.New("certificate revoked")
+
+// parseCRL parses a CRL in PEM, as written by the pki command, or in DER.
+func parseCRL(data []byte) (*pkix.CertificateList, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		data = block.Bytes
+	}
+	return x509.ParseDERCRL(data)
+}
+
+// checkRevoked fails if the leaf of the chain is in the CRL file. A missing CRL file
+// means nothing is revoked, but a CRL that is not signed by the CA of the chain is rejected.
+func checkRevoked(crlFile string, chain []*x509.Certificate) error {
+	if crlFile == "" || len(chain) < 2 {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(crlFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	crl, err := parseCRL(data)
+	if err != nil {
+		return fmt.Errorf("invalid CRL %s: %w", crlFile, err)
+	}
+	if err := chain[len(chain)-1].CheckCRLSignature(crl); err != nil {
+		return fmt.Errorf("invalid CRL signature %s: %w", crlFile, err)
+	}
+
+	leaf := chain[0]
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			return fmt.Errorf("%w: %s serial %s", ErrRevoked, leaf.Subject.CommonName, leaf.SerialNumber)
+		}
+	}
+	return nil
+}
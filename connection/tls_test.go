@@ -0,0 +1,85 @@
+package connection
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/MihaiLupoiu/interview-exasol/pki"
+)
+
+func TestCheckRevoked(t *testing.T) {
+	dir := t.TempDir()
+	if err := pki.Init(dir, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	revokedFile, _, err := pki.IssueWorker(dir, "revoked")
+	if err != nil {
+		t.Fatalf("IssueWorker() error = %v", err)
+	}
+	validFile, _, err := pki.IssueWorker(dir, "valid")
+	if err != nil {
+		t.Fatalf("IssueWorker() error = %v", err)
+	}
+	if err := pki.Revoke(dir, revokedFile); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	// The same CRL in DER.
+	crlFile := filepath.Join(dir, pki.CRLFile)
+	data, err := ioutil.ReadFile(crlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	derFile := filepath.Join(t.TempDir(), "crl.der")
+	if err := ioutil.WriteFile(derFile, block.Bytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ca := readCert(t, filepath.Join(dir, pki.CAFile))
+	tests := []struct {
+		name    string
+		crlFile string
+		leaf    string
+		wantErr error
+		wantAny bool
+	}{
+		{name: "revoked", crlFile: crlFile, leaf: revokedFile, wantErr: ErrRevoked},
+		{name: "revoked in a DER CRL", crlFile: derFile, leaf: revokedFile, wantErr: ErrRevoked},
+		{name: "not revoked", crlFile: crlFile, leaf: validFile},
+		{name: "missing CRL", crlFile: filepath.Join(dir, "missing.pem"), leaf: revokedFile},
+		{name: "not a CRL", crlFile: validFile, leaf: validFile, wantAny: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRevoked(tt.crlFile, []*x509.Certificate{readCert(t, tt.leaf), ca})
+			switch {
+			case tt.wantAny && err == nil:
+				t.Errorf("checkRevoked() error = nil, want an error")
+			case !tt.wantAny && !errors.Is(err, tt.wantErr):
+				t.Errorf("checkRevoked() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func readCert(t *testing.T, file string) *x509.Certificate {
+	t.Helper()
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s is not PEM", file)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
@@ -0,0 +1,210 @@
+package connection
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+)
+
+var (
+	// ErrPinMismatch is returned when no certificate of the server has a pinned public key.
+	ErrPinMismatch = errors.New("no certificate of the server matches the pinned public keys")
+	// ErrHostKeyMismatch is returned when the server key is not the one recorded in the known hosts file.
+	ErrHostKeyMismatch = errors.New("server key does not match the known hosts file")
+)
+
+// Verification configures how the certificate of the server is verified. By default the
+// chain is verified with the system roots. Pins or a known hosts file replace the chain
+// verification, unless a CA file is also set, then both must pass.
+type Verification struct {
+	// CAFile is a PEM bundle with the roots trusted instead of the system ones.
+	CAFile string
+	// Pins are the SHA-256 of the public keys accepted, in base64 with an optional "sha256/"
+	// prefix, as printed by Fingerprint. They match any certificate of the verified chain
+	// when CAFile is set, and only the certificate of the server otherwise.
+	Pins []string
+	// ServerName is the name expected in the certificate of the server instead of the
+	// host of the endpoint, for endpoints that are IP addresses without IP SANs.
+	ServerName string
+	// KnownHosts is a file where the key of each server is recorded the first time,
+	// and must match afterwards.
+	KnownHosts string
+	// Insecure skips the verification of the server.
+	Insecure bool
+}
+
+// Fingerprint returns the SHA-256 of the public key of the certificate, in the format of the pins.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// TLSConfig returns the configuration of a client with the certificates that verifies
+// the server as configured. Verification errors are permanent, the connection fails closed.
+func (v Verification) TLSConfig(certificates []tls.Certificate) (*tls.Config, error) {
+	config := &tls.Config{
+		Certificates: certificates,
+		ServerName:   v.ServerName,
+		// The chain is verified in VerifyConnection, so it can be replaced by the pins.
+		InsecureSkipVerify: true,
+	}
+	if v.Insecure {
+		logger.Warn("the certificate of the server is not verified")
+		return config, nil
+	}
+
+	var roots *x509.CertPool
+	if v.CAFile != "" {
+		pool, err := LoadCertPool(v.CAFile)
+		if err != nil {
+			return nil, retry.Permanent(err)
+		}
+		roots = pool
+	}
+	pins := make(map[string]bool, len(v.Pins))
+	for _, pin := range v.Pins {
+		pins[strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")] = true
+	}
+	var known *KnownHosts
+	if v.KnownHosts != "" {
+		known = OpenKnownHosts(v.KnownHosts)
+	}
+	verifyChain := v.CAFile != "" || (len(pins) == 0 && known == nil)
+
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if cs.ServerName == "" {
+			// Names that are IP addresses are not sent in the SNI.
+			cs.ServerName = v.ServerName
+		}
+		if err := verify(cs, roots, verifyChain, pins, known); err != nil {
+			return retry.Permanent(err)
+		}
+		return nil
+	}
+	return config, nil
+}
+
+// verify checks the certificates of the server in the connection.
+func verify(cs tls.ConnectionState, roots *x509.CertPool, verifyChain bool, pins map[string]bool, known *KnownHosts) error {
+	certs := cs.PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("server sent no certificate")
+	}
+
+	// Without the verification of the chain nothing proves that the leaf was issued by the
+	// other certificates sent, so only the key of the leaf can match a pin.
+	candidates := certs[:1]
+	if verifyChain {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		chains, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			DNSName:       cs.ServerName,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return err
+		}
+		candidates = nil
+		for _, chain := range chains {
+			candidates = append(candidates, chain...)
+		}
+	}
+
+	if len(pins) > 0 {
+		pinned := false
+		for _, cert := range candidates {
+			if pins[strings.TrimPrefix(Fingerprint(cert), "sha256/")] {
+				pinned = true
+				break
+			}
+		}
+		if !pinned {
+			return fmt.Errorf("%w: server key %s", ErrPinMismatch, Fingerprint(certs[0]))
+		}
+	}
+
+	if known != nil {
+		return known.Check(cs.ServerName, Fingerprint(certs[0]))
+	}
+	return nil
+}
+
+// KnownHosts is a file with a line "host fingerprint" for every server trusted on first use.
+type KnownHosts struct {
+	mu   sync.Mutex
+	path string
+}
+
+// OpenKnownHosts returns the known hosts of the file, which is created on the first use.
+func OpenKnownHosts(path string) *KnownHosts {
+	return &KnownHosts{path: path}
+}
+
+// Check returns nil if the fingerprint is the one recorded for the host. A host that is
+// not in the file is recorded with the fingerprint.
+func (k *KnownHosts) Check(host, fingerprint string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	recorded, err := k.lookup(host)
+	if err != nil {
+		return err
+	}
+	if len(recorded) == 0 {
+		logger.Info("trusting the key of the server on first use", "host", host, "key", fingerprint, "known_hosts", k.path)
+		return k.add(host, fingerprint)
+	}
+	for _, fp := range recorded {
+		if fp == fingerprint {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s presented %s, recorded %s in %s", ErrHostKeyMismatch, host, fingerprint, strings.Join(recorded, ", "), k.path)
+}
+
+// lookup returns the fingerprints recorded for the host.
+func (k *KnownHosts) lookup(host string) ([]string, error) {
+	file, err := os.Open(k.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var fingerprints []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && !strings.HasPrefix(fields[0], "#") && fields[0] == host {
+			fingerprints = append(fingerprints, fields[1])
+		}
+	}
+	return fingerprints, scanner.Err()
+}
+
+// add appends the host and its fingerprint to the file.
+func (k *KnownHosts) add(host, fingerprint string) error {
+	file, err := os.OpenFile(k.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(file, "%s %s\n", host, fingerprint); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
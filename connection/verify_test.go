@@ -0,0 +1,174 @@
+package connection
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/pki"
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+)
+
+// dialVerified connects to the endpoint with the verification and returns the error of the endpoint.
+func dialVerified(t *testing.T, endpoint string, v Verification) error {
+	t.Helper()
+	config, err := v.TLSConfig(nil)
+	if err != nil {
+		t.Fatalf("TLSConfig() error = %v", err)
+	}
+	conn, _, err := NewFailover([]string{endpoint}, config).Dial(context.TODO())
+	if err != nil {
+		var dialErr *DialError
+		if !errors.As(err, &dialErr) || len(dialErr.Errors) != 1 {
+			t.Fatalf("Dial() error = %v, want a DialError of one endpoint", err)
+		}
+		return dialErr.Errors[0].Err
+	}
+	conn.Close()
+	return nil
+}
+
+// keys returns the fingerprints of the server and CA certificates in the directory.
+func keys(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	server, err := LoadCertificate(filepath.Join(dir, pki.CoordinatorCertFile), filepath.Join(dir, pki.CoordinatorKeyFile))
+	if err != nil {
+		t.Fatalf("LoadCertificate() error = %v", err)
+	}
+	ca, err := LoadCertificate(filepath.Join(dir, pki.CAFile), filepath.Join(dir, pki.CAKeyFile))
+	if err != nil {
+		t.Fatalf("LoadCertificate() error = %v", err)
+	}
+	return Fingerprint(server.Leaf), Fingerprint(ca.Leaf)
+}
+
+func TestVerification(t *testing.T) {
+	addr, dir := pkiListener(t, []string{"127.0.0.1"})
+	named, namedDir := pkiListener(t, []string{"exasol.test"})
+	_, otherDir := pkiListener(t, []string{"127.0.0.1"})
+	serverKey, caKey := keys(t, dir)
+	ca := filepath.Join(dir, pki.CAFile)
+
+	tests := []struct {
+		name     string
+		endpoint string
+		v        Verification
+		wantErr  error
+		fail     bool
+	}{
+		{name: "trusted CA", endpoint: addr, v: Verification{CAFile: ca}},
+		{name: "another CA", endpoint: addr, v: Verification{CAFile: filepath.Join(otherDir, pki.CAFile)}, fail: true},
+		{name: "system roots", endpoint: addr, v: Verification{}, fail: true},
+		{name: "insecure", endpoint: addr, v: Verification{Insecure: true}},
+		{name: "name not in the certificate", endpoint: named, v: Verification{CAFile: filepath.Join(namedDir, pki.CAFile)}, fail: true},
+		{name: "server name", endpoint: named, v: Verification{CAFile: filepath.Join(namedDir, pki.CAFile), ServerName: "exasol.test"}},
+		{name: "server key pinned", endpoint: addr, v: Verification{Pins: []string{serverKey}}},
+		{name: "server key pinned without prefix", endpoint: addr, v: Verification{Pins: []string{serverKey[len("sha256/"):]}}},
+		{name: "another key pinned", endpoint: named, v: Verification{Pins: []string{serverKey, caKey}}, wantErr: ErrPinMismatch},
+		{name: "trusted CA and CA key pinned", endpoint: addr, v: Verification{CAFile: ca, Pins: []string{caKey}}},
+		{name: "CA key pinned without the CA", endpoint: addr, v: Verification{Pins: []string{caKey}}, wantErr: ErrPinMismatch},
+		{name: "trusted CA and another key pinned", endpoint: addr, v: Verification{CAFile: ca, Pins: []string{"sha256/AAAA"}}, wantErr: ErrPinMismatch},
+		{name: "another CA and key pinned", endpoint: addr, v: Verification{CAFile: filepath.Join(otherDir, pki.CAFile), Pins: []string{serverKey}}, fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dialVerified(t, tt.endpoint, tt.v)
+			fail := tt.fail || tt.wantErr != nil
+			if (err != nil) != fail || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("Dial() error = %v, want error %v %v", err, fail, tt.wantErr)
+			}
+			if err != nil && retry.Retryable(err) {
+				t.Errorf("Dial() error = %v is retryable, want a permanent error", err)
+			}
+		})
+	}
+}
+
+// forgedListener returns the address of a server that presents a self-signed certificate
+// for 127.0.0.1 followed by the CA certificate of the directory, as a MITM could.
+func forgedListener(t *testing.T, dir string) string {
+	t.Helper()
+	ca, err := LoadCertificate(filepath.Join(dir, pki.CAFile), filepath.Join(dir, pki.CAKeyFile))
+	if err != nil {
+		t.Fatalf("LoadCertificate() error = %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "coordinator"},
+		Issuer:       ca.Leaf.Subject,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	forged := tls.Certificate{Certificate: [][]byte{leaf, ca.Certificate[0]}, PrivateKey: key}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{forged}})
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestVerification_PinnedCAWithForgedLeaf(t *testing.T) {
+	_, dir := pkiListener(t, []string{"127.0.0.1"})
+	_, caKey := keys(t, dir)
+	addr := forgedListener(t, dir)
+
+	if err := dialVerified(t, addr, Verification{Pins: []string{caKey}}); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("Dial() with the CA key pinned error = %v, want %v", err, ErrPinMismatch)
+	}
+	if err := dialVerified(t, addr, Verification{CAFile: filepath.Join(dir, pki.CAFile), Pins: []string{caKey}}); err == nil {
+		t.Errorf("Dial() with the CA trusted and pinned error = nil, want the chain rejected")
+	}
+}
+
+func TestVerification_KnownHosts(t *testing.T) {
+	known := filepath.Join(t.TempDir(), "known_hosts")
+	addr, _ := pkiListener(t, []string{"127.0.0.1"})
+
+	if err := dialVerified(t, addr, Verification{KnownHosts: known}); err != nil {
+		t.Fatalf("first Dial() error = %v", err)
+	}
+	if err := dialVerified(t, addr, Verification{KnownHosts: known}); err != nil {
+		t.Fatalf("second Dial() error = %v", err)
+	}
+
+	// Another server with the same name has another key.
+	changed, _ := pkiListener(t, []string{"127.0.0.1"})
+	err := dialVerified(t, changed, Verification{KnownHosts: known})
+	if !errors.Is(err, ErrHostKeyMismatch) || retry.Retryable(err) {
+		t.Errorf("Dial() error = %v, want a permanent %v", err, ErrHostKeyMismatch)
+	}
+}
@@ -0,0 +1,477 @@
+package coordinator
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/lease"
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+// DefaultRangeSize is the number of nonces handed to a hash worker in each job.
+const DefaultRangeSize = 1 << 28
+
+// DefaultLeaseTTL is how long a hash worker keeps its range without reporting progress.
+const DefaultLeaseTTL = time.Second * 30
+
+// handshakeTimeout is how long a hash worker has to complete the TLS handshake.
+const handshakeTimeout = time.Second * 10
+
+// ErrClosed is returned by Solve when the coordinator is closed during the search.
+var ErrClosed = errors.New("coordinator closed")
+
+// Option configures the coordinator.
+type Option func(*Coordinator)
+
+// WithLeaseTTL sets how long a hash worker keeps its range without reporting progress.
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(c *Coordinator) {
+		c.leaseTTL = ttl
+	}
+}
+
+// WithLedger sets the file where the searched ranges of the challenge are recorded,
+// so a restarted coordinator does not search them again.
+func WithLedger(path string) Option {
+	return func(c *Coordinator) {
+		c.ledgerPath = path
+	}
+}
+
+// WithTLS makes the coordinator accept only hash workers that complete a TLS handshake
+// with the configuration. When it requires client certificates, the name of the hash
+// worker is the common name of its certificate.
+func WithTLS(config *tls.Config) Option {
+	return func(c *Coordinator) {
+		c.tlsConfig = config
+	}
+}
+
+// Coordinator splits the nonce space of a POW challenge into leased ranges and hands
+// them to the remote hash workers connected to it.
+type Coordinator struct {
+	listener   net.Listener
+	rangeSize  uint64
+	leaseTTL   time.Duration
+	ledgerPath string
+	tlsConfig  *tls.Config
+	closed     chan struct{}
+
+	mu        sync.Mutex
+	remotes   map[*remote]struct{}
+	search    *search
+	nextJobID uint64
+}
+
+// search is the POW challenge being solved.
+type search struct {
+	authdata   string
+	difficulty int
+	leases     *lease.Manager
+	found      chan string
+}
+
+// remote is a hash worker connected to the coordinator.
+type remote struct {
+	name     string
+	addr     string
+	conn     net.Conn
+	codec    *Codec
+	jobID    uint64
+	leaseID  uint64
+	searched []solver.Range
+	hashes   uint64
+	hashrate float64
+}
+
+// WorkerStatus is the last state reported by a hash worker.
+type WorkerStatus struct {
+	Name     string
+	Addr     string
+	Busy     bool
+	Hashes   uint64
+	Hashrate float64
+}
+
+// Listen creates a coordinator that accepts hash workers in the address.
+func Listen(addr string, rangeSize uint64, opts ...Option) (*Coordinator, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return New(listener, rangeSize, opts...), nil
+}
+
+// New creates a coordinator that accepts hash workers from the listener.
+func New(listener net.Listener, rangeSize uint64, opts ...Option) *Coordinator {
+	if rangeSize == 0 {
+		rangeSize = DefaultRangeSize
+	}
+	c := &Coordinator{
+		listener:  listener,
+		rangeSize: rangeSize,
+		leaseTTL:  DefaultLeaseTTL,
+		closed:    make(chan struct{}),
+		remotes:   make(map[*remote]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tlsConfig != nil {
+		c.listener = tls.NewListener(listener, c.tlsConfig)
+	}
+	return c
+}
+
+// Addr returns the address where the coordinator is listening.
+func (c *Coordinator) Addr() net.Addr {
+	return c.listener.Addr()
+}
+
+// Serve accepts hash workers until the coordinator is closed.
+func (c *Coordinator) Serve() error {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			select {
+			case <-c.closed:
+				return nil
+			default:
+				return err
+			}
+		}
+		go c.handle(conn)
+	}
+}
+
+// Close stops accepting hash workers and disconnects the connected ones.
+func (c *Coordinator) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.closed:
+		return nil
+	default:
+	}
+	close(c.closed)
+
+	for r := range c.remotes {
+		r.conn.Close()
+	}
+	return c.listener.Close()
+}
+
+// Workers returns the status of the connected hash workers.
+func (c *Coordinator) Workers() []WorkerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	workers := make([]WorkerStatus, 0, len(c.remotes))
+	for r := range c.remotes {
+		workers = append(workers, WorkerStatus{
+			Name:     r.name,
+			Addr:     r.addr,
+			Busy:     r.jobID != 0,
+			Hashes:   r.hashes,
+			Hashrate: r.hashrate,
+		})
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].Addr < workers[j].Addr
+	})
+	return workers
+}
+
+// Hashrate returns the sum of the hashrates reported by the hash workers.
+func (c *Coordinator) Hashrate() float64 {
+	var hashrate float64
+	for _, w := range c.Workers() {
+		hashrate += w.Hashrate
+	}
+	return hashrate
+}
+
+// Solve hands the challenge to the hash workers and returns the first valid suffix.
+// The remaining workers are cancelled before it returns.
+func (c *Coordinator) Solve(ctx context.Context, authdata string, difficulty int) (string, error) {
+	ledger, err := lease.OpenLedger(c.ledgerPath, authdata, difficulty)
+	if err != nil {
+		return "", err
+	}
+	s := &search{
+		authdata:   authdata,
+		difficulty: difficulty,
+		leases:     lease.NewManager(ledger, c.rangeSize, c.leaseTTL),
+		found:      make(chan string, 1),
+	}
+
+	c.mu.Lock()
+	c.search = s
+	c.mu.Unlock()
+	c.assignIdle()
+
+	ticker := time.NewTicker(c.leaseTTL / 4)
+	defer ticker.Stop()
+
+	var suffix string
+	for suffix == "" && err == nil {
+		select {
+		case suffix = <-s.found:
+		case <-ticker.C:
+			c.expire(s)
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-c.closed:
+			err = ErrClosed
+		}
+	}
+
+	c.mu.Lock()
+	c.search = nil
+	cancels := make(map[*remote]Message)
+	for r := range c.remotes {
+		if r.jobID != 0 {
+			cancels[r] = Message{Type: TypeCancel, JobID: r.jobID}
+			s.leases.Release(r.leaseID, r.searched)
+			r.jobID = 0
+		}
+	}
+	c.mu.Unlock()
+
+	for r, msg := range cancels {
+		r.send(msg)
+	}
+
+	searched, duplicates := s.leases.Searched()
+	logger.Info("hash workers searched the nonces", "searched", searched, "duplicates", duplicates)
+	return suffix, err
+}
+
+// expire cancels the jobs of the hash workers whose lease expired and assigns
+// the ranges given back to the idle ones.
+func (c *Coordinator) expire(s *search) {
+	expired, err := s.leases.Expire()
+	if err != nil {
+		logger.Error("failed to save the ledger", logging.KeyError, err)
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	cancels := make(map[*remote]Message)
+	for _, l := range expired {
+		logger.Warn("lease of hash worker expired, range given back", "lease", l.ID, "worker", l.Holder, "start", l.Range.Start, "end", l.Range.End)
+		for r := range c.remotes {
+			if r.jobID != 0 && r.leaseID == l.ID {
+				cancels[r] = Message{Type: TypeCancel, JobID: r.jobID}
+				r.jobID = 0
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for r, msg := range cancels {
+		r.send(msg)
+	}
+	c.assignIdle()
+}
+
+// assignIdle sends a job to every hash worker without one.
+func (c *Coordinator) assignIdle() {
+	c.mu.Lock()
+	jobs := make(map[*remote]Message)
+	for r := range c.remotes {
+		jobs[r] = c.nextJob(r)
+	}
+	c.mu.Unlock()
+
+	for r, msg := range jobs {
+		r.send(msg)
+	}
+}
+
+// nextJob leases the next range of the search to the remote. It returns a message
+// without type if there is nothing to assign. Must be called with the lock held.
+func (c *Coordinator) nextJob(r *remote) Message {
+	s := c.search
+	if s == nil || r.jobID != 0 {
+		return Message{}
+	}
+
+	l, ok, err := s.leases.Acquire(r.name)
+	if err != nil {
+		logger.Error("failed to save the ledger", logging.KeyError, err)
+	}
+	if !ok {
+		return Message{}
+	}
+
+	c.nextJobID++
+	r.jobID = c.nextJobID
+	r.leaseID = l.ID
+	r.searched = nil
+	return Message{
+		Type:       TypeJob,
+		JobID:      r.jobID,
+		Authdata:   s.authdata,
+		Difficulty: s.difficulty,
+		Start:      l.Range.Start,
+		End:        l.Range.End,
+	}
+}
+
+// handle registers the hash worker and processes its messages until it disconnects.
+func (c *Coordinator) handle(conn net.Conn) {
+	defer conn.Close()
+
+	name, err := peerName(conn)
+	if err != nil {
+		logger.Warn("hash worker rejected", "addr", conn.RemoteAddr(), logging.KeyError, err)
+		return
+	}
+
+	codec := NewCodec(conn)
+	hello, err := codec.Receive()
+	if err != nil || hello.Type != TypeHello {
+		logger.Warn("hash worker rejected: expected hello message", "addr", conn.RemoteAddr(), "expected", TypeHello)
+		return
+	}
+	if name == "" {
+		name = hello.Worker
+	}
+
+	r := &remote{
+		name:  name,
+		addr:  conn.RemoteAddr().String(),
+		conn:  conn,
+		codec: codec,
+	}
+
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return
+	default:
+	}
+	c.remotes[r] = struct{}{}
+	job := c.nextJob(r)
+	c.mu.Unlock()
+
+	logger.Info("hash worker connected", "worker", r.name, "addr", r.addr)
+	defer c.unregister(r)
+	r.send(job)
+
+	for {
+		msg, err := codec.Receive()
+		if err != nil {
+			logger.Info("hash worker disconnected", "worker", r.name, logging.KeyError, err)
+			return
+		}
+		for _, reply := range c.process(r, msg) {
+			r.send(reply)
+		}
+	}
+}
+
+// peerName completes the TLS handshake of the connection and returns the common name
+// of the client certificate. It returns an empty name for plain connections.
+func peerName(conn net.Conn) (string, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+	tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer tlsConn.SetDeadline(time.Time{})
+	if err := tlsConn.Handshake(); err != nil {
+		return "", err
+	}
+	if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		return certs[0].Subject.CommonName, nil
+	}
+	return "", nil
+}
+
+// process updates the search with the message of the remote and returns the replies.
+func (c *Coordinator) process(r *remote, msg Message) []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.search
+	switch msg.Type {
+	case TypeProgress:
+		r.hashes += msg.Hashes
+		r.hashrate = msg.Hashrate
+		if s == nil || r.jobID == 0 || msg.JobID != r.jobID {
+			return nil
+		}
+		r.searched = msg.Searched
+		if _, err := s.leases.Heartbeat(r.leaseID, msg.Searched); err != nil {
+			logger.Warn("hash worker lost job", "worker", r.name, "job", r.jobID, logging.KeyError, err)
+			// The progress of an expired lease was recorded, the rest of its range is given back.
+			s.leases.Release(r.leaseID, msg.Searched)
+			cancel := Message{Type: TypeCancel, JobID: r.jobID}
+			r.jobID = 0
+			return []Message{cancel, c.nextJob(r)}
+		}
+		return nil
+	case TypeDone:
+		if s == nil || r.jobID == 0 || msg.JobID != r.jobID {
+			return nil
+		}
+		if err := s.leases.Complete(r.leaseID); err != nil {
+			logger.Info("hash worker completed job", "worker", r.name, "job", r.jobID, logging.KeyError, err)
+		}
+		r.jobID = 0
+	case TypeFound:
+		if s == nil || r.jobID == 0 || msg.JobID != r.jobID {
+			return nil
+		}
+		if solver.CalculateAndCheckHash(s.authdata, msg.Suffix, s.difficulty) == "" {
+			logger.Warn("hash worker sent an invalid suffix", "worker", r.name, "suffix", msg.Suffix)
+			return nil
+		}
+		s.leases.Release(r.leaseID, msg.Searched)
+		r.jobID = 0
+		select {
+		case s.found <- msg.Suffix:
+		default:
+		}
+		return nil
+	default:
+		logger.Warn("hash worker sent unknown message", "worker", r.name, "type", msg.Type)
+	}
+	return []Message{c.nextJob(r)}
+}
+
+// unregister removes the remote and gives back the part of its range it did not search.
+func (c *Coordinator) unregister(r *remote) {
+	c.mu.Lock()
+	delete(c.remotes, r)
+	if r.jobID != 0 && c.search != nil {
+		c.search.leases.Release(r.leaseID, r.searched)
+		r.jobID = 0
+	}
+	c.mu.Unlock()
+
+	c.assignIdle()
+}
+
+// send writes the message to the remote if it has a type.
+func (r *remote) send(msg Message) {
+	if msg.Type == "" {
+		return
+	}
+	if err := r.codec.Send(msg); err != nil {
+		logger.Warn("failed to send to hash worker", "type", msg.Type, "worker", r.name, logging.KeyError, err)
+		r.conn.Close()
+	}
+}
@@ -0,0 +1,160 @@
+package coordinator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+const authdata = "cQokBByiRKwFNFhsXUvtTuEwRPwXdFjBeLjelxqPXoQHhIZaXMucoBSBpKFRkDFR"
+
+func listen(t *testing.T, rangeSize uint64) *Coordinator {
+	t.Helper()
+	c, err := Listen("127.0.0.1:0", rangeSize)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go c.Serve()
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// fakeWorker connects to the coordinator and returns the codec to drive the protocol by hand.
+func fakeWorker(t *testing.T, c *Coordinator, name string) (net.Conn, *Codec) {
+	t.Helper()
+	conn, err := net.Dial("tcp", c.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	codec := NewCodec(conn)
+	if err := codec.Send(Message{Type: TypeHello, Worker: name}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	return conn, codec
+}
+
+func receive(t *testing.T, conn net.Conn, codec *Codec, msgType string) Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	msg, err := codec.Receive()
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if msg.Type != msgType {
+		t.Fatalf("expected %s message; got %+v", msgType, msg)
+	}
+	return msg
+}
+
+// validSuffix returns a suffix that solves the challenge.
+func validSuffix(t *testing.T, difficulty int) string {
+	t.Helper()
+	suffix, err := solver.SearchRange(context.TODO(), authdata, difficulty, solver.Range{Start: 0, End: 1 << 20}, nil)
+	if err != nil {
+		t.Fatalf("SearchRange() error = %v", err)
+	}
+	return suffix
+}
+
+type solved struct {
+	suffix string
+	err    error
+}
+
+func solve(c *Coordinator, ctx context.Context, difficulty int) <-chan solved {
+	done := make(chan solved, 1)
+	go func() {
+		suffix, err := c.Solve(ctx, authdata, difficulty)
+		done <- solved{suffix, err}
+	}()
+	return done
+}
+
+func TestCoordinator_RejectsInvalidSuffix(t *testing.T) {
+	c := listen(t, 10)
+	conn, codec := fakeWorker(t, c, "fake")
+	done := solve(c, context.TODO(), 2)
+
+	job := receive(t, conn, codec, TypeJob)
+	if job.Start != 0 || job.End != 10 || job.Authdata != authdata || job.Difficulty != 2 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	codec.Send(Message{Type: TypeFound, JobID: job.JobID, Suffix: "invalid suffix"})
+	select {
+	case res := <-done:
+		t.Fatalf("Solve() returned with an invalid suffix: %+v", res)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	suffix := validSuffix(t, 2)
+	codec.Send(Message{Type: TypeFound, JobID: job.JobID, Suffix: suffix})
+	res := <-done
+	if res.err != nil || res.suffix != suffix {
+		t.Fatalf("Solve() = %+v, want %q", res, suffix)
+	}
+}
+
+func TestCoordinator_ReassignsLostRange(t *testing.T) {
+	c := listen(t, 10)
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := solve(c, ctx, 2)
+
+	conn1, codec1 := fakeWorker(t, c, "lost")
+	lost := receive(t, conn1, codec1, TypeJob)
+
+	conn2, codec2 := fakeWorker(t, c, "second")
+	second := receive(t, conn2, codec2, TypeJob)
+	if second.Start != lost.End {
+		t.Fatalf("expected the next range; got %+v", second)
+	}
+
+	conn1.Close()
+	for len(c.Workers()) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	codec2.Send(Message{Type: TypeDone, JobID: second.JobID})
+	reassigned := receive(t, conn2, codec2, TypeJob)
+	if reassigned.Start != lost.Start || reassigned.End != lost.End {
+		t.Fatalf("expected the lost range %d-%d; got %+v", lost.Start, lost.End, reassigned)
+	}
+
+	cancel()
+	if res := <-done; res.err != context.Canceled {
+		t.Fatalf("Solve() error = %v, want %v", res.err, context.Canceled)
+	}
+	receive(t, conn2, codec2, TypeCancel)
+}
+
+func TestCoordinator_ExpiredLeaseIsReassigned(t *testing.T) {
+	c, err := Listen("127.0.0.1:0", 10, WithLeaseTTL(time.Millisecond*100))
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go c.Serve()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	solve(c, ctx, 2)
+
+	conn, codec := fakeWorker(t, c, "slow")
+	job := receive(t, conn, codec, TypeJob)
+	codec.Send(Message{Type: TypeProgress, JobID: job.JobID, Searched: []solver.Range{{Start: 0, End: 4}}})
+
+	// The worker stops reporting progress, so its lease expires and only the
+	// part it did not search is handed out again.
+	cancelled := receive(t, conn, codec, TypeCancel)
+	if cancelled.JobID != job.JobID {
+		t.Fatalf("expected cancel of job %d; got %+v", job.JobID, cancelled)
+	}
+	reassigned := receive(t, conn, codec, TypeJob)
+	if reassigned.Start != 4 || reassigned.End != 10 {
+		t.Fatalf("expected the range 4-10; got %+v", reassigned)
+	}
+}
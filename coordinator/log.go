@@ -0,0 +1,11 @@
+package coordinator
+
+import "github.com/MihaiLupoiu/interview-exasol/logging"
+
+// logger is the logger of the package, info and above as text to os.Stderr until SetLogger.
+var logger = logging.NewVar(logging.For("coordinator"))
+
+// SetLogger sets the logger of the package, it is safe to call while the package logs.
+func SetLogger(l logging.Logger) {
+	logger.Set(l)
+}
@@ -0,0 +1,72 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+// Message types exchanged between the coordinator and the remote hash workers.
+// Every message is a JSON object in its own line.
+const (
+	// TypeHello is the first message sent by a hash worker to identify itself.
+	TypeHello = "hello"
+	// TypeJob hands a range of the nonce space to a hash worker.
+	TypeJob = "job"
+	// TypeCancel stops the search of a job.
+	TypeCancel = "cancel"
+	// TypeProgress reports the hashes calculated since the last progress, the hashrate
+	// and the parts of the range of the job searched until now. It renews the lease of the job.
+	TypeProgress = "progress"
+	// TypeFound reports the suffix that solves a job.
+	TypeFound = "found"
+	// TypeDone reports that the range of a job was searched without a solution.
+	TypeDone = "done"
+)
+
+// Message is the only structure of the protocol, the fields used depend on the type.
+type Message struct {
+	Type       string         `json:"type"`
+	Worker     string         `json:"worker,omitempty"`
+	JobID      uint64         `json:"job_id,omitempty"`
+	Authdata   string         `json:"authdata,omitempty"`
+	Difficulty int            `json:"difficulty,omitempty"`
+	Start      uint64         `json:"start,omitempty"`
+	End        uint64         `json:"end,omitempty"`
+	Suffix     string         `json:"suffix,omitempty"`
+	Hashes     uint64         `json:"hashes,omitempty"`
+	Hashrate   float64        `json:"hashrate,omitempty"`
+	Searched   []solver.Range `json:"searched,omitempty"`
+}
+
+// Codec reads and writes messages in a connection. Send is safe to use from several gorutines.
+type Codec struct {
+	mu  sync.Mutex
+	dec *json.Decoder
+	enc *json.Encoder
+}
+
+// NewCodec returns a codec for the connection.
+func NewCodec(rw io.ReadWriter) *Codec {
+	return &Codec{
+		dec: json.NewDecoder(rw),
+		enc: json.NewEncoder(rw),
+	}
+}
+
+// Send writes the message followed by a new line.
+func (c *Codec) Send(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.enc.Encode(msg)
+}
+
+// Receive reads the next message.
+func (c *Codec) Receive() (Message, error) {
+	var msg Message
+	err := c.dec.Decode(&msg)
+	return msg, err
+}
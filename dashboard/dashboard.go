@@ -0,0 +1,293 @@
+// Package dashboard shows the progress of the mining session: a status view redrawn in
+// place when the output is a terminal, and periodic log lines otherwise.
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultRefresh is how often the view is redrawn in a terminal.
+const DefaultRefresh = time.Second
+
+// DefaultInterval is how often the status is logged when the output is not a terminal.
+const DefaultInterval = time.Second * 30
+
+// DefaultDeadline is the time the server gives to answer the POW.
+const DefaultDeadline = time.Hour * 2
+
+// Snapshot is the state of the session read in each refresh.
+type Snapshot struct {
+	State      string
+	Command    string
+	Authdata   string
+	Difficulty int
+	// POWStart is when the search of the current POW started, zero when there is none.
+	POWStart time.Time
+	// Hashes are the hashes attempted for the current POW.
+	Hashes uint64
+	// Workers are the hashes attempted by each worker for the current POW.
+	Workers []uint64
+	// Remote is true when the POW is searched by remote hash workers, whose hashes are not
+	// counted, and RemoteRate is the sum of the hashrates they report.
+	Remote     bool
+	RemoteRate float64
+}
+
+// Stats is the progress of the search derived from two snapshots.
+type Stats struct {
+	Snapshot
+	// Rate is the hashes per second since the last refresh, and Average since the POW started.
+	Rate    float64
+	Average float64
+	// Expected are the hashes expected to find the suffix, 16^difficulty.
+	Expected float64
+	Elapsed  time.Duration
+	// ETA is the expected time to find the suffix at the average rate, negative when unknown.
+	ETA time.Duration
+	// Probability is the probability of finding the suffix before the deadline.
+	Probability float64
+	// WorkerRates are the hashes per second of each worker since the last refresh.
+	WorkerRates []float64
+}
+
+// Option configures the dashboard.
+type Option func(*Dashboard)
+
+// WithInterval sets how often the status is logged when the output is not a terminal.
+func WithInterval(interval time.Duration) Option {
+	return func(d *Dashboard) {
+		d.interval = interval
+	}
+}
+
+// WithDeadline sets the time to answer the POW used for the probability.
+func WithDeadline(deadline time.Duration) Option {
+	return func(d *Dashboard) {
+		d.deadline = deadline
+	}
+}
+
+// WithTerminal overrides the detection of the terminal.
+func WithTerminal(terminal bool) Option {
+	return func(d *Dashboard) {
+		d.terminal = terminal
+	}
+}
+
+// WithReporter sends the stats every interval to report, instead of drawing or logging them.
+func WithReporter(report func(Stats)) Option {
+	return func(d *Dashboard) {
+		d.report = report
+	}
+}
+
+// Dashboard renders the snapshots of the source.
+type Dashboard struct {
+	out      io.Writer
+	source   func() Snapshot
+	terminal bool
+	interval time.Duration
+	deadline time.Duration
+	report   func(Stats)
+
+	prev     Snapshot
+	prevTime time.Time
+	// lines is the height of the last view drawn, erased before the next one.
+	lines int
+}
+
+// New returns a dashboard of the source written to out, as a view redrawn in place when out
+// is a terminal.
+func New(out io.Writer, source func() Snapshot, opts ...Option) *Dashboard {
+	d := &Dashboard{
+		out:      out,
+		source:   source,
+		terminal: IsTerminal(out),
+		interval: DefaultInterval,
+		deadline: DefaultDeadline,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// IsTerminal is true when w is a file open on a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Run refreshes the dashboard until stop is closed.
+func (d *Dashboard) Run(stop <-chan struct{}) {
+	period := d.interval
+	if d.terminal && d.report == nil {
+		period = DefaultRefresh
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			d.Refresh(now)
+		}
+	}
+}
+
+// Refresh reads a snapshot and draws it, logs it when the output is not a terminal, or sends
+// it to the reporter when there is one.
+func (d *Dashboard) Refresh(now time.Time) {
+	stats := d.update(d.source(), now)
+	switch {
+	case d.report != nil:
+		d.report(stats)
+		return
+	case !d.terminal:
+		logStats(stats)
+		return
+	}
+	view := Render(stats)
+	if d.lines > 0 {
+		// Move to the start of the last view and erase it.
+		fmt.Fprintf(d.out, "\033[%dA\033[J", d.lines)
+	}
+	io.WriteString(d.out, view)
+	d.lines = strings.Count(view, "\n")
+}
+
+// update returns the stats of the snapshot, with the rates since the previous one.
+func (d *Dashboard) update(s Snapshot, now time.Time) Stats {
+	stats := Stats{Snapshot: s, Expected: math.Pow(16, float64(s.Difficulty)), ETA: -1}
+	if !s.POWStart.IsZero() {
+		stats.Elapsed = now.Sub(s.POWStart)
+		switch {
+		case s.Remote:
+			stats.Rate, stats.Average = s.RemoteRate, s.RemoteRate
+		case stats.Elapsed > 0:
+			stats.Average = float64(s.Hashes) / stats.Elapsed.Seconds()
+		}
+		stats.ETA, stats.Probability = Estimate(s.Difficulty, stats.Average, stats.Elapsed, d.deadline)
+
+		// The rates are only measured between snapshots of the same POW.
+		if !s.Remote && d.prev.POWStart.Equal(s.POWStart) && now.After(d.prevTime) && s.Hashes >= d.prev.Hashes {
+			seconds := now.Sub(d.prevTime).Seconds()
+			stats.Rate = float64(s.Hashes-d.prev.Hashes) / seconds
+			stats.WorkerRates = make([]float64, len(s.Workers))
+			for i, hashes := range s.Workers {
+				if i < len(d.prev.Workers) && hashes >= d.prev.Workers[i] {
+					stats.WorkerRates[i] = float64(hashes-d.prev.Workers[i]) / seconds
+				}
+			}
+		}
+	}
+	d.prev, d.prevTime = s, now
+	return stats
+}
+
+// Estimate returns the expected time to find the suffix at the rate, negative when the rate
+// is 0, and the probability of finding it before the deadline. Every hash has a chance of
+// 16^-difficulty, independent of the ones already attempted, so the hashes to go are always
+// 16^difficulty and the probability in the time left t is 1 - e^(-rate*t/16^difficulty).
+func Estimate(difficulty int, rate float64, elapsed, deadline time.Duration) (time.Duration, float64) {
+	if rate <= 0 {
+		return -1, 0
+	}
+	expected := math.Pow(16, float64(difficulty))
+	eta := time.Duration(math.MaxInt64)
+	if seconds := expected / rate; seconds < float64(math.MaxInt64)/float64(time.Second) {
+		eta = time.Duration(seconds * float64(time.Second))
+	}
+	left := deadline - elapsed
+	if left <= 0 {
+		return eta, 0
+	}
+	return eta, -math.Expm1(-rate * left.Seconds() / expected)
+}
+
+// Render returns the view of the stats, one line per item.
+func Render(s Stats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session     %s, last command %s\n", orNone(s.State), orNone(s.Command))
+	if s.POWStart.IsZero() {
+		b.WriteString("POW         waiting for the server\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "POW         authdata %s, difficulty %d\n", s.Authdata, s.Difficulty)
+	if s.Remote {
+		fmt.Fprintf(&b, "Hashrate    %s reported by the hash workers\n", FormatRate(s.Rate))
+		fmt.Fprintf(&b, "Attempts    %s expected\n", formatCount(s.Expected))
+	} else {
+		fmt.Fprintf(&b, "Hashrate    %s live, %s average\n", FormatRate(s.Rate), FormatRate(s.Average))
+		fmt.Fprintf(&b, "Attempts    %s of %s expected\n", formatCount(float64(s.Hashes)), formatCount(s.Expected))
+	}
+	fmt.Fprintf(&b, "Elapsed     %s, ETA %s, %.1f%% before the deadline\n", formatDuration(s.Elapsed), formatDuration(s.ETA), s.Probability*100)
+	for i, rate := range s.WorkerRates {
+		fmt.Fprintf(&b, "Worker %-4d %s\n", i, FormatRate(rate))
+	}
+	return b.String()
+}
+
+// logStats writes the stats as one log line.
+func logStats(s Stats) {
+	if s.POWStart.IsZero() {
+		logger.Info("status", "state", s.State, "command", s.Command)
+		return
+	}
+	if s.Remote {
+		logger.Info("status", "state", s.State, "command", s.Command, "authdata", s.Authdata, "difficulty", s.Difficulty,
+			"remote_hashrate", FormatRate(s.Rate), "elapsed", formatDuration(s.Elapsed), "eta", formatDuration(s.ETA),
+			"probability", fmt.Sprintf("%.1f%%", s.Probability*100))
+		return
+	}
+	logger.Info("status", "state", s.State, "command", s.Command, "authdata", s.Authdata, "difficulty", s.Difficulty,
+		"hashrate", FormatRate(s.Rate), "average", FormatRate(s.Average), "attempts", s.Hashes,
+		"elapsed", formatDuration(s.Elapsed), "eta", formatDuration(s.ETA), "probability", fmt.Sprintf("%.1f%%", s.Probability*100))
+}
+
+// FormatRate returns the hashes per second with the unit, like 2.90 MH/s.
+func FormatRate(rate float64) string {
+	return formatCount(rate) + "H/s"
+}
+
+// formatCount returns the number with a SI prefix, like 1.23 G.
+func formatCount(n float64) string {
+	prefixes := []string{"", "k", "M", "G", "T", "P", "E"}
+	i := 0
+	for ; n >= 1000 && i < len(prefixes)-1; i++ {
+		n /= 1000
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f ", n)
+	}
+	return fmt.Sprintf("%.2f %s", n, prefixes[i])
+}
+
+// formatDuration returns the duration as hours, minutes and seconds, unknown when negative.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "unknown"
+	case d == time.Duration(math.MaxInt64) || d > time.Hour*24*365*100:
+		return "more than 100 years"
+	}
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,194 @@
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name            string
+		difficulty      int
+		rate            float64
+		elapsed         time.Duration
+		wantETA         time.Duration
+		wantProbability float64
+	}{
+		{
+			name:            "no rate yet",
+			difficulty:      9,
+			wantETA:         -1,
+			wantProbability: 0,
+		},
+		{
+			name:            "expected hashes in one hour",
+			difficulty:      6,
+			rate:            math.Pow(16, 6) / 3600,
+			wantETA:         time.Hour,
+			wantProbability: 1 - math.Exp(-2),
+		},
+		{
+			name:            "attempts made do not shorten the ETA",
+			difficulty:      6,
+			rate:            math.Pow(16, 6) / 3600,
+			elapsed:         time.Hour,
+			wantETA:         time.Hour,
+			wantProbability: 1 - math.Exp(-1),
+		},
+		{
+			name:            "deadline passed",
+			difficulty:      1,
+			rate:            16,
+			elapsed:         time.Hour * 3,
+			wantETA:         time.Second,
+			wantProbability: 0,
+		},
+		{
+			name:            "ETA out of range",
+			difficulty:      64,
+			rate:            1,
+			wantETA:         time.Duration(math.MaxInt64),
+			wantProbability: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eta, p := Estimate(tt.difficulty, tt.rate, tt.elapsed, DefaultDeadline)
+			if diff := eta - tt.wantETA; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("Estimate() ETA = %v, want %v", eta, tt.wantETA)
+			}
+			if math.Abs(p-tt.wantProbability) > 1e-9 {
+				t.Errorf("Estimate() probability = %v, want %v", p, tt.wantProbability)
+			}
+		})
+	}
+}
+
+func TestDashboard_Refresh(t *testing.T) {
+	start := time.Now()
+	snapshots := []Snapshot{
+		{State: "pow", Command: "POW", Authdata: "abcdef", Difficulty: 6, POWStart: start, Hashes: 1000, Workers: []uint64{600, 400}},
+		{State: "pow", Command: "POW", Authdata: "abcdef", Difficulty: 6, POWStart: start, Hashes: 3000, Workers: []uint64{1600, 1400}},
+	}
+	var out bytes.Buffer
+	d := New(&out, func() Snapshot {
+		s := snapshots[0]
+		snapshots = snapshots[1:]
+		return s
+	}, WithTerminal(true))
+
+	d.Refresh(start.Add(time.Second))
+	first := out.String()
+	if !strings.Contains(first, "0 H/s live, 1.00 kH/s average") || strings.Contains(first, "Worker") {
+		t.Errorf("first view =\n%s\nwant the average and no live rates", first)
+	}
+
+	out.Reset()
+	d.Refresh(start.Add(time.Second * 2))
+	second := out.String()
+	lines := strings.Count(first, "\n")
+	if erase := fmt.Sprintf("\033[%dA\033[J", lines); !strings.HasPrefix(second, erase) {
+		t.Errorf("second view does not erase the %d lines of the first: %q", lines, second)
+	}
+	for _, want := range []string{
+		"Session     pow, last command POW",
+		"POW         authdata abcdef, difficulty 6",
+		"Hashrate    2.00 kH/s live, 1.50 kH/s average",
+		"Attempts    3.00 k of 16.78 M expected",
+		"Elapsed     00:00:02, ETA 03:06:25,",
+		"Worker 0    1.00 kH/s",
+		"Worker 1    1.00 kH/s",
+	} {
+		if !strings.Contains(second, want) {
+			t.Errorf("second view =\n%s\nwant %q", second, want)
+		}
+	}
+}
+
+func TestDashboard_RefreshLogs(t *testing.T) {
+	var log bytes.Buffer
+	root, err := logging.New(logging.Config{Output: &log})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	SetLogger(root.For("dashboard"))
+	defer SetLogger(logging.For("dashboard"))
+
+	var out bytes.Buffer
+	d := New(&out, func() Snapshot {
+		return Snapshot{State: "handshake", Command: "HELO"}
+	}, WithTerminal(false))
+	d.Refresh(time.Now())
+
+	if out.Len() != 0 {
+		t.Errorf("output = %q, want nothing when it is not a terminal", out.String())
+	}
+	if got := log.String(); !strings.Contains(got, "dashboard: status state=handshake command=HELO") {
+		t.Errorf("log = %q, want the status", got)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	if IsTerminal(&bytes.Buffer{}) {
+		t.Errorf("IsTerminal(buffer) = true, want false")
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{-1, "unknown"},
+		{0, "00:00:00"},
+		{time.Hour*26 + time.Minute*3 + time.Millisecond*4500, "26:03:05"},
+		{time.Duration(math.MaxInt64), "more than 100 years"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", int64(tt.d), got, tt.want)
+		}
+	}
+}
+
+func TestDashboard_RefreshReports(t *testing.T) {
+	var out bytes.Buffer
+	var reported []Stats
+	d := New(&out, func() Snapshot {
+		return Snapshot{State: "pow", POWStart: time.Now(), Difficulty: 1, Hashes: 16}
+	}, WithTerminal(true), WithReporter(func(s Stats) { reported = append(reported, s) }))
+	d.Refresh(time.Now().Add(time.Second))
+
+	if out.Len() != 0 || len(reported) != 1 || reported[0].Hashes != 16 {
+		t.Errorf("output = %q, reported %+v; want only the stats reported", out.String(), reported)
+	}
+}
+
+func TestDashboard_RefreshRemote(t *testing.T) {
+	start := time.Now()
+	var out bytes.Buffer
+	d := New(&out, func() Snapshot {
+		return Snapshot{State: "pow", Command: "POW", Authdata: "abcdef", Difficulty: 6, POWStart: start, Remote: true, RemoteRate: 2000}
+	}, WithTerminal(true))
+	d.Refresh(start.Add(time.Second))
+
+	view := out.String()
+	for _, want := range []string{
+		"Hashrate    2.00 kH/s reported by the hash workers",
+		"Attempts    16.78 M expected",
+		"Elapsed     00:00:01, ETA 02:19:49, 57.6% before the deadline",
+	} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view =\n%s\nwant %q", view, want)
+		}
+	}
+	if strings.Contains(view, "average") {
+		t.Errorf("view =\n%s\nwant no local rates", view)
+	}
+}
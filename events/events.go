@@ -0,0 +1,107 @@
+// Package events writes the lifecycle of the miner as a stream of JSON events, one per line,
+// for the programs that drive and monitor it.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Version is the version of the schema of the events, increased when a field changes meaning
+// or is removed.
+const Version = 1
+
+// Types of the events.
+const (
+	// Connected is sent when the connection to the server is established.
+	Connected = "connected"
+	// Handshake is sent when the miner answered the HELO of the server.
+	Handshake = "handshake"
+	// Command is sent for every command received from the server.
+	Command = "command"
+	// FieldSent is sent when the miner answered a command asking for a field of the user.
+	FieldSent = "field_sent"
+	// POWStarted is sent when the search of the suffix starts.
+	POWStarted = "pow_started"
+	// Progress is sent periodically while the suffix is searched.
+	Progress = "progress"
+	// POWSolved is sent when the suffix was sent to the server.
+	POWSolved = "pow_solved"
+	// End is sent when the server accepted the data of the session.
+	End = "end"
+	// Error is sent when the session or the connection failed.
+	Error = "error"
+)
+
+// Event is one step of the lifecycle of the miner. The fields that do not apply to the type
+// are omitted.
+type Event struct {
+	Version  int       `json:"version"`
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Session  string    `json:"session,omitempty"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	// Command is the command received, or answered in field_sent.
+	Command  string        `json:"command,omitempty"`
+	POW      *POW          `json:"pow,omitempty"`
+	Progress *ProgressInfo `json:"progress,omitempty"`
+	// Suffix is the suffix of pow_solved.
+	Suffix string     `json:"suffix,omitempty"`
+	Error  *ErrorInfo `json:"error,omitempty"`
+}
+
+// POW is the challenge of pow_started.
+type POW struct {
+	Authdata   string `json:"authdata"`
+	Difficulty int    `json:"difficulty"`
+}
+
+// ProgressInfo is the progress of the search in progress events.
+type ProgressInfo struct {
+	Hashes uint64 `json:"hashes"`
+	// Hashrate is the hashes per second since the last progress, and Average since the POW started.
+	Hashrate       float64 `json:"hashrate"`
+	Average        float64 `json:"average"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// ETASeconds is the expected time to find the suffix, -1 when unknown.
+	ETASeconds float64 `json:"eta_seconds"`
+	// Probability is the probability of finding the suffix before the deadline.
+	Probability float64 `json:"probability"`
+	// Workers are the hashes per second of each worker since the last progress.
+	Workers []float64 `json:"workers"`
+}
+
+// ErrorInfo is the failure of error events.
+type ErrorInfo struct {
+	Message string `json:"message"`
+	// Retryable is true when the miner starts a new session after the error.
+	Retryable bool `json:"retryable"`
+}
+
+// Stream writes the events to an output, it is safe for concurrent use.
+type Stream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// NewStream returns a stream of events written to w.
+func NewStream(w io.Writer) *Stream {
+	return &Stream{enc: json.NewEncoder(w), now: time.Now}
+}
+
+// Emit writes the event in one line with the version and the time set. It does nothing on a
+// nil *Stream, when the events are not written.
+func (s *Stream) Emit(e Event) error {
+	if s == nil {
+		return nil
+	}
+	e.Version = Version
+	e.Time = s.now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
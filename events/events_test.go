@@ -0,0 +1,41 @@
+package events
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestStream_Emit(t *testing.T) {
+	var b bytes.Buffer
+	s := NewStream(&b)
+	s.now = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+	emitted := []Event{
+		{Type: Connected, Endpoint: "a:3336"},
+		{Type: POWStarted, Session: "s1", POW: &POW{Authdata: "abcdef", Difficulty: 9}},
+		{Type: Progress, Session: "s1", Progress: &ProgressInfo{Hashes: 10, ETASeconds: -1}},
+		{Type: Error, Error: &ErrorInfo{Message: "connection dropped: EOF", Retryable: true}},
+	}
+	for _, e := range emitted {
+		if err := s.Emit(e); err != nil {
+			t.Fatalf("Emit() error = %v", err)
+		}
+	}
+
+	want := `{"version":1,"time":"2021-03-04T05:06:07Z","type":"connected","endpoint":"a:3336"}
+{"version":1,"time":"2021-03-04T05:06:07Z","type":"pow_started","session":"s1","pow":{"authdata":"abcdef","difficulty":9}}
+{"version":1,"time":"2021-03-04T05:06:07Z","type":"progress","session":"s1","progress":{"hashes":10,"hashrate":0,"average":0,"elapsed_seconds":0,"eta_seconds":-1,"probability":0,"workers":null}}
+{"version":1,"time":"2021-03-04T05:06:07Z","type":"error","error":{"message":"connection dropped: EOF","retryable":true}}
+`
+	if b.String() != want {
+		t.Errorf("Emit() wrote\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestStream_Nil(t *testing.T) {
+	var s *Stream
+	if err := s.Emit(Event{Type: End}); err != nil {
+		t.Errorf("Emit() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,278 @@
+package hashworker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/connection"
+	"github.com/MihaiLupoiu/interview-exasol/coordinator"
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+	"github.com/MihaiLupoiu/interview-exasol/worker"
+	"github.com/paulbellamy/ratecounter"
+)
+
+// progressInterval is how often the hash worker reports its hashrate to the coordinator.
+var progressInterval = time.Second
+
+// Config is the configuration of a remote hash worker.
+type Config struct {
+	Coordinator string
+	Name        string
+	Workers     int
+	CA          string
+	Crt         string
+	Key         string
+	Log         logging.Config
+}
+
+// Get will parse the arguments of the hashworker command and return its configuration.
+func Get(args []string) (Config, error) {
+	var config Config
+
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("hashworker", flag.ContinueOnError)
+	flags.StringVar(&config.Coordinator, "coordinator", "localhost:7000", "address of the miner coordinator")
+	flags.StringVar(&config.Name, "name", hostname, "name reported to the coordinator")
+	flags.IntVar(&config.Workers, "workers", runtime.NumCPU(), "number of workers to run in the pool")
+	flags.StringVar(&config.CA, "ca", "", "CA certificate of the coordinator, connects with mutual TLS when set")
+	flags.StringVar(&config.Crt, "crt", "", "certificate issued to the hash worker by the CA")
+	flags.StringVar(&config.Key, "key", "", "key of the hash worker certificate")
+	logLevel := flags.String("log-level", "", "lowest level logged and overrides per package, like info,worker=debug, info by default")
+	flags.StringVar(&config.Log.Format, "log-format", "", "format of the log, text or json, text by default")
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+	if err := config.Log.ParseLevels(*logLevel); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// Run connects to the coordinator and searches the ranges it sends until the
+// context is done or the connection is closed.
+func Run(ctx context.Context, config Config) error {
+	err := logging.Inject(config.Log, map[string]func(logging.Logger){
+		"connection": connection.SetLogger,
+		"hashworker": SetLogger,
+		"worker":     worker.SetLogger,
+	})
+	if err != nil {
+		return err
+	}
+	conn, err := dial(ctx, config)
+	if err != nil {
+		return err
+	}
+	logger.Info("connected to coordinator", logging.KeyEndpoint, config.Coordinator)
+
+	return Serve(ctx, conn, config)
+}
+
+// dial connects to the coordinator, with mutual TLS if the configuration has a CA.
+func dial(ctx context.Context, config Config) (net.Conn, error) {
+	if config.CA == "" {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", config.Coordinator)
+	}
+
+	tlsConfig, err := connection.MutualTLSClientConfig(config.Crt, config.Key, config.CA)
+	if err != nil {
+		return nil, err
+	}
+	dialer := tls.Dialer{Config: tlsConfig}
+	return dialer.DialContext(ctx, "tcp", config.Coordinator)
+}
+
+// job is the range being searched, split in parts that are searched in order from their
+// start, so the counters tell exactly which nonces of each part were searched.
+type job struct {
+	id     uint64
+	parts  []solver.Range
+	counts []uint64
+}
+
+// searched returns the parts of the range searched until now.
+func (j *job) searched() []solver.Range {
+	searched := make([]solver.Range, 0, len(j.parts))
+	for i, part := range j.parts {
+		if count := atomic.LoadUint64(&j.counts[i]); count > 0 {
+			searched = append(searched, solver.Range{Start: part.Start, End: part.Start + count})
+		}
+	}
+	return searched
+}
+
+// result is the end of the search of a job.
+type result struct {
+	jobID  uint64
+	suffix string
+	err    error
+}
+
+// Serve processes the jobs received in the connection. The connection is closed when it returns.
+func Serve(ctx context.Context, conn net.Conn, config Config) error {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	codec := coordinator.NewCodec(conn)
+	if err := codec.Send(coordinator.Message{Type: coordinator.TypeHello, Worker: config.Name}); err != nil {
+		return err
+	}
+
+	incoming := make(chan coordinator.Message)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := codec.Receive()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var hashes uint64
+	counter := ratecounter.NewRateCounter(time.Second)
+	progress := func(n uint64) {
+		atomic.AddUint64(&hashes, n)
+		counter.Incr(int64(n))
+	}
+
+	results := make(chan result, 1)
+	var current *job
+	cancelJob := func() {}
+	defer func() { cancelJob() }()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-incoming:
+			switch msg.Type {
+			case coordinator.TypeJob:
+				cancelJob()
+				jobCtx, cancelSearch := context.WithCancel(ctx)
+				cancelJob = cancelSearch
+				parts := solver.Range{Start: msg.Start, End: msg.End}.Split(config.Workers)
+				current = &job{id: msg.JobID, parts: parts, counts: make([]uint64, len(parts))}
+				go search(jobCtx, msg, current, progress, results)
+			case coordinator.TypeCancel:
+				if current != nil && msg.JobID == current.id {
+					cancelJob()
+					current = nil
+				}
+			default:
+				logger.Warn("unknown message from coordinator", "type", msg.Type)
+			}
+
+		case res := <-results:
+			if current == nil || res.jobID != current.id {
+				continue
+			}
+			msg := coordinator.Message{Type: coordinator.TypeDone, JobID: res.jobID}
+			switch {
+			case res.err == nil:
+				msg.Type = coordinator.TypeFound
+				msg.Suffix = res.suffix
+				msg.Searched = current.searched()
+			case !errors.Is(res.err, solver.ErrNotFound) && !errors.Is(res.err, worker.ErrNoResult):
+				logger.Warn("job failed", "job", res.jobID, logging.KeyError, res.err)
+			}
+			current = nil
+			if err := codec.Send(msg); err != nil {
+				return err
+			}
+
+		case <-ticker.C:
+			msg := coordinator.Message{
+				Type:     coordinator.TypeProgress,
+				Hashes:   atomic.SwapUint64(&hashes, 0),
+				Hashrate: float64(counter.Rate()),
+			}
+			if current != nil {
+				msg.JobID = current.id
+				msg.Searched = current.searched()
+			}
+			if err := codec.Send(msg); err != nil {
+				return err
+			}
+
+		case err := <-readErr:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// rangeArgs are the arguments of the pool jobs that search a part of the range.
+type rangeArgs struct {
+	authdata   string
+	difficulty int
+	nonces     solver.Range
+	progress   func(hashes uint64)
+}
+
+// searchRange is the function passed to the worker pool to search a part of the range.
+func searchRange(ctx context.Context, args interface{}) (interface{}, error) {
+	argVal, ok := args.(rangeArgs)
+	if !ok {
+		return nil, errors.New("wrong argument type")
+	}
+	return solver.SearchRange(ctx, argVal.authdata, argVal.difficulty, argVal.nonces, argVal.progress)
+}
+
+// search gives each part of the range of the job to a worker of a pool and sends the
+// first suffix found, or why there is none, to the results channel.
+func search(ctx context.Context, msg coordinator.Message, current *job, progress func(uint64), results chan<- result) {
+	wp := worker.New(len(current.parts), worker.WithMode(worker.RaceFirst))
+	go wp.Run(ctx)
+
+	jobs := make([]worker.Job, len(current.parts))
+	for i, part := range current.parts {
+		count := &current.counts[i]
+		jobs[i] = worker.Job{
+			ID:     strconv.Itoa(i),
+			ExecFn: searchRange,
+			Args: rangeArgs{
+				authdata:   msg.Authdata,
+				difficulty: msg.Difficulty,
+				nonces:     part,
+				progress: func(n uint64) {
+					atomic.AddUint64(count, n)
+					progress(n)
+				},
+			},
+		}
+	}
+	go wp.SendBulkJobs(jobs)
+
+	res := <-wp.Results()
+	found := result{jobID: msg.JobID, err: res.Err}
+	if res.Err == nil {
+		found.suffix = fmt.Sprint(res.Value)
+	}
+
+	select {
+	case results <- found:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,160 @@
+package hashworker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/connection"
+	"github.com/MihaiLupoiu/interview-exasol/coordinator"
+	"github.com/MihaiLupoiu/interview-exasol/lease"
+	"github.com/MihaiLupoiu/interview-exasol/pki"
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+func TestHashWorkers_SolveOnLoopback(t *testing.T) {
+	progressInterval = time.Millisecond * 10
+
+	ledger := filepath.Join(t.TempDir(), "ledger.json")
+	c, err := coordinator.Listen("127.0.0.1:0", 1<<12, coordinator.WithLedger(ledger))
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go c.Serve()
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*30)
+	defer cancel()
+
+	const workers = 3
+	stopped := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		config := Config{Coordinator: c.Addr().String(), Name: fmt.Sprintf("worker-%d", i), Workers: 2}
+		go func() { stopped <- Run(ctx, config) }()
+	}
+	for len(c.Workers()) != workers {
+		time.Sleep(time.Millisecond)
+	}
+
+	authdata := "cQokBByiRKwFNFhsXUvtTuEwRPwXdFjBeLjelxqPXoQHhIZaXMucoBSBpKFRkDFR"
+	suffix, err := c.Solve(ctx, authdata, 4)
+	if err != nil {
+		t.Fatalf("Solve() error = %v", err)
+	}
+	if solver.CalculateAndCheckHash(authdata, suffix, 4) == "" {
+		t.Fatalf("Solve() = %q does not meet the difficulty", suffix)
+	}
+
+	time.Sleep(progressInterval * 5)
+	var hashes uint64
+	for _, w := range c.Workers() {
+		if w.Busy {
+			t.Errorf("worker %s still busy after the challenge was solved", w.Name)
+		}
+		hashes += w.Hashes
+	}
+	if hashes == 0 {
+		t.Errorf("hash workers did not report progress")
+	}
+
+	recorded, err := lease.OpenLedger(ledger, authdata, 4)
+	if err != nil {
+		t.Fatalf("OpenLedger() error = %v", err)
+	}
+	if len(recorded.Covered()) == 0 || recorded.Duplicates != 0 {
+		t.Errorf("unexpected ledger coverage %v with %d duplicates", recorded.Covered(), recorded.Duplicates)
+	}
+
+	c.Close()
+	for i := 0; i < workers; i++ {
+		if err := <-stopped; err == nil {
+			t.Errorf("Run() returned without error after the coordinator closed")
+		}
+	}
+}
+
+func TestHashWorkers_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	if err := pki.Init(dir, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	other := t.TempDir()
+	if err := pki.Init(other, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	tlsConfig, err := connection.MutualTLSServerConfig(
+		filepath.Join(dir, pki.CoordinatorCertFile),
+		filepath.Join(dir, pki.CoordinatorKeyFile),
+		filepath.Join(dir, pki.CAFile),
+		filepath.Join(dir, pki.CRLFile))
+	if err != nil {
+		t.Fatalf("MutualTLSServerConfig() error = %v", err)
+	}
+	c, err := coordinator.Listen("127.0.0.1:0", 1<<12, coordinator.WithTLS(tlsConfig))
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go c.Serve()
+	defer c.Close()
+
+	revoked, _, _ := pki.IssueWorker(dir, "revoked")
+	if err := pki.Revoke(dir, revoked); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		worker   string
+		accepted bool
+	}{
+		{name: "signed by the CA", dir: dir, worker: "trusted", accepted: true},
+		{name: "signed by another CA", dir: other, worker: "stranger"},
+		{name: "revoked", dir: dir, worker: "revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile, keyFile := filepath.Join(tt.dir, pki.WorkersDir, tt.worker+".crt"), filepath.Join(tt.dir, pki.WorkersDir, tt.worker+".key")
+			if tt.worker != "revoked" {
+				if _, _, err := pki.IssueWorker(tt.dir, tt.worker); err != nil {
+					t.Fatalf("IssueWorker() error = %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+			defer cancel()
+			config := Config{
+				Coordinator: c.Addr().String(),
+				Name:        "reported-name",
+				Workers:     1,
+				CA:          filepath.Join(dir, pki.CAFile),
+				Crt:         certFile,
+				Key:         keyFile,
+			}
+			stopped := make(chan error, 1)
+			go func() { stopped <- Run(ctx, config) }()
+
+			if !tt.accepted {
+				if err := <-stopped; err == nil || ctx.Err() != nil {
+					t.Errorf("Run() error = %v, want the coordinator to refuse the hash worker", err)
+				}
+				return
+			}
+
+			for len(c.Workers()) != 1 {
+				time.Sleep(time.Millisecond)
+			}
+			if name := c.Workers()[0].Name; name != tt.worker {
+				t.Errorf("worker name = %q, want the certificate name %q", name, tt.worker)
+			}
+			cancel()
+			<-stopped
+			for len(c.Workers()) != 0 {
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package lease
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+// Lease is a range of the nonce space handed to a holder until it expires.
+type Lease struct {
+	ID       uint64       `json:"id"`
+	Holder   string       `json:"holder"`
+	Range    solver.Range `json:"range"`
+	Searched Ranges       `json:"searched"`
+	Expires  time.Time    `json:"expires"`
+}
+
+// Ledger records which parts of the nonce space of a challenge were searched, leased
+// or given back. It is saved in a JSON file after every change when it has a path, the
+// progress of the heartbeats at most every SaveInterval.
+type Ledger struct {
+	path string
+
+	Authdata   string  `json:"authdata"`
+	Difficulty int     `json:"difficulty"`
+	Next       uint64  `json:"next"`
+	Searched   Ranges  `json:"searched"`
+	Free       Ranges  `json:"free"`
+	Leases     []Lease `json:"leases"`
+	Duplicates uint64  `json:"duplicates"`
+}
+
+// OpenLedger loads the ledger of the challenge from the file. A new ledger is returned
+// if the file does not exist or belongs to another challenge. The leases recorded in
+// the file are given back, because their holders are not connected anymore.
+// An empty path keeps the ledger only in memory.
+func OpenLedger(path, authdata string, difficulty int) (*Ledger, error) {
+	l := &Ledger{path: path, Authdata: authdata, Difficulty: difficulty}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, l.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved Ledger
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	if saved.Authdata != authdata || saved.Difficulty != difficulty {
+		return l, l.save()
+	}
+
+	saved.path = path
+	for _, lease := range saved.Leases {
+		saved.giveBack(lease)
+	}
+	saved.Leases = nil
+	return &saved, saved.save()
+}
+
+// Covered returns the searched ranges of the nonce space.
+func (l *Ledger) Covered() []solver.Range {
+	return append([]solver.Range(nil), l.Searched...)
+}
+
+// giveBack marks the parts of the range of the lease that were not searched as free.
+func (l *Ledger) giveBack(lease Lease) {
+	for _, gap := range l.Searched.Missing(lease.Range) {
+		l.Free.Add(gap)
+	}
+}
+
+// save writes the ledger in a temporary file and renames it, so the file is never half written.
+func (l *Ledger) save() error {
+	if l.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
@@ -0,0 +1,80 @@
+package lease
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+func TestLedger_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json")
+
+	m, c := newTestManager(t, path)
+	m.ttl = SaveInterval * 2
+	done := acquire(t, m, "a")
+	if err := m.Complete(done.ID); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	running := acquire(t, m, "b")
+	if _, err := m.Heartbeat(running.ID, []solver.Range{{Start: 100, End: 120}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	// The heartbeats right after a save are not written.
+	reopened, err := OpenLedger(path, "authdata", 6)
+	if err != nil {
+		t.Fatalf("OpenLedger() error = %v", err)
+	}
+	if !reflect.DeepEqual(reopened.Covered(), []solver.Range{{Start: 0, End: 100}}) {
+		t.Fatalf("Covered() = %v after a heartbeat right after a save", reopened.Covered())
+	}
+
+	c.now = c.now.Add(SaveInterval)
+	if _, err := m.Heartbeat(running.ID, []solver.Range{{Start: 100, End: 150}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	// A new coordinator gives back the leases of the old one.
+	reopened, err = OpenLedger(path, "authdata", 6)
+	if err != nil {
+		t.Fatalf("OpenLedger() error = %v", err)
+	}
+	if !reflect.DeepEqual(reopened.Covered(), []solver.Range{{Start: 0, End: 150}}) {
+		t.Fatalf("Covered() = %v", reopened.Covered())
+	}
+	if len(reopened.Leases) != 0 || !reflect.DeepEqual([]solver.Range(reopened.Free), []solver.Range{{Start: 150, End: 200}}) {
+		t.Fatalf("unexpected leases %v and free ranges %v", reopened.Leases, reopened.Free)
+	}
+	if reopened.Next != 200 {
+		t.Fatalf("Next = %d; want 200", reopened.Next)
+	}
+
+	// Another challenge starts from scratch.
+	other, err := OpenLedger(path, "other", 6)
+	if err != nil {
+		t.Fatalf("OpenLedger() error = %v", err)
+	}
+	if len(other.Covered()) != 0 || other.Next != 0 {
+		t.Fatalf("ledger of another challenge not empty: %+v", other)
+	}
+}
+
+func TestRanges_Add(t *testing.T) {
+	var set Ranges
+	set.Add(solver.Range{Start: 10, End: 20})
+	set.Add(solver.Range{Start: 30, End: 40})
+	if overlap := set.Add(solver.Range{Start: 15, End: 35}); overlap != 10 {
+		t.Fatalf("Add() overlap = %d; want 10", overlap)
+	}
+	set.Add(solver.Range{Start: 40, End: 45})
+	if !reflect.DeepEqual([]solver.Range(set), []solver.Range{{Start: 10, End: 45}}) {
+		t.Fatalf("Ranges = %v", set)
+	}
+
+	gaps := set.Missing(solver.Range{Start: 0, End: 50})
+	if !reflect.DeepEqual(gaps, []solver.Range{{Start: 0, End: 10}, {Start: 45, End: 50}}) {
+		t.Fatalf("Missing() = %v", gaps)
+	}
+}
@@ -0,0 +1,219 @@
+package lease
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+var (
+	// ErrUnknownLease is returned for a lease that was completed, released or never existed.
+	ErrUnknownLease = errors.New("unknown lease")
+	// ErrExpired is returned when the holder reports progress after its lease expired.
+	ErrExpired = errors.New("lease expired")
+)
+
+// SaveInterval is the least time between the saves of the ledger after heartbeats, the
+// progress reported since the last save is searched again if the process stops.
+const SaveInterval = time.Second * 5
+
+// Manager hands out leases of the nonce space of a challenge and keeps the ledger up to date.
+type Manager struct {
+	mu        sync.Mutex
+	ledger    *Ledger
+	rangeSize uint64
+	ttl       time.Duration
+	nextID    uint64
+	now       func() time.Time
+	// saved is when the ledger was last saved.
+	saved time.Time
+}
+
+// NewManager returns a manager that hands out leases of rangeSize nonces valid for ttl.
+func NewManager(ledger *Ledger, rangeSize uint64, ttl time.Duration) *Manager {
+	return &Manager{
+		ledger:    ledger,
+		rangeSize: rangeSize,
+		ttl:       ttl,
+		now:       time.Now,
+	}
+}
+
+// Acquire leases the next part of the nonce space to the holder. The ranges given back
+// by expired or released leases are leased first. It returns false when the whole
+// nonce space was handed out.
+func (m *Manager) Acquire(holder string) (Lease, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := m.ledger
+	var r solver.Range
+	switch {
+	case len(l.Free) > 0:
+		r = l.Free[0]
+		if r.Size() > m.rangeSize {
+			r.End = r.Start + m.rangeSize
+		}
+		l.Free[0].Start = r.End
+		if l.Free[0].Size() == 0 {
+			l.Free = l.Free[1:]
+		}
+	case l.Next == ^uint64(0):
+		return Lease{}, false, nil
+	default:
+		r = solver.Range{Start: l.Next, End: l.Next + m.rangeSize}
+		if r.End < r.Start {
+			r.End = ^uint64(0)
+		}
+		l.Next = r.End
+	}
+
+	m.nextID++
+	lease := Lease{
+		ID:      m.nextID,
+		Holder:  holder,
+		Range:   r,
+		Expires: m.now().Add(m.ttl),
+	}
+	l.Leases = append(l.Leases, lease)
+	return lease, true, m.save()
+}
+
+// Heartbeat records the ranges searched by the holder of the lease and renews it.
+// The progress of an expired lease is still recorded while its range was not given back,
+// but the lease is not renewed and ErrExpired is returned. The ledger is saved at most
+// every SaveInterval.
+func (m *Manager) Heartbeat(id uint64, searched []solver.Range) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(id)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	lease := &m.ledger.Leases[i]
+	m.record(lease, searched)
+	if !m.now().Before(lease.Expires) {
+		return *lease, ErrExpired
+	}
+	lease.Expires = m.now().Add(m.ttl)
+	if m.now().Sub(m.saved) < SaveInterval {
+		return *lease, nil
+	}
+	return *lease, m.save()
+}
+
+// Complete records that the whole range of the lease was searched and ends it.
+// An expired lease can still be completed while its range was not given back.
+func (m *Manager) Complete(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(id)
+	if err != nil {
+		return err
+	}
+
+	lease := &m.ledger.Leases[i]
+	m.record(lease, []solver.Range{lease.Range})
+	m.remove(i)
+	return m.save()
+}
+
+// Release records the ranges searched by the holder of the lease, ends it and gives
+// back the rest of the range.
+func (m *Manager) Release(id uint64, searched []solver.Range) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(id)
+	if err != nil {
+		return err
+	}
+
+	lease := &m.ledger.Leases[i]
+	m.record(lease, searched)
+	m.ledger.giveBack(*lease)
+	m.remove(i)
+	return m.save()
+}
+
+// Expire ends the expired leases, gives back the parts of their ranges that were not
+// searched and returns them.
+func (m *Manager) Expire() ([]Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var expired []Lease
+	for i := 0; i < len(m.ledger.Leases); {
+		lease := m.ledger.Leases[i]
+		if now.Before(lease.Expires) {
+			i++
+			continue
+		}
+		expired = append(expired, lease)
+		m.ledger.giveBack(lease)
+		m.remove(i)
+	}
+
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	return expired, m.save()
+}
+
+// Searched returns the number of nonces searched and how many of them were searched more than once.
+func (m *Manager) Searched() (searched, duplicates uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ledger.Searched.Size(), m.ledger.Duplicates
+}
+
+// find returns the position of the lease. Expired leases are found until their range is
+// given back. Must be called with the lock held.
+func (m *Manager) find(id uint64) (int, error) {
+	for i, lease := range m.ledger.Leases {
+		if lease.ID == id {
+			return i, nil
+		}
+	}
+	return 0, ErrUnknownLease
+}
+
+// save writes the ledger and records when. Must be called with the lock held.
+func (m *Manager) save() error {
+	m.saved = m.now()
+	return m.ledger.save()
+}
+
+// record adds the searched ranges, limited to the range of the lease, to the ledger.
+// Holders report all they searched in every heartbeat, so only the parts new for the
+// lease are checked for duplicates. Must be called with the lock held.
+func (m *Manager) record(lease *Lease, searched []solver.Range) {
+	for _, r := range searched {
+		if r.Start < lease.Range.Start {
+			r.Start = lease.Range.Start
+		}
+		if r.End > lease.Range.End {
+			r.End = lease.Range.End
+		}
+		if r.Start >= r.End {
+			continue
+		}
+		for _, gap := range lease.Searched.Missing(r) {
+			lease.Searched.Add(gap)
+			m.ledger.Duplicates += m.ledger.Searched.Add(gap)
+		}
+	}
+}
+
+// remove deletes the lease from the ledger. Must be called with the lock held.
+func (m *Manager) remove(i int) {
+	leases := m.ledger.Leases
+	m.ledger.Leases = append(leases[:i], leases[i+1:]...)
+}
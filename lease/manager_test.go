@@ -0,0 +1,162 @@
+package lease
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+// clock is a fake time source for the manager.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestManager(t *testing.T, path string) (*Manager, *clock) {
+	t.Helper()
+	ledger, err := OpenLedger(path, "authdata", 6)
+	if err != nil {
+		t.Fatalf("OpenLedger() error = %v", err)
+	}
+	c := &clock{now: time.Unix(0, 0)}
+	m := NewManager(ledger, 100, time.Second)
+	m.now = c.Now
+	return m, c
+}
+
+func acquire(t *testing.T, m *Manager, holder string) Lease {
+	t.Helper()
+	l, ok, err := m.Acquire(holder)
+	if err != nil || !ok {
+		t.Fatalf("Acquire() = %v, %v", ok, err)
+	}
+	return l
+}
+
+func TestManager_AcquireConsecutiveRanges(t *testing.T) {
+	m, _ := newTestManager(t, "")
+
+	first := acquire(t, m, "a")
+	second := acquire(t, m, "b")
+	if first.Range != (solver.Range{Start: 0, End: 100}) || second.Range != (solver.Range{Start: 100, End: 200}) {
+		t.Fatalf("unexpected ranges %v and %v", first.Range, second.Range)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("leases with the same ID %d", first.ID)
+	}
+}
+
+func TestManager_HeartbeatIsCumulative(t *testing.T) {
+	m, c := newTestManager(t, "")
+	l := acquire(t, m, "a")
+
+	c.now = c.now.Add(time.Millisecond * 900)
+	renewed, err := m.Heartbeat(l.ID, []solver.Range{{Start: 0, End: 10}, {Start: 50, End: 60}})
+	if err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+	if !renewed.Expires.Equal(c.now.Add(time.Second)) {
+		t.Fatalf("lease not renewed: %v", renewed.Expires)
+	}
+
+	c.now = c.now.Add(time.Millisecond * 900)
+	if _, err := m.Heartbeat(l.ID, []solver.Range{{Start: 0, End: 20}, {Start: 50, End: 70}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	searched, duplicates := m.Searched()
+	if searched != 40 || duplicates != 0 {
+		t.Fatalf("Searched() = %d, %d; want 40, 0", searched, duplicates)
+	}
+}
+
+func TestManager_ExpiredRangeIsGivenBack(t *testing.T) {
+	m, c := newTestManager(t, "")
+	l := acquire(t, m, "a")
+	if _, err := m.Heartbeat(l.ID, []solver.Range{{Start: 0, End: 30}, {Start: 50, End: 60}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	c.now = c.now.Add(time.Second)
+	if _, err := m.Heartbeat(l.ID, nil); err != ErrExpired {
+		t.Fatalf("Heartbeat() error = %v, want %v", err, ErrExpired)
+	}
+	expired, err := m.Expire()
+	if err != nil || len(expired) != 1 || expired[0].ID != l.ID {
+		t.Fatalf("Expire() = %v, %v", expired, err)
+	}
+	if _, err := m.Heartbeat(l.ID, nil); err != ErrUnknownLease {
+		t.Fatalf("Heartbeat() error = %v, want %v", err, ErrUnknownLease)
+	}
+
+	// The gaps are leased before new ranges, so nothing is searched twice or skipped.
+	var ranges []solver.Range
+	for i := 0; i < 3; i++ {
+		next := acquire(t, m, "b")
+		ranges = append(ranges, next.Range)
+		if err := m.Complete(next.ID); err != nil {
+			t.Fatalf("Complete() error = %v", err)
+		}
+	}
+	want := []solver.Range{{Start: 30, End: 50}, {Start: 60, End: 100}, {Start: 100, End: 200}}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Fatalf("leased ranges %v; want %v", ranges, want)
+	}
+
+	searched, duplicates := m.Searched()
+	if searched != 200 || duplicates != 0 {
+		t.Fatalf("Searched() = %d, %d; want 200, 0", searched, duplicates)
+	}
+	if covered := m.ledger.Covered(); !reflect.DeepEqual(covered, []solver.Range{{Start: 0, End: 200}}) {
+		t.Fatalf("Covered() = %v", covered)
+	}
+}
+
+func TestManager_LateHeartbeatIsRecorded(t *testing.T) {
+	m, c := newTestManager(t, "")
+	l := acquire(t, m, "a")
+
+	c.now = c.now.Add(time.Second)
+	expired, err := m.Heartbeat(l.ID, []solver.Range{{Start: 0, End: 40}})
+	if err != ErrExpired {
+		t.Fatalf("Heartbeat() error = %v, want %v", err, ErrExpired)
+	}
+	if expired.Expires.After(c.now) {
+		t.Fatalf("expired lease renewed until %v", expired.Expires)
+	}
+	if err := m.Release(l.ID, []solver.Range{{Start: 0, End: 40}}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	// The progress of the late heartbeat is not searched again.
+	if next := acquire(t, m, "b"); next.Range != (solver.Range{Start: 40, End: 100}) {
+		t.Fatalf("leased %v after the late heartbeat; want the range not searched", next.Range)
+	}
+	if searched, duplicates := m.Searched(); searched != 40 || duplicates != 0 {
+		t.Fatalf("Searched() = %d, %d; want 40, 0", searched, duplicates)
+	}
+}
+
+func TestManager_ReleaseAndDuplicates(t *testing.T) {
+	m, _ := newTestManager(t, "")
+	l := acquire(t, m, "a")
+	if err := m.Release(l.ID, []solver.Range{{Start: 0, End: 40}}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	next := acquire(t, m, "b")
+	if next.Range != (solver.Range{Start: 40, End: 100}) {
+		t.Fatalf("expected the released gap; got %v", next.Range)
+	}
+
+	// A holder reporting nonces searched by others is counted as duplicate work.
+	if _, err := m.Heartbeat(next.ID, []solver.Range{{Start: 30, End: 50}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+	if searched, duplicates := m.Searched(); searched != 50 || duplicates != 0 {
+		t.Fatalf("Searched() = %d, %d; want 50, 0 because the report is limited to the lease", searched, duplicates)
+	}
+}
@@ -0,0 +1,84 @@
+package lease
+
+import (
+	"sort"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+// Ranges is a sorted list of ranges that do not overlap or touch each other.
+type Ranges []solver.Range
+
+// Add merges the range into the set and returns how many of its nonces were already in it.
+func (s *Ranges) Add(r solver.Range) uint64 {
+	if r.Size() == 0 {
+		return 0
+	}
+	overlap := s.Overlap(r)
+
+	set := *s
+	i := sort.Search(len(set), func(i int) bool { return set[i].End >= r.Start })
+	j := i
+	for j < len(set) && set[j].Start <= r.End {
+		if set[j].Start < r.Start {
+			r.Start = set[j].Start
+		}
+		if set[j].End > r.End {
+			r.End = set[j].End
+		}
+		j++
+	}
+
+	merged := make(Ranges, 0, len(set)-(j-i)+1)
+	merged = append(merged, set[:i]...)
+	merged = append(merged, r)
+	merged = append(merged, set[j:]...)
+	*s = merged
+	return overlap
+}
+
+// Overlap returns how many nonces of the range are in the set.
+func (s Ranges) Overlap(r solver.Range) uint64 {
+	var overlap uint64
+	for _, c := range s {
+		start, end := c.Start, c.End
+		if start < r.Start {
+			start = r.Start
+		}
+		if end > r.End {
+			end = r.End
+		}
+		if start < end {
+			overlap += end - start
+		}
+	}
+	return overlap
+}
+
+// Missing returns the parts of the range that are not in the set.
+func (s Ranges) Missing(r solver.Range) []solver.Range {
+	var gaps []solver.Range
+	next := r.Start
+	for _, c := range s {
+		if c.End <= next || c.Start >= r.End {
+			continue
+		}
+		if c.Start > next {
+			gaps = append(gaps, solver.Range{Start: next, End: c.Start})
+		}
+		next = c.End
+	}
+	if next < r.End {
+		gaps = append(gaps, solver.Range{Start: next, End: r.End})
+	}
+	return gaps
+}
+
+// Size returns the number of nonces in the set.
+func (s Ranges) Size() uint64 {
+	var size uint64
+	for _, r := range s {
+		size += r.Size()
+	}
+	return size
+}
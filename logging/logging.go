@@ -0,0 +1,299 @@
+// Package logging is the leveled, structured logger of the packages of the miner. Each
+// package logs through a Logger named after it, with a level that can be overridden per package.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a record.
+type Level int
+
+// Levels of the records, from the least to the most severe. The zero value is LevelInfo.
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{LevelDebug: "DEBUG", LevelInfo: "INFO", LevelWarn: "WARN", LevelError: "ERROR"}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Formats of the records.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Keys of the fields shared by the records of every package.
+const (
+	KeySession  = "session"
+	KeyCommand  = "command"
+	KeyEndpoint = "endpoint"
+	KeyError    = "error"
+)
+
+var (
+	// ErrUnknownLevel is returned for a level that is not debug, info, warn or error.
+	ErrUnknownLevel = errors.New("unknown log level, use debug, info, warn or error")
+	// ErrUnknownFormat is returned for a format that is not text or json.
+	ErrUnknownFormat = errors.New("unknown log format, use text or json")
+)
+
+// Logger writes leveled records made of a message and key value pairs.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	// With returns a logger that adds the key value pairs to every record.
+	With(keyvals ...interface{}) Logger
+}
+
+// Config is the configuration of the loggers of all the packages.
+type Config struct {
+	// Level is the lowest level written, LevelInfo by default.
+	Level Level
+	// Levels overrides Level for the packages by their name.
+	Levels map[string]Level
+	// Format is text or json, text by default.
+	Format string
+	// Output is where the records are written, os.Stderr by default.
+	Output io.Writer
+	// Redact, when set, rewrites the message and the values of the fields of every record,
+	// to hide personal data. Only the text of strings, errors and fmt.Stringer values is
+	// redacted, the other values are written as they are.
+	Redact func(string) string
+}
+
+// ParseLevel returns the level by its name.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return LevelWarn, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownLevel, name)
+}
+
+// ParseLevels parses a comma separated list of levels, like info,connection=debug,worker=warn,
+// into the level of the config and the overrides of the packages. Empty items are ignored.
+func (c *Config) ParseLevels(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pkg, name := "", item
+		if i := strings.Index(item, "="); i >= 0 {
+			pkg, name = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return err
+		}
+		if pkg == "" {
+			c.Level = level
+			continue
+		}
+		if c.Levels == nil {
+			c.Levels = make(map[string]Level)
+		}
+		c.Levels[pkg] = level
+	}
+	return nil
+}
+
+// Root creates the loggers of the packages with a shared configuration.
+type Root struct {
+	out    *output
+	level  Level
+	levels map[string]Level
+}
+
+// New returns the root of the loggers configured by config.
+func New(config Config) (*Root, error) {
+	if config.Format == "" {
+		config.Format = FormatText
+	}
+	if config.Format != FormatText && config.Format != FormatJSON {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, config.Format)
+	}
+	if config.Output == nil {
+		config.Output = os.Stderr
+	}
+	return &Root{
+		out:    &output{w: config.Output, format: config.Format, now: time.Now, redact: config.Redact},
+		level:  config.Level,
+		levels: config.Levels,
+	}, nil
+}
+
+// For returns the logger of the package, with the level of its override if it has one.
+func (r *Root) For(pkg string) Logger {
+	level, ok := r.levels[pkg]
+	if !ok {
+		level = r.level
+	}
+	return &logger{out: r.out, pkg: pkg, level: level}
+}
+
+var std, _ = New(Config{})
+
+// For returns the logger of the package used until another one is set: info and above
+// as text to os.Stderr.
+func For(pkg string) Logger {
+	return std.For(pkg)
+}
+
+// Inject creates the loggers of the packages with the configuration and passes each one
+// to the setter of its package, like SetLogger, by the name of the package.
+func Inject(config Config, setters map[string]func(Logger)) error {
+	root, err := New(config)
+	if err != nil {
+		return err
+	}
+	for pkg, set := range setters {
+		set(root.For(pkg))
+	}
+	return nil
+}
+
+// Var is a Logger that writes to the logger it holds, which can be replaced while it is in
+// use by other goroutines. It is the logger of a package, replaced by its SetLogger.
+type Var struct {
+	v atomic.Value
+}
+
+// holder keeps the concrete type stored in the atomic.Value the same for every logger.
+type holder struct {
+	l Logger
+}
+
+// NewVar returns a Var that writes to l until Set.
+func NewVar(l Logger) *Var {
+	v := &Var{}
+	v.Set(l)
+	return v
+}
+
+// Set replaces the logger written to.
+func (v *Var) Set(l Logger) { v.v.Store(holder{l: l}) }
+
+// Get returns the logger written to.
+func (v *Var) Get() Logger { return v.v.Load().(holder).l }
+
+func (v *Var) Debug(msg string, keyvals ...interface{}) { v.Get().Debug(msg, keyvals...) }
+func (v *Var) Info(msg string, keyvals ...interface{})  { v.Get().Info(msg, keyvals...) }
+func (v *Var) Warn(msg string, keyvals ...interface{})  { v.Get().Warn(msg, keyvals...) }
+func (v *Var) Error(msg string, keyvals ...interface{}) { v.Get().Error(msg, keyvals...) }
+
+// With returns a logger that adds the key value pairs to the records of the logger held now.
+func (v *Var) With(keyvals ...interface{}) Logger { return v.Get().With(keyvals...) }
+
+// logger is the Logger of one package.
+type logger struct {
+	out    *output
+	pkg    string
+	level  Level
+	fields []interface{}
+}
+
+func (l *logger) Debug(msg string, keyvals ...interface{}) { l.log(LevelDebug, msg, keyvals) }
+func (l *logger) Info(msg string, keyvals ...interface{})  { l.log(LevelInfo, msg, keyvals) }
+func (l *logger) Warn(msg string, keyvals ...interface{})  { l.log(LevelWarn, msg, keyvals) }
+func (l *logger) Error(msg string, keyvals ...interface{}) { l.log(LevelError, msg, keyvals) }
+
+func (l *logger) With(keyvals ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &logger{out: l.out, pkg: l.pkg, level: l.level, fields: fields}
+}
+
+func (l *logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	fields := l.fields
+	if len(keyvals) > 0 {
+		fields = append(append(make([]interface{}, 0, len(l.fields)+len(keyvals)), l.fields...), keyvals...)
+	}
+	l.out.write(level, l.pkg, msg, fields)
+}
+
+// output writes the records of all the loggers of a root, one at a time.
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	now    func() time.Time
+	redact func(string) string
+}
+
+func (o *output) write(level Level, pkg, msg string, keyvals []interface{}) {
+	r := record{time: o.now(), level: level, pkg: pkg, msg: msg, fields: pairs(keyvals)}
+	if o.redact != nil {
+		r.msg = o.redact(r.msg)
+		for i, f := range r.fields {
+			r.fields[i].value = redactValue(o.redact, f.value)
+		}
+	}
+	var line []byte
+	if o.format == FormatJSON {
+		line = r.appendJSON(nil)
+	} else {
+		line = r.appendText(nil)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w.Write(line)
+}
+
+// redactValue returns the text of strings, errors and fmt.Stringer values redacted and the
+// other values as they are, so the structure of a JSON record does not depend on the redaction.
+func redactValue(redact func(string) string, value interface{}) interface{} {
+	switch value.(type) {
+	case string, error, fmt.Stringer:
+		return redact(textValue(value))
+	}
+	return value
+}
+
+// field is one key value pair of a record.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// pairs returns the key value pairs, a value without key has the key !BADKEY.
+func pairs(keyvals []interface{}) []field {
+	fields := make([]field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok || i+1 == len(keyvals) {
+			fields = append(fields, field{key: "!BADKEY", value: keyvals[i]})
+			i--
+			continue
+		}
+		fields = append(fields, field{key: key, value: keyvals[i+1]})
+	}
+	return fields
+}
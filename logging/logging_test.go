@@ -0,0 +1,178 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestRoot(t *testing.T, config Config) (*Root, *bytes.Buffer) {
+	t.Helper()
+	var b bytes.Buffer
+	config.Output = &b
+	root, err := New(config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	root.out.now = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 8000000, time.UTC) }
+	return root, &b
+}
+
+func TestLogger_Text(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(Logger)
+		want string
+	}{
+		{
+			name: "message",
+			log:  func(l Logger) { l.Info("connected") },
+			want: "2021-03-04T05:06:07.008Z INFO connection: connected\n",
+		},
+		{
+			name: "fields",
+			log: func(l Logger) {
+				l.With(KeySession, "s1").Warn("failed", KeyEndpoint, "host:3336", KeyError, errors.New("connection reset"), "wait", time.Second)
+			},
+			want: "2021-03-04T05:06:07.008Z WARN connection: failed session=s1 endpoint=host:3336 error=\"connection reset\" wait=1s\n",
+		},
+		{
+			name: "quoted",
+			log:  func(l Logger) { l.Error("line", "line", "a=b\nEND", "empty", "") },
+			want: "2021-03-04T05:06:07.008Z ERROR connection: line line=\"a=b\\nEND\" empty=\"\"\n",
+		},
+		{
+			name: "bad keys",
+			log:  func(l Logger) { l.Info("odd", 1, "a", "b") },
+			want: "2021-03-04T05:06:07.008Z INFO connection: odd !BADKEY=1 a=b\n",
+		},
+		{
+			name: "below the level",
+			log:  func(l Logger) { l.Debug("hidden") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, b := newTestRoot(t, Config{Level: LevelInfo})
+			tt.log(root.For("connection"))
+			if b.String() != tt.want {
+				t.Errorf("record = %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLogger_JSON(t *testing.T) {
+	root, b := newTestRoot(t, Config{Level: LevelDebug, Format: FormatJSON})
+	root.For("miner").With(KeySession, "s1").Debug("received", KeyCommand, "POW", "difficulty", 9, "wait", time.Second)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("record %q is not JSON: %v", b.String(), err)
+	}
+	want := map[string]interface{}{
+		"time": "2021-03-04T05:06:07.008Z", "level": "DEBUG", "package": "miner", "msg": "received",
+		"session": "s1", "command": "POW", "difficulty": float64(9), "wait": "1s",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("record[%q] = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestRoot_For(t *testing.T) {
+	root, b := newTestRoot(t, Config{Level: LevelWarn, Levels: map[string]Level{"connection": LevelDebug}})
+	root.For("connection").Debug("shown")
+	root.For("worker").Info("hidden")
+	root.For("worker").Warn("shown")
+	if got := bytes.Count(b.Bytes(), []byte("shown")); got != 2 || bytes.Contains(b.Bytes(), []byte("hidden")) {
+		t.Errorf("records = %q, want the two shown", b.String())
+	}
+}
+
+func TestConfig_ParseLevels(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantLevel  Level
+		wantLevels map[string]Level
+		wantErr    error
+	}{
+		{spec: "", wantLevel: LevelInfo},
+		{spec: "debug", wantLevel: LevelDebug},
+		{spec: "WARNING", wantLevel: LevelWarn},
+		{spec: "error, connection=debug,worker=warn", wantLevel: LevelError, wantLevels: map[string]Level{"connection": LevelDebug, "worker": LevelWarn}},
+		{spec: "miner=debug", wantLevel: LevelInfo, wantLevels: map[string]Level{"miner": LevelDebug}},
+		{spec: "verbose", wantErr: ErrUnknownLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			config := Config{Level: LevelInfo}
+			err := config.ParseLevels(tt.spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseLevels() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.Level != tt.wantLevel || len(config.Levels) != len(tt.wantLevels) {
+				t.Fatalf("ParseLevels() = %v %v, want %v %v", config.Level, config.Levels, tt.wantLevel, tt.wantLevels)
+			}
+			for pkg, level := range tt.wantLevels {
+				if config.Levels[pkg] != level {
+					t.Errorf("ParseLevels() level of %s = %v, want %v", pkg, config.Levels[pkg], level)
+				}
+			}
+		})
+	}
+}
+
+func TestNew_UnknownFormat(t *testing.T) {
+	if _, err := New(Config{Format: "xml"}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("New() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestInject(t *testing.T) {
+	var b bytes.Buffer
+	var connection, worker Logger
+	err := Inject(Config{Level: LevelWarn, Levels: map[string]Level{"worker": LevelDebug}, Output: &b}, map[string]func(Logger){
+		"connection": func(l Logger) { connection = l },
+		"worker":     func(l Logger) { worker = l },
+	})
+	if err != nil {
+		t.Fatalf("Inject() error = %v", err)
+	}
+	connection.Info("hidden")
+	worker.Debug("shown")
+	if got := b.String(); !bytes.Contains(b.Bytes(), []byte("DEBUG worker: shown")) || bytes.Contains(b.Bytes(), []byte("hidden")) {
+		t.Errorf("records = %q, want only the one of the worker", got)
+	}
+}
+
+func TestVar(t *testing.T) {
+	first, b1 := newTestRoot(t, Config{})
+	second, b2 := newTestRoot(t, Config{})
+	v := NewVar(first.For("worker"))
+	v.Info("to the first")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			v.Debug("hidden")
+		}
+	}()
+	v.Set(second.For("worker"))
+	<-done
+	v.With("job", 1).Info("to the second")
+
+	if !bytes.Contains(b1.Bytes(), []byte("to the first")) || bytes.Contains(b1.Bytes(), []byte("to the second")) {
+		t.Errorf("first records = %q, want only the record before Set", b1.String())
+	}
+	if !bytes.Contains(b2.Bytes(), []byte("to the second job=1")) {
+		t.Errorf("second records = %q, want the record after Set with its field", b2.String())
+	}
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// timeFormat is the time of the records, RFC 3339 with milliseconds.
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// record is one line of the log.
+type record struct {
+	time   time.Time
+	level  Level
+	pkg    string
+	msg    string
+	fields []field
+}
+
+// appendText appends the record as: time LEVEL package: message key=value ...
+func (r record) appendText(b []byte) []byte {
+	b = r.time.AppendFormat(b, timeFormat)
+	b = append(b, ' ')
+	b = append(b, r.level.String()...)
+	b = append(b, ' ')
+	if r.pkg != "" {
+		b = append(b, r.pkg...)
+		b = append(b, ": "...)
+	}
+	b = append(b, r.msg...)
+	for _, f := range r.fields {
+		b = append(b, ' ')
+		b = appendTextValue(b, f.key)
+		b = append(b, '=')
+		b = appendTextValue(b, textValue(f.value))
+	}
+	return append(b, '\n')
+}
+
+// textValue returns the value as it is written in a text record.
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// appendTextValue appends the value quoted when it is empty or has spaces, quotes, = or
+// characters that are not printable, so a record is always one line.
+func appendTextValue(b []byte, s string) []byte {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r == '"' || r == '=' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.AppendQuote(b, s)
+	}
+	return append(b, s...)
+}
+
+// appendJSON appends the record as one JSON object with the fields after time, level,
+// package and message.
+func (r record) appendJSON(b []byte) []byte {
+	b = append(b, `{"time":`...)
+	b = appendJSONValue(b, r.time.Format(timeFormat))
+	b = append(b, `,"level":`...)
+	b = appendJSONValue(b, r.level.String())
+	if r.pkg != "" {
+		b = append(b, `,"package":`...)
+		b = appendJSONValue(b, r.pkg)
+	}
+	b = append(b, `,"msg":`...)
+	b = appendJSONValue(b, r.msg)
+	for _, f := range r.fields {
+		b = append(b, ',')
+		b = appendJSONValue(b, f.key)
+		b = append(b, ':')
+		b = appendJSONValue(b, jsonValue(f.value))
+	}
+	return append(b, "}\n"...)
+}
+
+// jsonValue returns the value as it is written in a JSON record: errors and durations as
+// their text, the rest as encoding/json does.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	}
+	return value
+}
+
+func appendJSONValue(b []byte, value interface{}) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return append(b, data...)
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Modes of masking a value.
+const (
+	// MaskFull replaces the value with [REDACTED].
+	MaskFull = "full"
+	// MaskPartial keeps the first letter of each word and the domain of emails, j***@example.com.
+	MaskPartial = "partial"
+	// MaskHash replaces the value with a keyed hash, the same value has the same hash in the
+	// logs of a run but they can not be matched with the ones of another run.
+	MaskHash = "hash"
+)
+
+// ErrUnknownMask is returned for a mode that is not full, partial or hash.
+var ErrUnknownMask = errors.New("unknown mask mode, use full, partial or hash")
+
+// Masker hides values in the logs.
+type Masker struct {
+	mode string
+	key  []byte
+}
+
+// NewMasker returns a masker of the mode, full by default.
+func NewMasker(mode string) (*Masker, error) {
+	switch mode {
+	case "":
+		mode = MaskFull
+	case MaskFull, MaskPartial, MaskHash:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMask, mode)
+	}
+	m := &Masker{mode: mode}
+	if mode == MaskHash {
+		m.key = make([]byte, 32)
+		if _, err := rand.Read(m.key); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Mask returns the value hidden as configured.
+func (m *Masker) Mask(value string) string {
+	switch m.mode {
+	case MaskPartial:
+		return partial(value)
+	case MaskHash:
+		mac := hmac.New(sha256.New, m.key)
+		mac.Write([]byte(value))
+		return "[sha256:" + hex.EncodeToString(mac.Sum(nil)[:8]) + "]"
+	}
+	return "[REDACTED]"
+}
+
+// partial keeps the first letter of each word, and the domain of an email.
+func partial(value string) string {
+	if at := strings.LastIndex(value, "@"); at > 0 && !strings.ContainsAny(value, " \t") {
+		return partial(value[:at]) + value[at:]
+	}
+	words := strings.Fields(value)
+	if len(words) == 0 {
+		return "***"
+	}
+	for i, word := range words {
+		r, _ := utf8.DecodeRuneInString(word)
+		words[i] = string(r) + "***"
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMasker_Mask(t *testing.T) {
+	tests := []struct {
+		mode  string
+		value string
+		want  string
+	}{
+		{mode: "", value: "John Smith", want: "[REDACTED]"},
+		{mode: MaskFull, value: "john@example.com", want: "[REDACTED]"},
+		{mode: MaskPartial, value: "john@example.com", want: "j***@example.com"},
+		{mode: MaskPartial, value: "John Smith", want: "J*** S***"},
+		{mode: MaskPartial, value: "Große Straße 3", want: "G*** S*** 3***"},
+		{mode: MaskPartial, value: "", want: "***"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.value, func(t *testing.T) {
+			m, err := NewMasker(tt.mode)
+			if err != nil {
+				t.Fatalf("NewMasker() error = %v", err)
+			}
+			if got := m.Mask(tt.value); got != tt.want {
+				t.Errorf("Mask(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMasker_MaskHash(t *testing.T) {
+	m, err := NewMasker(MaskHash)
+	if err != nil {
+		t.Fatalf("NewMasker() error = %v", err)
+	}
+	first, again, other := m.Mask("john@example.com"), m.Mask("john@example.com"), m.Mask("jane@example.com")
+	if first != again || first == other || !strings.HasPrefix(first, "[sha256:") || strings.Contains(first, "john") {
+		t.Errorf("Mask() = %q, %q and %q, want the same hash for the same value only", first, again, other)
+	}
+
+	// Another run has another key.
+	m2, _ := NewMasker(MaskHash)
+	if m2.Mask("john@example.com") == first {
+		t.Errorf("Mask() of two maskers = %q, want different hashes", first)
+	}
+}
+
+func TestNewMasker_UnknownMode(t *testing.T) {
+	if _, err := NewMasker("stars"); !errors.Is(err, ErrUnknownMask) {
+		t.Errorf("NewMasker() error = %v, want %v", err, ErrUnknownMask)
+	}
+}
+
+func TestConfig_Redact(t *testing.T) {
+	redact := func(s string) string { return strings.ReplaceAll(s, "john@example.com", "[REDACTED]") }
+	for _, format := range []string{FormatText, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			root, b := newTestRoot(t, Config{Format: format, Redact: redact})
+			root.For("miner").With("mail", "john@example.com").Info("sent john@example.com",
+				"line", "0123 john@example.com", KeyError, errors.New("rejected john@example.com"), "count", 2)
+			if strings.Contains(b.String(), "john@") || strings.Count(b.String(), "[REDACTED]") != 4 {
+				t.Errorf("record = %q, want the mail redacted in the message and the fields", b.String())
+			}
+			if !strings.Contains(b.String(), `count=2`) && !strings.Contains(b.String(), `"count":2`) {
+				t.Errorf("record = %q, want the number as it is", b.String())
+			}
+		})
+	}
+}
+
+func TestConfig_RedactKeepsStructuredValues(t *testing.T) {
+	type stats struct {
+		A int
+		B []int
+	}
+	plain, b := newTestRoot(t, Config{Format: FormatJSON})
+	plain.For("miner").Info("stats", "stats", stats{A: 1, B: []int{2}})
+	redacted, rb := newTestRoot(t, Config{Format: FormatJSON, Redact: func(s string) string { return s }})
+	redacted.For("miner").Info("stats", "stats", stats{A: 1, B: []int{2}})
+
+	want := `"stats":{"A":1,"B":[2]}`
+	if !strings.Contains(b.String(), want) || !strings.Contains(rb.String(), want) {
+		t.Errorf("records = %q and %q, want %s in both", b.String(), rb.String(), want)
+	}
+}
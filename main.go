@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 
+	"github.com/MihaiLupoiu/interview-exasol/admin"
+	"github.com/MihaiLupoiu/interview-exasol/hashworker"
 	"github.com/MihaiLupoiu/interview-exasol/miner"
+	"github.com/MihaiLupoiu/interview-exasol/pki"
 )
 
 const (
@@ -22,6 +27,16 @@ func main() {
 }
 
 func run(args []string, stdout io.Writer) error {
+	if len(args) > 1 && args[1] == "hashworker" {
+		return runHashWorker(args[2:])
+	}
+	if len(args) > 1 && args[1] == "pki" {
+		return pki.Run(args[2:], stdout)
+	}
+	if len(args) > 1 && args[1] == "minerctl" {
+		return admin.Run(args[2:], stdout)
+	}
+
 	configuration := miner.Get()
 
 	minerCtx, err := miner.Init(configuration)
@@ -29,5 +44,18 @@ func run(args []string, stdout io.Writer) error {
 		return err
 	}
 
-	return minerCtx.Run()
+	if err := minerCtx.Run(); !errors.Is(err, miner.ErrCanceled) {
+		return err
+	}
+	return nil
+}
+
+// runHashWorker runs a remote hash worker for a miner started with -coordinator.
+func runHashWorker(args []string) error {
+	configuration, err := hashworker.Get(args)
+	if err != nil {
+		return err
+	}
+
+	return hashworker.Run(context.Background(), configuration)
 }
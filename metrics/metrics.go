@@ -0,0 +1,252 @@
+// Package metrics exposes counters and gauges in the Prometheus text format over HTTP,
+// written with the standard library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Types of the metrics.
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+)
+
+// Registry has the metrics written in each scrape, in the order they were registered.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// metric is a family of series with the same name.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Counter registers a counter with the labels.
+func (r *Registry) Counter(name, help string, labels ...string) *Vec {
+	v := newVec(name, help, typeCounter, labels)
+	r.register(name, v)
+	return v
+}
+
+// Gauge registers a gauge with the labels.
+func (r *Registry) Gauge(name, help string, labels ...string) *Vec {
+	v := newVec(name, help, typeGauge, labels)
+	r.register(name, v)
+	return v
+}
+
+// CounterFunc registers a counter without labels whose value is read in each scrape.
+func (r *Registry) CounterFunc(name, help string, value func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: typeCounter, value: value})
+}
+
+// GaugeFunc registers a gauge without labels whose value is read in each scrape.
+func (r *Registry) GaugeFunc(name, help string, value func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: typeGauge, value: value})
+}
+
+// WriteTo writes all the metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP writes the metrics, so the registry is the handler of /metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// Listen serves the metrics of the registry in /metrics of the address until the listener
+// is closed.
+func Listen(addr string, r *Registry) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	go http.Serve(listener, mux)
+	return listener, nil
+}
+
+// Vec is a counter or gauge with a series for each combination of the values of its labels.
+type Vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is the value of one combination of label values.
+type series struct {
+	values []string
+	value  float64
+}
+
+func newVec(name, help, typ string, labels []string) *Vec {
+	return &Vec{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+// get returns the series of the label values, created at 0 the first time.
+// Must be called with the lock held.
+func (v *Vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// Inc adds one to the series of the label values.
+func (v *Vec) Inc(values ...string) {
+	v.Add(1, values...)
+}
+
+// Add adds delta to the series of the label values.
+func (v *Vec) Add(delta float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(values).value += delta
+}
+
+// Set sets the series of the label values, for gauges.
+func (v *Vec) Set(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(values).value = value
+}
+
+// Value returns the value of the series of the label values.
+func (v *Vec) Value(values ...string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.get(values).value
+}
+
+func (v *Vec) write(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.typ)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		w.WriteString(v.name)
+		if len(v.labels) > 0 {
+			w.WriteByte('{')
+			for i, label := range v.labels {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(s.values[i]))
+			}
+			w.WriteByte('}')
+		}
+		w.WriteByte(' ')
+		w.WriteString(formatValue(s.value))
+		w.WriteByte('\n')
+	}
+}
+
+// funcMetric is a metric without labels read from a function.
+type funcMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func() float64
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, m.name, m.help, m.typ)
+	fmt.Fprintf(w, "%s %s\n", m.name, formatValue(m.value()))
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// formatValue writes the value as Prometheus expects, with +Inf, -Inf and NaN.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written for WriteTo.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
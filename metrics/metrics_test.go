@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	attempts := r.Counter("connection_attempts_total", "Connection attempts by endpoint.", "endpoint")
+	state := r.Gauge("session_state", "State of the session.", "state")
+	r.GaugeFunc("hashrate", "Hashes per second.", func() float64 { return 1.5e6 })
+	r.CounterFunc("hashes_total", "Hashes attempted.", func() float64 { return 42 })
+	r.Gauge("escaped", "Line one\nline \\two.", "value").Set(math.Inf(1), "a\"b\\c\nd")
+
+	attempts.Inc("b:3336")
+	attempts.Add(2, "a:3336")
+	state.Set(1, "pow")
+	state.Set(0, "handshake")
+
+	var b bytes.Buffer
+	n, err := r.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) {
+		t.Fatalf("WriteTo() = %d, %v; want %d bytes", n, err, b.Len())
+	}
+	want := `# HELP connection_attempts_total Connection attempts by endpoint.
+# TYPE connection_attempts_total counter
+connection_attempts_total{endpoint="a:3336"} 2
+connection_attempts_total{endpoint="b:3336"} 1
+# HELP session_state State of the session.
+# TYPE session_state gauge
+session_state{state="handshake"} 0
+session_state{state="pow"} 1
+# HELP hashrate Hashes per second.
+# TYPE hashrate gauge
+hashrate 1.5e+06
+# HELP hashes_total Hashes attempted.
+# TYPE hashes_total counter
+hashes_total 42
+# HELP escaped Line one\nline \\two.
+# TYPE escaped gauge
+escaped{value="a\"b\\c\nd"} +Inf
+`
+	if b.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRegistry_DuplicateMetric(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("commands_total", "Commands.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Counter() with a duplicate name did not panic")
+		}
+	}()
+	r.Gauge("commands_total", "Commands.")
+}
+
+func TestVec_WrongLabels(t *testing.T) {
+	v := NewRegistry().Counter("commands_total", "Commands.", "command")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Inc() without the label did not panic")
+		}
+	}()
+	v.Inc()
+}
+
+func TestListen(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("commands_total", "Commands.", "command").Inc("HELO")
+	listener, err := Listen("127.0.0.1:0", r)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != ContentType || !bytes.Contains(body, []byte(`commands_total{command="HELO"} 1`)) {
+		t.Errorf("GET /metrics = %s %q, want the metrics in the text format", resp.Header.Get("Content-Type"), body)
+	}
+}
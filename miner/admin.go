@@ -0,0 +1,253 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/admin"
+	"github.com/MihaiLupoiu/interview-exasol/worker"
+)
+
+// ErrCanceled is returned by Run when the miner was canceled with the admin API.
+var ErrCanceled = errors.New("canceled with the admin API")
+
+// ErrNoLocalWorkers is returned by the controls of the workers in coordinator mode, where
+// only the remote hash workers search the POW.
+var ErrNoLocalWorkers = errors.New("the POW is searched by the remote hash workers")
+
+// errNotRunning is returned by Cancel before Run.
+var errNotRunning = errors.New("the miner is not running")
+
+// controls are the changes of the admin API, applied to every pool of the miner.
+type controls struct {
+	paused bool
+	// workers overrides the workers of the configuration when it is not 0.
+	workers int
+	// cancel ends Run.
+	cancel context.CancelFunc
+}
+
+// apply applies the controls to a new pool.
+func (c controls) apply(pool worker.Pool) {
+	if c.workers > 0 {
+		pool.Resize(c.workers)
+	}
+	if c.paused {
+		pool.Pause()
+	}
+}
+
+// controller is the miner controlled by the admin API.
+type controller struct {
+	miner *Miner
+}
+
+// Status returns the state of the session.
+func (c controller) Status() admin.Status {
+	m := c.miner
+	pool := m.pool()
+	s := m.snapshot()
+	status := admin.Status{
+		Session:    m.sessionID(),
+		Endpoint:   m.endpoint(),
+		State:      s.State,
+		Command:    s.Command,
+		Authdata:   s.Authdata,
+		Difficulty: s.Difficulty,
+		Paused:     pool.Paused(),
+		Workers:    pool.GetWorkerCount(),
+		Hashes:     s.Hashes,
+	}
+	if m.Counter != nil {
+		status.Hashrate = float64(m.Counter.Rate())
+	}
+	if !s.POWStart.IsZero() {
+		status.ElapsedSeconds = time.Since(s.POWStart).Seconds()
+	}
+	return status
+}
+
+// Pause stops the workers until Resume, the POW is still searched by the mining clients.
+func (c controller) Pause() error {
+	return c.control(func(m *Miner) {
+		m.controls.paused = true
+		m.WPool.Pause()
+	})
+}
+
+// Resume starts again the workers stopped by Pause.
+func (c controller) Resume() error {
+	return c.control(func(m *Miner) {
+		m.controls.paused = false
+		m.WPool.Resume()
+	})
+}
+
+// SetWorkers changes the number of workers, of the current pool and the next ones.
+func (c controller) SetWorkers(n int) error {
+	if err := c.control(func(m *Miner) {
+		m.controls.workers = n
+		m.WPool.Resize(n)
+	}); err != nil {
+		return err
+	}
+	c.miner.grown()
+	return nil
+}
+
+// control changes the controls of the workers and the current pool.
+func (c controller) control(change func(m *Miner)) error {
+	m := c.miner
+	if m.Coordinator != nil {
+		return ErrNoLocalWorkers
+	}
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+	change(m)
+	return nil
+}
+
+// Cancel ends the session, Run returns ErrCanceled.
+func (c controller) Cancel() error {
+	m := c.miner
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+	if m.controls.cancel == nil {
+		return errNotRunning
+	}
+	m.controls.cancel()
+	return nil
+}
+
+// state is the dump of the miner. Every part has its own JSON shape, so the output does
+// not change with the types of the other packages, and durations are in seconds.
+type state struct {
+	Status admin.Status `json:"status"`
+	// JobHashes are the hashes attempted by each job of the current POW.
+	JobHashes      []uint64      `json:"job_hashes"`
+	Pool           poolState     `json:"pool"`
+	Coordinator    bool          `json:"coordinator"`
+	MiningClients  []clientState `json:"mining_clients,omitempty"`
+	Retry          retryState    `json:"retry"`
+	TotalHashes    uint64        `json:"total_hashes"`
+	Goroutines     int           `json:"goroutines"`
+	MetricsEnabled bool          `json:"metrics_enabled"`
+}
+
+// poolState is the dump of the stats of the worker pool.
+type poolState struct {
+	Workers    int            `json:"workers"`
+	Paused     bool           `json:"paused"`
+	Queued     int            `json:"queued"`
+	Running    int            `json:"running"`
+	Completed  uint64         `json:"completed"`
+	Failed     uint64         `json:"failed"`
+	Skipped    uint64         `json:"skipped"`
+	HandedBack uint64         `json:"handed_back"`
+	WorkerBusy []workerState  `json:"worker_busy"`
+	Durations  histogramState `json:"durations"`
+}
+
+// workerState is the dump of the activity of one worker.
+type workerState struct {
+	ID          int     `json:"id"`
+	Jobs        uint64  `json:"jobs"`
+	BusySeconds float64 `json:"busy_seconds"`
+	Running     bool    `json:"running"`
+	Retired     bool    `json:"retired"`
+}
+
+// histogramState is the dump of the histogram of the job durations.
+type histogramState struct {
+	BoundsSeconds []float64 `json:"bounds_seconds"`
+	Counts        []uint64  `json:"counts"`
+	Count         uint64    `json:"count"`
+	SumSeconds    float64   `json:"sum_seconds"`
+}
+
+// clientState is the dump of a Stratum mining client.
+type clientState struct {
+	Session           string  `json:"session"`
+	Name              string  `json:"name"`
+	Addr              string  `json:"addr"`
+	Accepted          uint64  `json:"accepted"`
+	Rejected          uint64  `json:"rejected"`
+	Shares            uint64  `json:"shares"`
+	ReportedHashrate  float64 `json:"reported_hashrate"`
+	EstimatedHashrate float64 `json:"estimated_hashrate"`
+	Suspicious        bool    `json:"suspicious"`
+}
+
+// retryState is the dump of the retry policy.
+type retryState struct {
+	InitialIntervalSeconds float64 `json:"initial_interval_seconds"`
+	MaxIntervalSeconds     float64 `json:"max_interval_seconds"`
+	Multiplier             float64 `json:"multiplier"`
+	Jitter                 float64 `json:"jitter"`
+	MaxAttempts            int     `json:"max_attempts"`
+	MaxElapsedSeconds      float64 `json:"max_elapsed_seconds"`
+}
+
+// DumpState returns the status, the pool, the mining clients and the retry policy of the miner.
+func (c controller) DumpState() interface{} {
+	m := c.miner
+	s := state{
+		Status:      c.Status(),
+		JobHashes:   m.snapshot().Workers,
+		Pool:        newPoolState(m.pool().Stats()),
+		Coordinator: m.Coordinator != nil,
+		Retry: retryState{
+			InitialIntervalSeconds: m.Retry.InitialInterval.Seconds(),
+			MaxIntervalSeconds:     m.Retry.MaxInterval.Seconds(),
+			Multiplier:             m.Retry.Multiplier,
+			Jitter:                 m.Retry.Jitter,
+			MaxAttempts:            m.Retry.MaxAttempts,
+			MaxElapsedSeconds:      m.Retry.MaxElapsed.Seconds(),
+		},
+		TotalHashes:    m.totalHashes(),
+		Goroutines:     runtime.NumGoroutine(),
+		MetricsEnabled: m.metrics != nil,
+	}
+	if m.Stratum != nil {
+		for _, client := range m.Stratum.Clients() {
+			s.MiningClients = append(s.MiningClients, clientState(client))
+		}
+	}
+	if s.JobHashes == nil {
+		s.JobHashes = []uint64{}
+	}
+	return s
+}
+
+// newPoolState returns the dump of the stats of the pool.
+func newPoolState(stats worker.Stats) poolState {
+	p := poolState{
+		Workers:    stats.Workers,
+		Paused:     stats.Paused,
+		Queued:     stats.Queued,
+		Running:    stats.Running,
+		Completed:  stats.Completed,
+		Failed:     stats.Failed,
+		Skipped:    stats.Skipped,
+		HandedBack: stats.HandedBack,
+		WorkerBusy: make([]workerState, len(stats.WorkerBusy)),
+		Durations: histogramState{
+			BoundsSeconds: make([]float64, len(stats.Durations.Bounds)),
+			Counts:        stats.Durations.Counts,
+			Count:         stats.Durations.Count,
+			SumSeconds:    stats.Durations.Sum.Seconds(),
+		},
+	}
+	for i, w := range stats.WorkerBusy {
+		p.WorkerBusy[i] = workerState{ID: w.ID, Jobs: w.Jobs, BusySeconds: w.Busy.Seconds(), Running: w.Running, Retired: w.Retired}
+	}
+	for i, bound := range stats.Durations.Bounds {
+		p.Durations.BoundsSeconds[i] = bound.Seconds()
+	}
+	if p.Durations.Counts == nil {
+		p.Durations.Counts = []uint64{}
+	}
+	return p
+}
@@ -0,0 +1,108 @@
+package miner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/coordinator"
+	"github.com/paulbellamy/ratecounter"
+)
+
+// eventually fails the test if the condition is not true within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestMiner_AdminControls(t *testing.T) {
+	addr, stop := fakeServer(t,
+		func(conn net.Conn, r *bufio.Reader) {
+			conn.Write([]byte("HELO\n"))
+			expect(t, conn, r, "EHLO")
+			// Too difficult to be found during the test.
+			conn.Write([]byte("POW abcdef 9\n"))
+			r.ReadString('\n')
+		},
+	)
+	defer stop()
+
+	m := newTestMiner(t, addr)
+	m.Counter = ratecounter.NewRateCounter(time.Second)
+	m.hashes = new(uint64)
+	c := controller{m}
+	if err := c.Cancel(); err == nil {
+		t.Errorf("Cancel() before Run error = nil")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run() }()
+	eventually(t, "the search of the POW", func() bool { return c.Status().Hashes > 0 })
+
+	if err := c.Pause(); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	eventually(t, "the workers to stop", func() bool { return m.pool().Stats().Running == 0 })
+	if status := c.Status(); !status.Paused || status.State != statePOW || status.Endpoint != addr {
+		t.Errorf("Status() = %+v, want the POW paused", status)
+	}
+	paused := c.Status().Hashes
+	time.Sleep(time.Millisecond * 50)
+	if hashes := c.Status().Hashes; hashes != paused {
+		t.Errorf("hashes went from %d to %d while paused", paused, hashes)
+	}
+
+	if err := c.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if err := c.SetWorkers(3); err != nil {
+		t.Fatalf("SetWorkers() error = %v", err)
+	}
+	eventually(t, "3 workers searching", func() bool {
+		return m.pool().Stats().Running == 3 && len(m.snapshot().Workers) == 3
+	})
+	if state := c.DumpState().(state); state.Status.Workers != 3 || len(state.JobHashes) != 3 || state.Pool.Paused {
+		t.Errorf("DumpState() = %+v, want 3 jobs searching", state)
+	}
+	dump, err := json.Marshal(c.DumpState())
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, key := range []string{`"worker_busy":[{"id":`, `"busy_seconds":`, `"bounds_seconds":[0.001,`, `"initial_interval_seconds":0.001,`} {
+		if !strings.Contains(string(dump), key) {
+			t.Errorf("DumpState() = %s, want %s", dump, key)
+		}
+	}
+
+	if err := c.Cancel(); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrCanceled) {
+			t.Errorf("Run() error = %v, want %v", err, ErrCanceled)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Run() did not return after Cancel()")
+	}
+}
+
+func TestMiner_AdminControlsInCoordinatorMode(t *testing.T) {
+	c := controller{&Miner{Coordinator: &coordinator.Coordinator{}}}
+	if err := c.Pause(); !errors.Is(err, ErrNoLocalWorkers) {
+		t.Errorf("Pause() error = %v, want %v", err, ErrNoLocalWorkers)
+	}
+	if err := c.SetWorkers(2); !errors.Is(err, ErrNoLocalWorkers) {
+		t.Errorf("SetWorkers() error = %v, want %v", err, ErrNoLocalWorkers)
+	}
+}
@@ -0,0 +1,73 @@
+package miner
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/MihaiLupoiu/interview-exasol/dashboard"
+	"github.com/MihaiLupoiu/interview-exasol/events"
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+// Outputs of the miner in stdout.
+const (
+	// OutputText shows the dashboard.
+	OutputText = "text"
+	// OutputJSON writes the events of the session, one JSON object per line.
+	OutputJSON = "json"
+)
+
+// ErrUnknownOutput is returned for an output that is neither text nor json.
+var ErrUnknownOutput = errors.New("unknown output")
+
+// diagnosticsOutput is where the diagnostics of the connection are printed, stderr when
+// stdout has the events.
+func diagnosticsOutput(output string) io.Writer {
+	if output == OutputJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// emit writes the event of the current session, when the output is json.
+func (ctx *Miner) emit(e events.Event) {
+	if ctx.events == nil {
+		return
+	}
+	if e.Session == "" {
+		e.Session = ctx.sessionID()
+	}
+	if err := ctx.events.Emit(e); err != nil {
+		logger.Warn("failed to write the event", "type", e.Type, logging.KeyError, err)
+	}
+}
+
+// emitError writes the failure of the session, retryable when a new one is started after it.
+func (ctx *Miner) emitError(err error, retryable bool) {
+	ctx.emit(events.Event{Type: events.Error, Error: &events.ErrorInfo{Message: err.Error(), Retryable: retryable}})
+}
+
+// emitProgress writes the progress of the POW being searched, it is the reporter of the
+// dashboard when the output is json.
+func (ctx *Miner) emitProgress(s dashboard.Stats) {
+	if s.POWStart.IsZero() {
+		return
+	}
+	progress := &events.ProgressInfo{
+		Hashes:         s.Hashes,
+		Hashrate:       s.Rate,
+		Average:        s.Average,
+		ElapsedSeconds: s.Elapsed.Seconds(),
+		ETASeconds:     -1,
+		Probability:    s.Probability,
+		Workers:        s.WorkerRates,
+	}
+	if s.ETA >= 0 {
+		progress.ETASeconds = s.ETA.Seconds()
+	}
+	if progress.Workers == nil {
+		progress.Workers = []float64{}
+	}
+	ctx.emit(events.Event{Type: events.Progress, Progress: progress})
+}
@@ -0,0 +1,111 @@
+package miner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/events"
+	"github.com/paulbellamy/ratecounter"
+)
+
+func TestMiner_Events(t *testing.T) {
+	addr, stop := fakeServer(t,
+		func(conn net.Conn, r *bufio.Reader) {
+			conn.Write([]byte("HELO\n"))
+			expect(t, conn, r, "EHLO")
+		},
+		func(conn net.Conn, r *bufio.Reader) {
+			conn.Write([]byte("HELO\n"))
+			expect(t, conn, r, "EHLO")
+			conn.Write([]byte("POW abcdef 1\n"))
+			conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+			if _, err := r.ReadString('\n'); err != nil {
+				t.Errorf("miner did not send the suffix: %v", err)
+			}
+			conn.Write([]byte("NAME x\n"))
+			r.ReadString('\n')
+			conn.Write([]byte("END\n"))
+			expect(t, conn, r, "OK")
+		},
+	)
+	defer stop()
+
+	var out bytes.Buffer
+	m := newTestMiner(t, addr)
+	m.Counter = ratecounter.NewRateCounter(time.Second)
+	m.UserConfig = UserConfig{Name: "Jane Doe"}
+	m.events = events.NewStream(&out)
+	if err := m.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var got []string
+	var sessions []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e events.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("event %q: %v", line, err)
+		}
+		if e.Version != events.Version || e.Time.IsZero() {
+			t.Errorf("event %q without the version and the time", line)
+		}
+		if e.Type == events.Connected && e.Session != "" {
+			t.Errorf("event %q of the connection has a session", line)
+		}
+		if e.Session != "" && (len(sessions) == 0 || sessions[len(sessions)-1] != e.Session) {
+			sessions = append(sessions, e.Session)
+		}
+		got = append(got, strings.TrimSpace(e.Type+" "+e.Command))
+		if strings.Contains(line, "Jane") {
+			t.Errorf("event %q has the value of a field", line)
+		}
+	}
+	want := []string{
+		"command HELO", "handshake", "error",
+		"connected", "command HELO", "handshake", "command POW", "pow_started", "pow_solved",
+		"command NAME", "field_sent NAME", "command END", "end",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events =\n%v\nwant\n%v", got, want)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("events of %d sessions %v, want 2", len(sessions), sessions)
+	}
+}
+
+func TestMiner_ErrorEventsWhenGivingUp(t *testing.T) {
+	drop := func(conn net.Conn, r *bufio.Reader) {
+		conn.Write([]byte("HELO\n"))
+		expect(t, conn, r, "EHLO")
+	}
+	addr, stop := fakeServer(t, drop, drop, drop)
+	defer stop()
+
+	var out bytes.Buffer
+	m := newTestMiner(t, addr)
+	m.events = events.NewStream(&out)
+	if err := m.Run(); err == nil {
+		t.Fatalf("Run() error = nil, want the error of the last attempt")
+	}
+
+	var retryable []bool
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e events.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("event %q: %v", line, err)
+		}
+		if e.Type == events.Error {
+			retryable = append(retryable, e.Error.Retryable)
+		}
+	}
+	// The miner gives up after the third attempt, so its error is not retried.
+	if fmt.Sprint(retryable) != fmt.Sprint([]bool{true, true, false}) {
+		t.Errorf("retryable of the error events = %v, want [true true false]", retryable)
+	}
+}
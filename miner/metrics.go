@@ -0,0 +1,169 @@
+package miner
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/metrics"
+)
+
+// States of the session in the miner_session_state gauge.
+const (
+	stateConnecting = "connecting"
+	stateHandshake  = "handshake"
+	statePOW        = "pow"
+	stateAnswering  = "answering"
+	stateDone       = "done"
+	stateFailed     = "failed"
+)
+
+var sessionStates = []string{stateConnecting, stateHandshake, statePOW, stateAnswering, stateDone, stateFailed}
+
+// knownCommands are counted by name in miner_commands_received_total, the rest as other,
+// so a broken server can not create a series for each line.
+var knownCommands = map[string]bool{
+	"HELO": true, "POW": true, "END": true, "ERROR": true, "NAME": true, "MAILNUM": true,
+	"MAIL1": true, "MAIL2": true, "SKYPE": true, "BIRTHDATE": true, "COUNTRY": true,
+	"ADDRNUM": true, "ADDRLINE1": true, "ADDRLINE2": true,
+}
+
+// minerMetrics are the metrics of the miner served in /metrics. The methods do nothing
+// on a nil *minerMetrics, when the metrics are not served.
+type minerMetrics struct {
+	registry   *metrics.Registry
+	listener   net.Listener
+	state      *metrics.Vec
+	difficulty *metrics.Vec
+	attempts   *metrics.Vec
+	failures   *metrics.Vec
+	commands   *metrics.Vec
+
+	mu       sync.Mutex
+	powStart time.Time
+}
+
+// newMinerMetrics registers the metrics of the session and the connection.
+func newMinerMetrics() *minerMetrics {
+	r := metrics.NewRegistry()
+	m := &minerMetrics{
+		registry:   r,
+		state:      r.Gauge("miner_session_state", "Whether the session is in the state, 1 for the current one.", "state"),
+		difficulty: r.Gauge("miner_pow_difficulty", "Difficulty of the last POW."),
+		attempts:   r.Counter("miner_connection_attempts_total", "Connection attempts by endpoint.", "endpoint"),
+		failures:   r.Counter("miner_connection_failures_total", "Failed connection attempts by endpoint.", "endpoint"),
+		commands:   r.Counter("miner_commands_received_total", "Commands received from the server by type.", "command"),
+	}
+	r.GaugeFunc("miner_pow_elapsed_seconds", "Time since the POW being searched started, 0 when there is none.", m.powElapsed)
+	m.setState(stateConnecting)
+	return m
+}
+
+// watch registers the metrics read from the miner: the hashrate and the worker pool.
+func (m *minerMetrics) watch(ctx *Miner) {
+	if m == nil {
+		return
+	}
+	m.registry.GaugeFunc("miner_hashrate", "Hashes per second of the last second.", func() float64 {
+		return float64(ctx.Counter.Rate())
+	})
+	m.registry.CounterFunc("miner_hashes_total", "Hashes attempted by the workers.", func() float64 {
+		return float64(atomic.LoadUint64(ctx.hashes))
+	})
+	m.registry.GaugeFunc("miner_worker_queue_depth", "Jobs waiting for a worker.", func() float64 {
+		return float64(ctx.pool().Stats().Queued)
+	})
+	m.registry.GaugeFunc("miner_workers_busy", "Workers running a job.", func() float64 {
+		return float64(ctx.pool().Stats().Running)
+	})
+	m.registry.GaugeFunc("miner_workers", "Workers of the pool.", func() float64 {
+		return float64(ctx.pool().GetWorkerCount())
+	})
+}
+
+// serve serves the metrics in /metrics of the address.
+func (m *minerMetrics) serve(addr string) error {
+	listener, err := metrics.Listen(addr, m.registry)
+	if err != nil {
+		return err
+	}
+	m.listener = listener
+	logger.Info("serving metrics", "addr", listener.Addr())
+	return nil
+}
+
+// close stops serving the metrics.
+func (m *minerMetrics) close() {
+	if m == nil || m.listener == nil {
+		return
+	}
+	m.listener.Close()
+}
+
+// setState sets the current state of the session.
+func (m *minerMetrics) setState(state string) {
+	if m == nil {
+		return
+	}
+	for _, s := range sessionStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		m.state.Set(value, s)
+	}
+}
+
+// received counts a command of the server.
+func (m *minerMetrics) received(command string) {
+	if m == nil {
+		return
+	}
+	if !knownCommands[command] {
+		command = "other"
+	}
+	m.commands.Inc(command)
+}
+
+// dialed counts a connection attempt to the endpoint, it is the observer of the failover.
+func (m *minerMetrics) dialed(endpoint string, err error) {
+	if m == nil {
+		return
+	}
+	m.attempts.Inc(endpoint)
+	if err != nil {
+		m.failures.Inc(endpoint)
+	}
+}
+
+// powStarted records the start of the search of a POW.
+func (m *minerMetrics) powStarted(difficulty int) {
+	if m == nil {
+		return
+	}
+	m.difficulty.Set(float64(difficulty))
+	m.mu.Lock()
+	m.powStart = time.Now()
+	m.mu.Unlock()
+	m.setState(statePOW)
+}
+
+// powEnded records the end of the search of the POW.
+func (m *minerMetrics) powEnded() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.powStart = time.Time{}
+	m.mu.Unlock()
+}
+
+func (m *minerMetrics) powElapsed() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.powStart.IsZero() {
+		return 0
+	}
+	return time.Since(m.powStart).Seconds()
+}
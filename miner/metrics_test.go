@@ -0,0 +1,102 @@
+package miner
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulbellamy/ratecounter"
+)
+
+// scrape returns the metrics of the miner as the text served in /metrics.
+func scrape(t *testing.T, m *minerMetrics) string {
+	t.Helper()
+	var b bytes.Buffer
+	if _, err := m.registry.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	return b.String()
+}
+
+func TestMiner_Metrics(t *testing.T) {
+	addr, stop := fakeServer(t,
+		func(conn net.Conn, r *bufio.Reader) {
+			conn.Write([]byte("HELO\n"))
+			expect(t, conn, r, "EHLO")
+			conn.Write([]byte("POW abcdef 1\n"))
+			conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+			if _, err := r.ReadString('\n'); err != nil {
+				t.Errorf("miner did not send the suffix: %v", err)
+			}
+			conn.Write([]byte("SHRUG\n"))
+			conn.Write([]byte("END\n"))
+		},
+	)
+	defer stop()
+
+	m := newTestMiner(t, addr)
+	m.Counter = ratecounter.NewRateCounter(time.Second)
+	m.hashes = new(uint64)
+	m.metrics = newMinerMetrics()
+	m.metrics.watch(m)
+	if err := m.Run(); err == nil {
+		t.Fatalf("Run() error = nil, want the error of the unknown command")
+	}
+
+	got := scrape(t, m.metrics)
+	for _, want := range []string{
+		`miner_commands_received_total{command="HELO"} 1`,
+		`miner_commands_received_total{command="POW"} 1`,
+		`miner_commands_received_total{command="other"} 1`,
+		`miner_session_state{state="failed"} 1`,
+		`miner_session_state{state="answering"} 0`,
+		"miner_pow_difficulty 1\n",
+		"miner_pow_elapsed_seconds 0\n",
+		"miner_workers 1\n",
+		"miner_worker_queue_depth 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "miner_hashes_total 0\n") {
+		t.Errorf("metrics = %s, want the hashes of the POW counted", got)
+	}
+}
+
+func TestMinerMetrics_Dialed(t *testing.T) {
+	m := newMinerMetrics()
+	m.dialed("a:3336", errors.New("connection refused"))
+	m.dialed("a:3336", nil)
+	m.dialed("b:3336", nil)
+
+	got := scrape(t, m)
+	for _, want := range []string{
+		`miner_connection_attempts_total{endpoint="a:3336"} 2`,
+		`miner_connection_attempts_total{endpoint="b:3336"} 1`,
+		`miner_connection_failures_total{endpoint="a:3336"} 1`,
+		`miner_session_state{state="connecting"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `miner_connection_failures_total{endpoint="b:3336"}`) {
+		t.Errorf("metrics = %s, want no failures of b:3336", got)
+	}
+}
+
+func TestMinerMetrics_Nil(t *testing.T) {
+	var m *minerMetrics
+	m.setState(statePOW)
+	m.received("HELO")
+	m.dialed("a:3336", nil)
+	m.powStarted(9)
+	m.powEnded()
+	m.watch(&Miner{})
+	m.close()
+}
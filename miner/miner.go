@@ -1,31 +1,57 @@
 package miner
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"net/textproto"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/MihaiLupoiu/interview-exasol/admin"
 	"github.com/MihaiLupoiu/interview-exasol/connection"
+	"github.com/MihaiLupoiu/interview-exasol/coordinator"
+	"github.com/MihaiLupoiu/interview-exasol/dashboard"
+	"github.com/MihaiLupoiu/interview-exasol/events"
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+	"github.com/MihaiLupoiu/interview-exasol/pki"
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+	"github.com/MihaiLupoiu/interview-exasol/stratum"
+	"github.com/MihaiLupoiu/interview-exasol/utils"
 	"github.com/MihaiLupoiu/interview-exasol/worker"
+	"github.com/google/uuid"
 	"github.com/paulbellamy/ratecounter"
 )
 
 // Miner has all the basic information to start the search for the SHA1
 type Miner struct {
-	Authdata   string
-	Conn       *connection.Connection
-	Counter    *ratecounter.RateCounter
-	UserConfig UserConfig
-	WPool      worker.Pool
-	incoming   chan string
-	outcoming  chan string
+	Authdata    string
+	Conn        *connection.Connection
+	Counter     *ratecounter.RateCounter
+	UserConfig  UserConfig
+	WPool       worker.Pool
+	Coordinator *coordinator.Coordinator
+	Stratum     *stratum.Server
+	Retry       retry.Policy
+	newPool     func() worker.Pool
+	diagnostics string
+	output      string
+	events      *events.Stream
+	metrics     *minerMetrics
+	dashboard   *dashboard.Dashboard
+	status      status
+	admin       net.Listener
+	// hashes is the number of hashes attempted by the workers.
+	hashes *uint64
+	// poolMu guards WPool while it is replaced, for the metrics and the admin API used from
+	// other gorutines, and the controls of the admin API applied to every new pool.
+	poolMu   sync.Mutex
+	controls controls
 }
 
 var (
@@ -34,177 +60,623 @@ var (
 )
 
 // connect creates the TLS connection required to the server in order to process the work.
-func connect(configuration Data) (*connection.Connection, error) {
-	conn, err := connection.Dial(configuration.Crt, configuration.Key, configuration.Endpoint)
+// The attempts to connect are counted in the metrics.
+func connect(configuration Data, m *minerMetrics) (*connection.Connection, error) {
+	var opts []connection.FailoverOption
+	if m != nil {
+		opts = append(opts, connection.WithObserver(m.dialed))
+	}
+	if configuration.Parallel {
+		opts = append(opts, connection.WithParallel(connection.DefaultParallelDelay))
+	}
+	proxy := connection.ProxyFunc(connection.ProxyFromEnvironment)
+	if configuration.Proxy != "" {
+		u, err := connection.ParseProxy(configuration.Proxy)
+		if err != nil {
+			logger.Error("invalid proxy", logging.KeyError, err)
+			return nil, err
+		}
+		proxy = connection.FixedProxy(u)
+	}
+	opts = append(opts, connection.WithProxy(proxy))
+	if configuration.KeyLog != "" {
+		keyLog, err := os.OpenFile(configuration.KeyLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			logger.Error("failed to open the key log", logging.KeyError, err)
+			return nil, err
+		}
+		logger.Warn("the TLS secrets are written to the key log, anyone with it can decrypt the traffic", "file", configuration.KeyLog)
+		opts = append(opts, connection.WithKeyLog(keyLog))
+	}
+	conn, err := connection.DialEndpoints(configuration.Credentials, configuration.Endpoints, configuration.Verify, opts...)
 	if err != nil {
-		log.Fatalf("failed to connect: %s", err.Error())
+		logger.Error("failed to connect", logging.KeyError, err)
+		if configuration.Diagnostics != "" {
+			reportFailure(err, configuration.Diagnostics, diagnosticsOutput(configuration.Output))
+		}
 		return nil, err
 	}
 
-	log.Printf("connect to %s succeed", configuration.Endpoint)
-	conn.PrintConnState()
+	logger.Info("connected", logging.KeyEndpoint, conn.Endpoint())
+	report(conn, configuration.Diagnostics, diagnosticsOutput(configuration.Output))
 
 	return conn, err
 }
 
+// report prints the diagnostics of the connection in the format to out, or logs its state
+// when the diagnostics mode is off.
+func report(conn *connection.Connection, format string, out io.Writer) {
+	if format == "" {
+		conn.PrintConnState()
+		return
+	}
+	if err := conn.Diagnose().Write(out, format); err != nil {
+		logger.Warn("failed to write the diagnostics", logging.KeyError, err)
+	}
+}
+
+// reportFailure prints in the format to out the diagnostics of the endpoints of a dial that
+// failed during the handshake.
+func reportFailure(err error, format string, out io.Writer) {
+	var dialErr *connection.DialError
+	if !errors.As(err, &dialErr) {
+		return
+	}
+	for _, e := range dialErr.Errors {
+		if e.Report == nil {
+			continue
+		}
+		if err := e.Report.Write(out, format); err != nil {
+			logger.Warn("failed to write the diagnostics", logging.KeyError, err)
+		}
+	}
+}
+
+// setLoggers gives the packages used by the miner their loggers. The contact information
+// of the user is masked unless UnsafeLogPII is set.
+func setLoggers(configuration Data) error {
+	config := configuration.Log
+	if !configuration.UnsafeLogPII {
+		masker, err := logging.NewMasker(configuration.PIIMask)
+		if err != nil {
+			return err
+		}
+		config.Redact = newPIIRedactor(configuration.UserConfig, masker).Redact
+	}
+	return logging.Inject(config, map[string]func(logging.Logger){
+		"connection":  connection.SetLogger,
+		"admin":       admin.SetLogger,
+		"coordinator": coordinator.SetLogger,
+		"dashboard":   dashboard.SetLogger,
+		"miner":       SetLogger,
+		"retry":       retry.SetLogger,
+		"stratum":     stratum.SetLogger,
+		"utils":       utils.SetLogger,
+		"worker":      worker.SetLogger,
+	})
+}
+
 // Init miner with configuration with connection data and user information.
 func Init(configuration Data) (*Miner, error) {
-	conn, err := connect(configuration)
+	if err := setLoggers(configuration); err != nil {
+		return nil, err
+	}
+	if err := configuration.UserConfig.Validate(); err != nil {
+		return nil, err
+	}
+	var stream *events.Stream
+	switch configuration.Output {
+	case "", OutputText:
+	case OutputJSON:
+		stream = events.NewStream(os.Stdout)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOutput, configuration.Output)
+	}
+	var coord *coordinator.Coordinator
+	if configuration.Coordinator != "" {
+		opts := []coordinator.Option{coordinator.WithLedger(configuration.Ledger)}
+		if configuration.PKI != "" {
+			tlsConfig, err := connection.MutualTLSServerConfig(
+				filepath.Join(configuration.PKI, pki.CoordinatorCertFile),
+				filepath.Join(configuration.PKI, pki.CoordinatorKeyFile),
+				filepath.Join(configuration.PKI, pki.CAFile),
+				filepath.Join(configuration.PKI, pki.CRLFile))
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, coordinator.WithTLS(tlsConfig))
+		}
+
+		var err error
+		coord, err = coordinator.Listen(configuration.Coordinator, coordinator.DefaultRangeSize, opts...)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("waiting for hash workers", "addr", coord.Addr())
+		go coord.Serve()
+	}
+
+	var pool *stratum.Server
+	if configuration.Stratum != "" {
+		var err error
+		pool, err = stratum.Listen(configuration.Stratum, stratum.WithShareDifficulty(configuration.ShareDiff))
+		if err != nil {
+			release(coord, nil, nil)
+			return nil, err
+		}
+		logger.Info("waiting for mining clients", "addr", pool.Addr())
+		go pool.Serve()
+	}
+
+	var m *minerMetrics
+	if configuration.Metrics != "" {
+		m = newMinerMetrics()
+		if err := m.serve(configuration.Metrics); err != nil {
+			release(coord, pool, nil)
+			return nil, err
+		}
+	}
+
+	conn, err := connect(configuration, m)
 	if err != nil {
+		release(coord, pool, m)
+		stream.Emit(events.Event{Type: events.Error, Error: &events.ErrorInfo{Message: err.Error()}})
 		return nil, err
 	}
-	return &Miner{
-		Authdata:   "",
-		Conn:       conn,
-		Counter:    ratecounter.NewRateCounter(1 * time.Second),
-		UserConfig: configuration.UserConfig,
-		WPool:      worker.New(configuration.Workers),
-		incoming:   make(chan string, 1),
-		outcoming:  make(chan string, 1),
-	}, err
+	stream.Emit(events.Event{Type: events.Connected, Endpoint: conn.Endpoint()})
+
+	policy := retry.DefaultPolicy()
+	policy.MaxAttempts = configuration.RetryAttempts
+	policy.MaxElapsed = configuration.RetryMaxElapsed
+	newPool := func() worker.Pool {
+		return worker.New(configuration.Workers, worker.WithMode(worker.RaceFirst), worker.WithPanicPolicy(worker.PanicRestart))
+	}
+	miner := &Miner{
+		Authdata:    "",
+		Conn:        conn,
+		Counter:     ratecounter.NewRateCounter(1 * time.Second),
+		UserConfig:  configuration.UserConfig,
+		WPool:       newPool(),
+		Coordinator: coord,
+		Stratum:     pool,
+		Retry:       policy,
+		newPool:     newPool,
+		diagnostics: configuration.Diagnostics,
+		output:      configuration.Output,
+		events:      stream,
+		metrics:     m,
+		hashes:      new(uint64),
+	}
+	m.watch(miner)
+	switch {
+	case stream != nil:
+		// The progress is written as events, stdout only has the events.
+		miner.dashboard = dashboard.New(os.Stdout, miner.snapshot, dashboard.WithInterval(configuration.StatusInterval), dashboard.WithReporter(miner.emitProgress))
+	case configuration.Dashboard:
+		miner.dashboard = dashboard.New(os.Stdout, miner.snapshot, dashboard.WithInterval(configuration.StatusInterval))
+	}
+	if configuration.Admin != "" {
+		miner.admin, err = admin.Listen(configuration.Admin, controller{miner})
+		if err != nil {
+			conn.Close()
+			release(coord, pool, m)
+			return nil, err
+		}
+		logger.Info("serving the admin API", "socket", configuration.Admin)
+	}
+	return miner, err
+}
+
+// release closes the listeners opened by Init before it failed, the ones not opened are nil.
+func release(coord *coordinator.Coordinator, pool *stratum.Server, m *minerMetrics) {
+	if coord != nil {
+		coord.Close()
+	}
+	if pool != nil {
+		pool.Close()
+	}
+	m.close()
+}
+
+// pool returns the worker pool of the current session.
+func (ctx *Miner) pool() worker.Pool {
+	ctx.poolMu.Lock()
+	defer ctx.poolMu.Unlock()
+	return ctx.WPool
 }
 
 // Run miner will connect to the server, initialize the workers when request POW is received and
-// start to search for the SHA1 with the given difficulty.
+// start to search for the SHA1 with the given difficulty. The server only records the data of a
+// session that reaches END, so when the connection drops before it, the session is restarted from
+// HELO in a new connection following the retry policy.
 func (ctx *Miner) Run() error {
 	defer ctx.Conn.Close()
+	defer ctx.metrics.close()
+	if ctx.dashboard != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go ctx.dashboard.Run(stop)
+	}
+	if ctx.Coordinator != nil {
+		defer ctx.Coordinator.Close()
+	}
+	if ctx.Stratum != nil {
+		defer ctx.Stratum.Close()
+	}
 
-	precessingInterval := time.Hour * time.Duration(2)
-	respondInterval := time.Second * time.Duration(6)
+	if ctx.admin != nil {
+		defer ctx.admin.Close()
+	}
 
-	t := time.NewTimer(time.Hour)
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx.poolMu.Lock()
+	ctx.controls.cancel = cancel
+	ctx.poolMu.Unlock()
+
+	// The failures are written as events once the retry decided, the last one is not retried.
+	err := retry.DoNotify(runCtx, ctx.Retry, func(attempt int) error {
+		if attempt > 1 {
+			logger.Info("reconnecting to the server", "attempt", attempt)
+			ctx.setState(stateConnecting)
+			if err := ctx.Conn.Reconnecte(); err != nil {
+				if ctx.diagnostics != "" {
+					reportFailure(err, ctx.diagnostics, diagnosticsOutput(ctx.output))
+				}
+				ctx.setState(stateFailed)
+				return err
+			}
+			logger.Info("connected", logging.KeyEndpoint, ctx.Conn.Endpoint())
+			ctx.emit(events.Event{Type: events.Connected, Endpoint: ctx.Conn.Endpoint()})
+			if ctx.diagnostics != "" {
+				report(ctx.Conn, ctx.diagnostics, diagnosticsOutput(ctx.output))
+			}
+			// The pool of the previous session was stopped with it.
+			ctx.poolMu.Lock()
+			ctx.WPool = ctx.newPool()
+			ctx.controls.apply(ctx.WPool)
+			ctx.poolMu.Unlock()
+		}
+		err := ctx.session(runCtx)
+		if err != nil {
+			ctx.setState(stateFailed)
+		}
+		return err
+	}, func(err error, wait time.Duration) {
+		ctx.emitError(err, true)
+	})
+	if err != nil {
+		ctx.emitError(err, false)
+	}
+	if err != nil && runCtx.Err() != nil {
+		return ErrCanceled
+	}
+	return err
+}
 
-	go ctx.readConnData()
+// session answers the commands of the server in the current connection until END. It
+// returns a permanent error when the server sends ERROR, because retrying sends the same data.
+// The time to answer each command is limited by the deadlines of the connection.
+func (ctx *Miner) session(runCtx context.Context) error {
+	sessionCtx, cancel := context.WithCancel(runCtx)
+	incoming := make(chan string)
+	outcoming := make(chan string, 1)
+	readErr := make(chan error, 1)
+
+	// Stop the search and the reader of the session before the connection is replaced.
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		ctx.Conn.Close()
+		wg.Wait()
+	}()
+
+	sessionID := uuid.New().String()
+	sessionLog := logger.With(logging.KeySession, sessionID, logging.KeyEndpoint, ctx.Conn.Endpoint())
+	sessionLog.Info("session started")
+	ctx.started(sessionID, ctx.Conn.Endpoint())
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx.readConnData(sessionCtx, incoming, readErr)
+	}()
 	for {
 		select {
-		case line := <-ctx.incoming:
-			log.Println(line)
+		case line := <-incoming:
 			args := strings.Fields(line)
-			t.Reset(respondInterval)
+			sessionLog.Info("received", logging.KeyCommand, args[0])
+			ctx.received(args[0])
+			ctx.emit(events.Event{Type: events.Command, Command: args[0]})
+			sessionLog.Debug("received line", logging.KeyCommand, args[0], "line", line)
 
+			var err error
 			switch args[0] {
 			case "HELO":
-				ctx.Conn.WriteString("EHLO")
+				_, err = ctx.Conn.WriteString("EHLO")
 			case "END":
 				// if you get this command, then your data was submitted
-				ctx.Conn.WriteString("OK")
-				os.Exit(0)
+				if _, err := ctx.Conn.WriteString("OK"); err != nil {
+					return writeError(err)
+				}
+				ctx.setState(stateDone)
+				ctx.emit(events.Event{Type: events.End})
+				return nil
 
 			// the rest of the data server requests are required to identify you
 			// and get basic contact information
 			case "NAME":
 				// as the response to the NAME request you should send your full name
 				// including first and last name separated by single space
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Name)
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Name)
 
 			case "MAILNUM":
 				// here you specify, how many email addresses you want to send
 				// each email is asked separately up to the number specified in MAILNUM
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], strconv.Itoa(len(ctx.UserConfig.Mails)))
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], strconv.Itoa(len(ctx.UserConfig.Mails)))
 
 			case "MAIL1":
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Mails[0])
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Mails[0])
 
 			case "MAIL2":
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Mails[1])
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Mails[1])
 
 			case "SKYPE":
 				// here please specify your Skype account for the interview, or N/A
 				// in case you have no Skype account
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Skype)
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Skype)
 
 			case "BIRTHDATE":
 				// here please specify your birthdate in the format %d.%m.%Y
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.BirthDate)
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.BirthDate)
 
 			case "COUNTRY":
 				// country where you currently live and where the specified address is
 				// please use only the names from this web site:
 				//   https://www.countries-ofthe-world.com/all-countries.html
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Country)
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Country)
 
 			case "ADDRNUM":
 				// specifies how many lines your address has, this address should
 				// be in the specified country
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], strconv.Itoa(len(ctx.UserConfig.Address)))
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], strconv.Itoa(len(ctx.UserConfig.Address)))
 
 			case "ADDRLINE1":
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Address[0])
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Address[0])
 
 			case "ADDRLINE2":
-				ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Address[1])
+				_, err = ctx.Conn.WriteSHA1String(ctx.Authdata, args[1], ctx.UserConfig.Address[1])
 
 			case "POW":
-				log.Println("Searching for HASH:")
-				t.Reset(precessingInterval)
-				go ctx.pow(line)
+				if len(args) < 3 {
+					return retry.Permanent(fmt.Errorf("invalid POW command: %q", line))
+				}
+				difficulty, err := strconv.Atoi(args[2])
+				if err != nil {
+					return retry.Permanent(fmt.Errorf("difficulty of POW not integer: %w", err))
+				}
+				authdata := args[1]
+				ctx.Authdata = authdata
+				sessionLog.Info("searching for the suffix", logging.KeyCommand, args[0], "difficulty", difficulty)
+				ctx.powStarted(authdata, difficulty)
+				ctx.emit(events.Event{Type: events.POWStarted, POW: &events.POW{Authdata: authdata, Difficulty: difficulty}})
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ctx.pow(sessionCtx, sessionLog, authdata, difficulty, outcoming)
+				}()
 			case "ERROR":
-				return errors.New(line)
+				return retry.Permanent(errors.New(line))
 			default:
-				log.Println("Unkown command")
-				return errors.New("unkown command")
+				sessionLog.Error("unknown command", logging.KeyCommand, args[0])
+				return retry.Permanent(errors.New("unkown command"))
+			}
+			if err != nil {
+				return writeError(err)
 			}
-		case suff := <-ctx.outcoming:
-			ctx.Conn.WriteString(suff)
-		case <-t.C:
-			return errors.New("time expired")
+			switch args[0] {
+			case "HELO":
+				ctx.emit(events.Event{Type: events.Handshake, Endpoint: ctx.Conn.Endpoint()})
+			case "POW":
+			default:
+				ctx.emit(events.Event{Type: events.FieldSent, Command: args[0]})
+			}
+		case suff := <-outcoming:
+			if _, err := ctx.Conn.WriteString(suff); err != nil {
+				return writeError(err)
+			}
+			ctx.setState(stateAnswering)
+			ctx.emit(events.Event{Type: events.POWSolved, Suffix: suff})
+		case <-runCtx.Done():
+			return retry.Permanent(ErrCanceled)
+		case err := <-readErr:
+			if protocolError(err) {
+				// The server broke the framing, a new session gets the same lines.
+				return retry.Permanent(fmt.Errorf("invalid line from the server: %w", err))
+			}
+			return fmt.Errorf("connection dropped: %w", err)
 		}
 	}
 }
 
-func (ctx *Miner) readConnData() {
-	connReader := textproto.NewReader(bufio.NewReader(ctx.Conn))
+// protocolError is true for the errors of lines that break the framing of the protocol.
+func protocolError(err error) bool {
+	var field *connection.FieldError
+	return errors.As(err, &field) || errors.Is(err, connection.ErrLineTooLong) ||
+		errors.Is(err, connection.ErrInvalidUTF8) || errors.Is(err, connection.ErrNewline)
+}
+
+// writeError returns the error of a write to the server. The ones of the framing are
+// permanent, retrying sends the same data.
+func writeError(err error) error {
+	if protocolError(err) {
+		return retry.Permanent(fmt.Errorf("not sent: %w", err))
+	}
+	return fmt.Errorf("connection dropped: %w", err)
+}
 
+func (ctx *Miner) readConnData(sessionCtx context.Context, incoming chan<- string, readErr chan<- error) {
 	for {
 		// read one line (ended with \n or \r\n)
-		line, err := connReader.ReadLine()
+		line, err := ctx.Conn.ReadLine()
 		if err != nil {
-			fmt.Printf("incoming error: %v\n", err)
+			logger.Debug("read failed", logging.KeyError, err)
+			readErr <- err
 			return
 		}
 
 		if len(line) > 0 {
-			fmt.Println(line)
-			ctx.incoming <- line
+			select {
+			case incoming <- line:
+			case <-sessionCtx.Done():
+				return
+			}
 		}
 	}
 }
 
-func (ctx *Miner) pow(line string) {
-	args := strings.Fields(line)
+// solution is the result of one of the searches of the POW.
+type solution struct {
+	suffix string
+	err    error
+}
 
-	stop := make(chan bool, 1)
-	defer close(stop)
-	// go utils.HashRate(ctx.Counter, stop)
+// search looks for the suffix with the remote hash workers in coordinator mode, or
+// with the worker pool otherwise. The pool and the feed of its jobs end before it returns.
+func (ctx *Miner) search(minerCtx context.Context, pool worker.Pool, authdata string, difficulty int) (string, error) {
+	if ctx.Coordinator != nil {
+		// Only the remote hash workers search in coordinator mode.
+		return ctx.Coordinator.Solve(minerCtx, authdata, difficulty)
+	}
 
-	ctx.Authdata = args[1]
-	difficulty, err := strconv.Atoi(args[2])
-	if err != nil {
-		log.Fatalf("Difficulty of POW not integer: %s", err.Error())
+	searchCtx, cancel := context.WithCancel(minerCtx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// Start workers
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pool.Run(searchCtx)
+	}()
+
+	jobs := GenerateWorkerJobs(pool.GetWorkerCount(), difficulty, minRandomStringLength, maxRandomStringLength, authdata, ctx.Counter, ctx.hashes)
+	grow := make(chan struct{}, 1)
+	ctx.searching(jobHashes(jobs), grow)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx.feed(searchCtx, pool, jobs, authdata, difficulty, grow)
+	}()
+
+	suff, err := GetResults(pool)
+	logger.Info("worker pool", "stats", pool.Stats())
+	return suff, err
+}
+
+// feed sends the jobs of the search to the pool, and a new job for each worker added to
+// the pool beyond them, until the search ends. The search of a job only ends with the
+// suffix, so each worker needs its own.
+func (ctx *Miner) feed(minerCtx context.Context, pool worker.Pool, jobs []worker.Job, authdata string, difficulty int, grow chan struct{}) {
+	// Closes the jobs of the pool.
+	defer pool.SendBulkJobs(nil)
+
+	for _, job := range jobs {
+		if pool.SendJobContext(minerCtx, job) != nil {
+			return
+		}
+	}
+	counters := jobHashes(jobs)
+	for {
+		select {
+		case <-minerCtx.Done():
+			return
+		case <-grow:
+		}
+		more := pool.GetWorkerCount() - len(counters)
+		if more <= 0 {
+			continue
+		}
+		added := GenerateWorkerJobs(more, difficulty, minRandomStringLength, maxRandomStringLength, authdata, ctx.Counter, ctx.hashes)
+		for i := range added {
+			added[i].ID = strconv.Itoa(len(counters) + i)
+			if pool.SendJobContext(minerCtx, added[i]) != nil {
+				return
+			}
+		}
+		counters = append(counters, jobHashes(added)...)
+		ctx.searching(counters, grow)
+		logger.Info("jobs added for the new workers", "jobs", len(counters))
+	}
+}
+
+// logShares prints the shares of every mining client and warns about the ones that
+// report more hashrate than their shares explain.
+func (ctx *Miner) logShares() {
+	for _, c := range ctx.Stratum.Clients() {
+		logger.Info("mining client shares", logging.KeySession, c.Session, "name", c.Name, "shares", c.Shares, "rejected", c.Rejected,
+			"reported_hps", int64(c.ReportedHashrate), "estimated_hps", int64(c.EstimatedHashrate))
+		if c.Suspicious {
+			logger.Warn("mining client reports a hashrate its shares do not explain", logging.KeySession, c.Session, "name", c.Name)
+		}
 	}
-	fmt.Println("Authdata: ", ctx.Authdata, "Dificulty: ", difficulty)
+}
+
+// pow searches the suffix of the authdata and sends it to outcoming. The searches end
+// before it returns.
+func (ctx *Miner) pow(sessionCtx context.Context, sessionLog logging.Logger, authdata string, difficulty int, outcoming chan<- string) {
+	defer ctx.powEnded()
+
+	var err error
 
 	// create context fro workerPool
-	minerCtx, cancelWorkerPool := context.WithTimeout(context.Background(), time.Hour*2)
+	minerCtx, cancelWorkerPool := context.WithTimeout(sessionCtx, time.Hour*2)
 	defer cancelWorkerPool()
 
-	// Start workers
-	go ctx.WPool.Run(minerCtx)
-
-	jobs := GenerateWorkerJobs(ctx.WPool.GetWorkerCount(), difficulty, minRandomStringLength, maxRandomStringLength, ctx.Authdata, ctx.Counter)
-	go ctx.WPool.SendBulkJobs(jobs)
+	// The mining clients search at the same time as the workers, the first suffix wins.
+	found := make(chan solution, 2)
+	var searches sync.WaitGroup
+	pool := ctx.pool()
+	searches.Add(1)
+	go func() {
+		defer searches.Done()
+		suff, err := ctx.search(minerCtx, pool, authdata, difficulty)
+		found <- solution{suff, err}
+	}()
+	n := 1
+	if ctx.Stratum != nil {
+		n++
+		searches.Add(1)
+		go func() {
+			defer searches.Done()
+			suff, err := ctx.Stratum.Solve(minerCtx, authdata, difficulty)
+			found <- solution{suff, err}
+		}()
+	}
 
-	suff, err := GetResults(ctx.WPool)
+	var suff string
+	for i := 0; i < n && suff == ""; i++ {
+		res := <-found
+		suff, err = res.suffix, res.err
+	}
+	cancelWorkerPool()
+	searches.Wait()
+	if ctx.Stratum != nil {
+		ctx.logShares()
+	}
 	if err == context.DeadlineExceeded {
-		fmt.Println("Dedline reached: ", err.Error())
+		sessionLog.Warn("deadline of the POW reached", logging.KeyError, err)
 	}
 
 	if err == nil && suff != "" {
-		fmt.Println("Suff: ", suff)
+		sessionLog.Info("suffix found", "suffix", suff)
 		// ctx.Conn.WriteString(suff)
-		ctx.outcoming <- suff
+		select {
+		case outcoming <- suff:
+		case <-sessionCtx.Done():
+		}
 	}
-
-	// Stop goroutine hashRate
-	stop <- true
 }
@@ -0,0 +1,261 @@
+package miner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/connection"
+	"github.com/MihaiLupoiu/interview-exasol/pki"
+	"github.com/MihaiLupoiu/interview-exasol/retry"
+	"github.com/MihaiLupoiu/interview-exasol/worker"
+)
+
+// script is what a fake server does in one connection.
+type script func(conn net.Conn, r *bufio.Reader)
+
+// fakeServer runs the scripts in the connections it accepts, one per connection. It
+// returns its address and a function that stops it and returns how many connections it accepted.
+func fakeServer(t *testing.T, scripts ...script) (string, func() int) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := pki.Init(dir, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	cert, err := connection.LoadCertificate(filepath.Join(dir, pki.CoordinatorCertFile), filepath.Join(dir, pki.CoordinatorKeyFile))
+	if err != nil {
+		t.Fatalf("LoadCertificate() error = %v", err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := make(chan int, 1)
+	go func() {
+		n := 0
+		defer func() { accepted <- n }()
+		for _, run := range scripts {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			n++
+			conn.(*tls.Conn).Handshake()
+			run(conn, bufio.NewReader(conn))
+			conn.Close()
+		}
+	}()
+	stop := func() int {
+		listener.Close()
+		return <-accepted
+	}
+	return listener.Addr().String(), stop
+}
+
+// expect reads a line from the miner and fails if it is not the expected one.
+func expect(t *testing.T, conn net.Conn, r *bufio.Reader, want string) {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	line, err := r.ReadString('\n')
+	if err != nil || line != want+"\n" {
+		t.Errorf("miner sent %q, %v; want %q", line, err, want)
+	}
+}
+
+func newTestMiner(t *testing.T, endpoint string) *Miner {
+	t.Helper()
+	dir := t.TempDir()
+	if err := pki.Init(dir, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	certFile, keyFile, err := pki.IssueWorker(dir, "miner")
+	if err != nil {
+		t.Fatalf("IssueWorker() error = %v", err)
+	}
+	conn, err := connection.DialEndpoints(connection.Credentials{CertFile: certFile, KeyFile: keyFile}, []string{endpoint}, connection.Verification{Insecure: true})
+	if err != nil {
+		t.Fatalf("DialEndpoints() error = %v", err)
+	}
+
+	newPool := func() worker.Pool { return worker.New(1, worker.WithMode(worker.RaceFirst)) }
+	return &Miner{
+		Conn:    conn,
+		WPool:   newPool(),
+		newPool: newPool,
+		Retry:   retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 3},
+	}
+}
+
+func TestMiner_RunRestartsSessionWhenConnectionDrops(t *testing.T) {
+	addr, stop := fakeServer(t,
+		func(conn net.Conn, r *bufio.Reader) {
+			conn.Write([]byte("HELO\n"))
+			expect(t, conn, r, "EHLO")
+		},
+		func(conn net.Conn, r *bufio.Reader) {
+			conn.Write([]byte("HELO\n"))
+			expect(t, conn, r, "EHLO")
+			conn.Write([]byte("END\n"))
+			expect(t, conn, r, "OK")
+		},
+	)
+
+	m := newTestMiner(t, addr)
+	if err := m.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if n := stop(); n != 2 {
+		t.Errorf("server accepted %d connections, want 2", n)
+	}
+}
+
+func TestMiner_RunDoesNotRetryServerErrors(t *testing.T) {
+	addr, stop := fakeServer(t,
+		func(conn net.Conn, r *bufio.Reader) {
+			conn.Write([]byte("HELO\n"))
+			expect(t, conn, r, "EHLO")
+			conn.Write([]byte("ERROR invalid data\n"))
+			r.ReadString('\n')
+		},
+		func(conn net.Conn, r *bufio.Reader) {
+			t.Errorf("miner reconnected after ERROR")
+		},
+	)
+
+	m := newTestMiner(t, addr)
+	err := m.Run()
+	if err == nil || retry.Retryable(err) {
+		t.Errorf("Run() error = %v, want a permanent error", err)
+	}
+	if n := stop(); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestMiner_RunDoesNotRetryInvalidLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		config UserConfig
+	}{
+		{name: "invalid UTF-8 from the server", line: "NAME \xff\n"},
+		{name: "line too long from the server", line: "NAME " + strings.Repeat("a", connection.DefaultMaxLineSize) + "\n"},
+		{name: "newline in the answer", line: "NAME abc\n", config: UserConfig{Name: "My name\nEND"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, stop := fakeServer(t,
+				func(conn net.Conn, r *bufio.Reader) {
+					conn.Write([]byte("HELO\n"))
+					expect(t, conn, r, "EHLO")
+					conn.Write([]byte(tt.line))
+					r.ReadString('\n')
+				},
+				func(conn net.Conn, r *bufio.Reader) {
+					t.Errorf("miner reconnected after an invalid line")
+				},
+			)
+
+			m := newTestMiner(t, addr)
+			m.UserConfig = tt.config
+			err := m.Run()
+			if err == nil || retry.Retryable(err) {
+				t.Errorf("Run() error = %v, want a permanent error", err)
+			}
+			if n := stop(); n != 1 {
+				t.Errorf("server accepted %d connections, want 1", n)
+			}
+		})
+	}
+}
+
+func TestUserConfig_Validate(t *testing.T) {
+	valid := UserConfig{Name: "My name", Mails: []string{"my.name@example.com"}, Country: "Germany", Address: []string{"Long street 3"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	invalid := valid
+	invalid.Address = []string{"Long street 3", "32345 Big city\r\n"}
+	var field *connection.FieldError
+	if err := invalid.Validate(); !errors.As(err, &field) || field.Field != "Address[1]" {
+		t.Errorf("Validate() error = %v, want a FieldError of Address[1]", err)
+	}
+}
+
+func TestMiner_RunGivesUpAfterMaxAttempts(t *testing.T) {
+	drop := func(conn net.Conn, r *bufio.Reader) {}
+	addr, _ := fakeServer(t, drop, drop, drop, drop)
+
+	m := newTestMiner(t, addr)
+	err := m.Run()
+	var exhausted *retry.ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 3 {
+		t.Errorf("Run() error = %v, want to give up after 3 attempts", err)
+	}
+}
+
+func TestInit_ClosesListenersOnError(t *testing.T) {
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	coordinatorAddr := free.Addr().String()
+	free.Close()
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer taken.Close()
+
+	if _, err := Init(Data{Coordinator: coordinatorAddr, Stratum: taken.Addr().String()}); err == nil {
+		t.Fatalf("Init() with the Stratum address in use error = nil")
+	}
+	listener, err := net.Listen("tcp", coordinatorAddr)
+	if err != nil {
+		t.Fatalf("coordinator listener left open after Init failed: %v", err)
+	}
+	listener.Close()
+}
+
+func TestConnect_ReportsFailedHandshake(t *testing.T) {
+	addr, stop := fakeServer(t, func(conn net.Conn, r *bufio.Reader) {})
+	defer stop()
+	dir := t.TempDir()
+	if err := pki.Init(dir, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	certFile, keyFile, err := pki.IssueWorker(dir, "miner")
+	if err != nil {
+		t.Fatalf("IssueWorker() error = %v", err)
+	}
+
+	// The CA of the fake server is not trusted by the system.
+	_, err = connect(Data{
+		Credentials: connection.Credentials{CertFile: certFile, KeyFile: keyFile},
+		Endpoints:   []string{addr},
+		Diagnostics: connection.FormatJSON,
+		Output:      OutputJSON,
+	}, nil)
+	if err == nil {
+		t.Fatalf("connect() to an untrusted server error = nil")
+	}
+
+	var b bytes.Buffer
+	reportFailure(err, connection.FormatJSON, &b)
+	var report connection.Report
+	if err := json.Unmarshal(b.Bytes(), &report); err != nil {
+		t.Fatalf("diagnostics %q: %v", b.String(), err)
+	}
+	if report.Endpoint != addr || report.Error == "" || len(report.Chain) == 0 {
+		t.Errorf("diagnostics = %+v, want the endpoint, the error and the chain of the server", report)
+	}
+}
@@ -0,0 +1,48 @@
+package miner
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+// answerLine is an answer to the server: the SHA1 of the authdata and the argument,
+// then the value asked, like the name or an email.
+var answerLine = regexp.MustCompile(`^([0-9a-f]{40}) (.+)$`)
+
+// minRedactedLength is the shortest value of the user config searched in the logs, shorter
+// ones would mask unrelated words. They are still masked in the answers to the server.
+const minRedactedLength = 3
+
+// piiRedactor hides the contact information of the user in the logs.
+type piiRedactor struct {
+	masker *logging.Masker
+	// values replaces the values of the user config with their masks in one pass, the
+	// longest first so a value is masked before the shorter ones it contains.
+	values *strings.Replacer
+}
+
+// newPIIRedactor returns the redactor of the values of the user config.
+func newPIIRedactor(user UserConfig, masker *logging.Masker) *piiRedactor {
+	values := append([]string{user.Name, user.Skype, user.BirthDate, user.Country}, user.Mails...)
+	values = append(values, user.Address...)
+	sort.SliceStable(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var oldnew []string
+	for _, value := range values {
+		if len(value) >= minRedactedLength {
+			oldnew = append(oldnew, value, masker.Mask(value))
+		}
+	}
+	return &piiRedactor{masker: masker, values: strings.NewReplacer(oldnew...)}
+}
+
+// Redact masks the value of an answer to the server, and the values of the user config
+// anywhere else.
+func (r *piiRedactor) Redact(s string) string {
+	if m := answerLine.FindStringSubmatch(s); m != nil {
+		return m[1] + " " + r.masker.Mask(m[2])
+	}
+	return r.values.Replace(s)
+}
@@ -0,0 +1,71 @@
+package miner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+func TestPIIRedactor_Redact(t *testing.T) {
+	user := UserConfig{
+		Name:      "John Smith",
+		Mails:     []string{"john@example.com", "js@example.org"},
+		Skype:     "N/A",
+		BirthDate: "01.02.1990",
+		Country:   "Germany",
+		Address:   []string{"Long street 3", "12345 Berlin"},
+	}
+	tests := []struct {
+		name string
+		mode string
+		in   string
+		want string
+	}{
+		{name: "answer", mode: logging.MaskFull, in: "6a1b2c3d4e5f60718293a4b5c6d7e8f901234567 John Smith", want: "6a1b2c3d4e5f60718293a4b5c6d7e8f901234567 [REDACTED]"},
+		{name: "answer not in config", mode: logging.MaskPartial, in: "6a1b2c3d4e5f60718293a4b5c6d7e8f901234567 other@example.net", want: "6a1b2c3d4e5f60718293a4b5c6d7e8f901234567 o***@example.net"},
+		{name: "value in text", mode: logging.MaskPartial, in: "failed to send john@example.com: broken pipe", want: "failed to send j***@example.com: broken pipe"},
+		{name: "longest value first", mode: logging.MaskPartial, in: "lives in 12345 Berlin, Germany", want: "lives in 1*** B***, G***"},
+		{name: "command", mode: logging.MaskFull, in: "NAME abcdef", want: "NAME abcdef"},
+		{name: "short values", mode: logging.MaskFull, in: "N/A", want: "[REDACTED]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masker, err := logging.NewMasker(tt.mode)
+			if err != nil {
+				t.Fatalf("NewMasker() error = %v", err)
+			}
+			if got := newPIIRedactor(user, masker).Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLoggers_MasksContactInformation(t *testing.T) {
+	t.Cleanup(func() { setLoggers(Data{}) })
+	tests := []struct {
+		name   string
+		data   Data
+		wantIn string
+	}{
+		{name: "default", data: Data{}, wantIn: "[REDACTED]"},
+		{name: "partial", data: Data{PIIMask: logging.MaskPartial}, wantIn: "j***@example.com"},
+		{name: "unsafe", data: Data{UnsafeLogPII: true}, wantIn: "john@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			tt.data.Log.Output = &b
+			tt.data.UserConfig = UserConfig{Mails: []string{"john@example.com"}}
+			if err := setLoggers(tt.data); err != nil {
+				t.Fatalf("setLoggers() error = %v", err)
+			}
+			logger.Info("sent", "line", "6a1b2c3d4e5f60718293a4b5c6d7e8f901234567 john@example.com")
+			if !strings.Contains(b.String(), tt.wantIn) {
+				t.Errorf("record = %q, want %q", b.String(), tt.wantIn)
+			}
+		})
+	}
+}
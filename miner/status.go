@@ -0,0 +1,151 @@
+package miner
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/dashboard"
+)
+
+// status is the progress of the session shown in the dashboard.
+type status struct {
+	mu         sync.Mutex
+	session    string
+	endpoint   string
+	state      string
+	command    string
+	authdata   string
+	difficulty int
+	powStart   time.Time
+	// powHashes are the hashes attempted before the current POW started.
+	powHashes uint64
+	// jobs count the hashes attempted by each job of the current POW.
+	jobs []*uint64
+	// grow asks the search of the current POW for jobs for the workers added to the pool.
+	grow chan struct{}
+}
+
+// setState sets the current state of the session. A new connection has no session until
+// it is started.
+func (ctx *Miner) setState(state string) {
+	ctx.status.mu.Lock()
+	ctx.status.state = state
+	if state == stateConnecting {
+		ctx.status.session = ""
+	}
+	ctx.status.mu.Unlock()
+	ctx.metrics.setState(state)
+}
+
+// started records the start of a session in the endpoint.
+func (ctx *Miner) started(session, endpoint string) {
+	ctx.status.mu.Lock()
+	ctx.status.session = session
+	ctx.status.endpoint = endpoint
+	ctx.status.mu.Unlock()
+	ctx.setState(stateHandshake)
+}
+
+// sessionID returns the ID of the current session, empty before the first one.
+func (ctx *Miner) sessionID() string {
+	ctx.status.mu.Lock()
+	defer ctx.status.mu.Unlock()
+	return ctx.status.session
+}
+
+// received records a command of the server.
+func (ctx *Miner) received(command string) {
+	ctx.status.mu.Lock()
+	ctx.status.command = command
+	ctx.status.mu.Unlock()
+	ctx.metrics.received(command)
+}
+
+// powStarted records the start of the search of a POW.
+func (ctx *Miner) powStarted(authdata string, difficulty int) {
+	ctx.status.mu.Lock()
+	ctx.status.state = statePOW
+	ctx.status.authdata = authdata
+	ctx.status.difficulty = difficulty
+	ctx.status.powStart = time.Now()
+	ctx.status.powHashes = ctx.totalHashes()
+	ctx.status.jobs = nil
+	ctx.status.mu.Unlock()
+	ctx.metrics.powStarted(difficulty)
+}
+
+// powEnded records the end of the search of the POW.
+func (ctx *Miner) powEnded() {
+	ctx.status.mu.Lock()
+	ctx.status.powStart = time.Time{}
+	ctx.status.jobs = nil
+	ctx.status.grow = nil
+	ctx.status.mu.Unlock()
+	ctx.metrics.powEnded()
+}
+
+// searching records the jobs sent to the worker pool for the current POW, and where to ask
+// for more.
+func (ctx *Miner) searching(jobs []*uint64, grow chan struct{}) {
+	ctx.status.mu.Lock()
+	ctx.status.jobs = jobs
+	ctx.status.grow = grow
+	ctx.status.mu.Unlock()
+}
+
+// grown asks the search of the current POW, if any, for jobs for the workers added to the pool.
+func (ctx *Miner) grown() {
+	ctx.status.mu.Lock()
+	defer ctx.status.mu.Unlock()
+	if ctx.status.grow == nil {
+		return
+	}
+	select {
+	case ctx.status.grow <- struct{}{}:
+	default:
+		// A request is already pending.
+	}
+}
+
+// endpoint returns the endpoint of the current session.
+func (ctx *Miner) endpoint() string {
+	ctx.status.mu.Lock()
+	defer ctx.status.mu.Unlock()
+	return ctx.status.endpoint
+}
+
+// totalHashes returns the hashes attempted by the workers.
+func (ctx *Miner) totalHashes() uint64 {
+	if ctx.hashes == nil {
+		return 0
+	}
+	return atomic.LoadUint64(ctx.hashes)
+}
+
+// snapshot returns the status of the session for the dashboard.
+func (ctx *Miner) snapshot() dashboard.Snapshot {
+	var s dashboard.Snapshot
+	if ctx.Coordinator != nil {
+		// Only the remote hash workers search, their hashes are not counted by the miner.
+		s.Remote = true
+		s.RemoteRate = ctx.Coordinator.Hashrate()
+	}
+
+	ctx.status.mu.Lock()
+	defer ctx.status.mu.Unlock()
+	s.State = ctx.status.state
+	s.Command = ctx.status.command
+	s.Difficulty = ctx.status.difficulty
+	s.POWStart = ctx.status.powStart
+	if s.POWStart.IsZero() {
+		return s
+	}
+	s.Authdata = ctx.status.authdata
+	s.Hashes = ctx.totalHashes() - ctx.status.powHashes
+	s.Workers = make([]uint64, len(ctx.status.jobs))
+	for i, hashes := range ctx.status.jobs {
+		s.Workers[i] = atomic.LoadUint64(hashes)
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package miner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MihaiLupoiu/interview-exasol/coordinator"
+)
+
+func TestMiner_Snapshot(t *testing.T) {
+	m := &Miner{hashes: new(uint64)}
+	*m.hashes = 100
+	m.setState(stateHandshake)
+	m.received("HELO")
+	if s := m.snapshot(); s.State != stateHandshake || s.Command != "HELO" || !s.POWStart.IsZero() {
+		t.Errorf("snapshot() = %+v, want the handshake without a POW", s)
+	}
+
+	m.received("POW")
+	m.powStarted("abcdef", 9)
+	jobs := jobHashes(GenerateWorkerJobs(2, 9, 5, 64, "abcdef", nil, m.hashes))
+	m.searching(jobs, nil)
+	*jobs[0], *jobs[1] = 30, 20
+	*m.hashes += 50
+
+	s := m.snapshot()
+	if s.State != statePOW || s.Authdata != "abcdef" || s.Difficulty != 9 || s.POWStart.IsZero() {
+		t.Errorf("snapshot() = %+v, want the POW", s)
+	}
+	if s.Hashes != 50 || !reflect.DeepEqual(s.Workers, []uint64{30, 20}) {
+		t.Errorf("snapshot() hashes = %d by %v, want 50 by [30 20]", s.Hashes, s.Workers)
+	}
+
+	m.powEnded()
+	if s := m.snapshot(); !s.POWStart.IsZero() || s.Workers != nil {
+		t.Errorf("snapshot() = %+v, want no POW after it ended", s)
+	}
+}
+
+func TestMiner_SnapshotInCoordinatorMode(t *testing.T) {
+	coord, err := coordinator.Listen("127.0.0.1:0", coordinator.DefaultRangeSize)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer coord.Close()
+
+	m := &Miner{hashes: new(uint64), Coordinator: coord}
+	m.powStarted("abcdef", 9)
+	if s := m.snapshot(); !s.Remote || s.RemoteRate != 0 || s.POWStart.IsZero() {
+		t.Errorf("snapshot() = %+v, want the POW searched by the remote hash workers", s)
+	}
+}
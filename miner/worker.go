@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sync/atomic"
 
+	"github.com/MihaiLupoiu/interview-exasol/logging"
 	"github.com/MihaiLupoiu/interview-exasol/utils"
 	"github.com/MihaiLupoiu/interview-exasol/worker"
 	"github.com/paulbellamy/ratecounter"
@@ -19,6 +21,9 @@ type Args struct {
 	MaxSuffixLength int
 	Seed            int64
 	HashrateCounter *ratecounter.RateCounter
+	// Hashes, when set, counts the hashes attempted, and JobHashes the ones of this job.
+	Hashes    *uint64
+	JobHashes *uint64
 }
 
 /*
@@ -64,25 +69,49 @@ func FindHash2(ctx context.Context, args interface{}) (interface{}, error) {
 	suffix := make([]byte, length)
 	var hashConetext = utils.NewHash(authdata)
 
+	// The hashes are added to the total in batches, an atomic add for each one is too slow.
+	var hashes uint64
+	defer func() {
+		addHashes(argVal, hashes)
+	}()
+
 	for {
 		utils.RandomUTF8(randomGenerator, suffix)
 		argVal.HashrateCounter.Incr(1)
+		if hashes++; hashes == hashBatch {
+			addHashes(argVal, hashes)
+			hashes = 0
+		}
 
 		hash := hashConetext.Sum(suffix)
 
 		if utils.CheckDificulty(hash, argVal.Difficulty) {
-			fmt.Printf("Authdata: %s\nSuffix: %s\nDifficulty: %d\n", authdata, suffix, argVal.Difficulty)
+			logger.Debug("suffix found", "authdata", string(authdata), "suffix", string(suffix), "difficulty", argVal.Difficulty)
 			return string(suffix), nil
 		}
 
-		if ctx.Err() == context.Canceled {
-			return "", nil
+		if err := ctx.Err(); err != nil {
+			return "", err
 		}
 	}
 }
 
+// hashBatch is how many hashes a worker counts before adding them to the total.
+const hashBatch = 4096
+
+// addHashes adds the hashes to the counters of the arguments that are set.
+func addHashes(args Args, hashes uint64) {
+	if args.Hashes != nil {
+		atomic.AddUint64(args.Hashes, hashes)
+	}
+	if args.JobHashes != nil {
+		atomic.AddUint64(args.JobHashes, hashes)
+	}
+}
+
 // GenerateWorkerJobs is a function that will generate as many jobs as required to pass to the worker pool.
-func GenerateWorkerJobs(jobsCount, difficulty, minStringlength, maxStringlength int, authdata string, counter *ratecounter.RateCounter) []worker.Job {
+// The hashes attempted are counted in hashes when it is not nil, and by each job in its JobHashes.
+func GenerateWorkerJobs(jobsCount, difficulty, minStringlength, maxStringlength int, authdata string, counter *ratecounter.RateCounter, hashes *uint64) []worker.Job {
 	jobs := make([]worker.Job, jobsCount)
 	for i := 0; i < jobsCount; i++ {
 		jobs[i] = worker.Job{
@@ -95,34 +124,40 @@ func GenerateWorkerJobs(jobsCount, difficulty, minStringlength, maxStringlength
 				MaxSuffixLength: maxStringlength,
 				Seed:            int64(i),
 				HashrateCounter: counter,
+				Hashes:          hashes,
+				JobHashes:       new(uint64),
 			},
 		}
 	}
 	return jobs
 }
 
-// GetResults is a wrapper for a  blocking channel that returns the results from the worker pools.
-func GetResults(wPool worker.Pool) (string, error) {
-	select {
-	case r, ok := <-wPool.Results():
-		if !ok {
-			return "", errors.New("could not read results")
+// jobHashes returns the counters of the hashes attempted by each job.
+func jobHashes(jobs []worker.Job) []*uint64 {
+	counters := make([]*uint64, 0, len(jobs))
+	for _, job := range jobs {
+		if args, ok := job.Args.(Args); ok && args.JobHashes != nil {
+			counters = append(counters, args.JobHashes)
 		}
+	}
+	return counters
+}
 
-		if r.Err == nil {
-			suffix := r.Value.(string)
-			if suffix != "" {
-				return suffix, nil
-			}
-		} else {
+// GetResults is a wrapper for a blocking channel that returns the results from the worker pools.
+// With a RaceFirst pool it only returns once every worker has exited.
+func GetResults(wPool worker.Pool) (string, error) {
+	for r := range wPool.Results() {
+		if r.Err != nil {
 			if r.Err != context.Canceled { // Context error do to context cancellation to stop gorutines.
-				fmt.Printf("unexpected error: %v", r.Err)
+				logger.Error("unexpected error of the worker pool", logging.KeyError, r.Err)
 				return "", r.Err
 			}
+			continue
 		}
 
-	case <-wPool.Done:
-		return "", nil
+		if suffix := r.Value.(string); suffix != "" {
+			return suffix, nil
+		}
 	}
 
 	return "", nil
@@ -0,0 +1,62 @@
+package pki
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `usage: pki <command> [flags]
+
+commands:
+  init          create the CA and the coordinator certificate
+  issue-worker  create the certificate of a hash worker
+  revoke        add a hash worker certificate to the CRL`
+
+// Run executes the pki command with its arguments.
+func Run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	flags := flag.NewFlagSet("pki "+args[0], flag.ContinueOnError)
+	dir := flags.String("dir", "./config/pki", "directory of the CA")
+
+	switch args[0] {
+	case "init":
+		hosts := flags.String("hosts", "localhost,127.0.0.1", "comma separated names and IPs of the coordinator")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := Init(*dir, strings.Split(*hosts, ",")); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "CA and coordinator certificate created in %s\n", *dir)
+	case "issue-worker":
+		name := flags.String("name", "", "name of the hash worker")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		certFile, keyFile, err := IssueWorker(*dir, *name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "certificate %s and key %s created, use them with the CA %s\n",
+			certFile, keyFile, filepath.Join(*dir, CAFile))
+	case "revoke":
+		cert := flags.String("cert", "", "certificate of the hash worker to revoke")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := Revoke(*dir, *cert); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s revoked in %s\n", *cert, filepath.Join(*dir, CRLFile))
+	default:
+		return fmt.Errorf("unknown pki command %q\n%s", args[0], usage)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Files created in the PKI directory.
+const (
+	CAFile              = "ca.crt"
+	CAKeyFile           = "ca.key"
+	CRLFile             = "crl.pem"
+	CoordinatorCertFile = "coordinator.crt"
+	CoordinatorKeyFile  = "coordinator.key"
+	WorkersDir          = "workers"
+)
+
+var (
+	caValidity   = time.Hour * 24 * 365 * 10
+	certValidity = time.Hour * 24 * 365
+	crlValidity  = time.Hour * 24 * 30
+)
+
+// ErrExists is returned by Init when the directory already has a CA.
+var ErrExists = errors.New("CA already exists")
+
+// Init creates a private CA in the directory and the certificate of the coordinator
+// for the hosts, which can be names or IP addresses.
+func Init(dir string, hosts []string) error {
+	if _, err := os.Stat(filepath.Join(dir, CAFile)); err == nil {
+		return fmt.Errorf("%w in %s", ErrExists, dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template, err := newTemplate("miner private CA", caValidity)
+	if err != nil {
+		return err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	if err := writeKeyPair(filepath.Join(dir, CAFile), filepath.Join(dir, CAKeyFile), der, key); err != nil {
+		return err
+	}
+
+	_, _, err = issue(dir, "coordinator", hosts, x509.ExtKeyUsageServerAuth,
+		filepath.Join(dir, CoordinatorCertFile), filepath.Join(dir, CoordinatorKeyFile))
+	return err
+}
+
+// IssueWorker creates the certificate of a hash worker signed by the CA of the directory.
+func IssueWorker(dir, name string) (certFile, keyFile string, err error) {
+	if name == "" || filepath.Base(name) != name {
+		return "", "", fmt.Errorf("invalid worker name %q", name)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, WorkersDir), 0700); err != nil {
+		return "", "", err
+	}
+
+	certFile = filepath.Join(dir, WorkersDir, name+".crt")
+	keyFile = filepath.Join(dir, WorkersDir, name+".key")
+	_, _, err = issue(dir, name, nil, x509.ExtKeyUsageClientAuth, certFile, keyFile)
+	return certFile, keyFile, err
+}
+
+// Revoke adds the certificate to the CRL of the directory.
+func Revoke(dir, certFile string) error {
+	cert, err := readCertificate(certFile)
+	if err != nil {
+		return err
+	}
+	ca, caKey, err := loadCA(dir)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return fmt.Errorf("%s is not signed by the CA: %w", certFile, err)
+	}
+
+	crlPath := filepath.Join(dir, CRLFile)
+	var revoked []pkix.RevokedCertificate
+	number := big.NewInt(1)
+	if data, err := ioutil.ReadFile(crlPath); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "X509 CRL" {
+			return fmt.Errorf("%s is not a PEM encoded CRL", crlPath)
+		}
+		crl, err := x509.ParseDERCRL(block.Bytes)
+		if err != nil {
+			return err
+		}
+		revoked = crl.TBSCertList.RevokedCertificates
+		number.Add(big.NewInt(int64(len(revoked))), big.NewInt(1))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, r := range revoked {
+		if r.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return nil
+		}
+	}
+	now := time.Now()
+	revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: cert.SerialNumber, RevocationTime: now})
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              number,
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(crlValidity),
+	}, ca, caKey)
+	if err != nil {
+		return err
+	}
+	return writeFile(crlPath, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0644)
+}
+
+// issue creates a certificate signed by the CA of the directory and writes it with its key.
+func issue(dir, name string, hosts []string, usage x509.ExtKeyUsage, certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	ca, caKey, err := loadCA(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := newTemplate(name, certValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeKeyPair(certFile, keyFile, der, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// newTemplate returns a certificate template with a random serial number.
+func newTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+// loadCA reads the CA certificate and key of the directory.
+func loadCA(dir string) (*x509.Certificate, crypto.Signer, error) {
+	ca, err := readCertificate(filepath.Join(dir, CAFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, CAKeyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM key found in %s", filepath.Join(dir, CAKeyFile))
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// readCertificate reads the first PEM certificate of the file.
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// writeKeyPair writes the certificate and its private key as PEM files.
+func writeKeyPair(certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return err
+	}
+	return writeFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// writeFile writes the data in a temporary file and renames it.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
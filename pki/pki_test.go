@@ -0,0 +1,113 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestInit_CreatesCAAndCoordinator(t *testing.T) {
+	dir := t.TempDir()
+	if err := Init(dir, []string{"localhost", "127.0.0.1"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	ca, err := readCertificate(filepath.Join(dir, CAFile))
+	if err != nil {
+		t.Fatalf("readCertificate() error = %v", err)
+	}
+	cert, err := readCertificate(filepath.Join(dir, CoordinatorCertFile))
+	if err != nil {
+		t.Fatalf("readCertificate() error = %v", err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("coordinator certificate not signed by the CA: %v", err)
+	}
+	if len(cert.DNSNames) != 1 || len(cert.IPAddresses) != 1 {
+		t.Errorf("coordinator certificate names = %v %v, want localhost and 127.0.0.1", cert.DNSNames, cert.IPAddresses)
+	}
+
+	if err := Init(dir, nil); !errors.Is(err, ErrExists) {
+		t.Errorf("second Init() error = %v, want %v", err, ErrExists)
+	}
+}
+
+func TestIssueWorker(t *testing.T) {
+	dir := t.TempDir()
+	if err := Init(dir, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		worker  string
+		wantErr bool
+	}{
+		{name: "valid name", worker: "worker-1"},
+		{name: "empty name", worker: "", wantErr: true},
+		{name: "path in name", worker: "../worker", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile, _, err := IssueWorker(dir, tt.worker)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IssueWorker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert, err := readCertificate(certFile)
+			if err != nil {
+				t.Fatalf("readCertificate() error = %v", err)
+			}
+			if cert.Subject.CommonName != tt.worker {
+				t.Errorf("common name = %q, want %q", cert.Subject.CommonName, tt.worker)
+			}
+			if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+				t.Errorf("ext key usage = %v, want client auth", cert.ExtKeyUsage)
+			}
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	dir := t.TempDir()
+	if err := Init(dir, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	first, _, _ := IssueWorker(dir, "first")
+	second, _, _ := IssueWorker(dir, "second")
+
+	for _, certFile := range []string{first, second, first} {
+		if err := Revoke(dir, certFile); err != nil {
+			t.Fatalf("Revoke(%s) error = %v", certFile, err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, CRLFile))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("CRL = %q, want a PEM encoded CRL", data)
+	}
+	crl, err := x509.ParseDERCRL(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseDERCRL() error = %v", err)
+	}
+	if got := len(crl.TBSCertList.RevokedCertificates); got != 2 {
+		t.Errorf("revoked certificates = %d, want 2", got)
+	}
+
+	other := t.TempDir()
+	if err := Init(other, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if err := Revoke(other, first); err == nil {
+		t.Errorf("Revoke() of a certificate of another CA succeeded")
+	}
+}
@@ -0,0 +1,161 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+// Policy is how an operation is retried. The wait after the attempt n is
+// InitialInterval * Multiplier^(n-1), limited to MaxInterval and randomized by
+// Jitter, a fraction of the wait: 0.5 waits between half and one and a half times.
+type Policy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	// MaxAttempts stops after this number of attempts, 0 means no limit.
+	MaxAttempts int
+	// MaxElapsed stops when the next attempt would start after this time since the
+	// first one, 0 means no limit.
+	MaxElapsed time.Duration
+}
+
+// DefaultPolicy returns the policy used to reconnect to the server.
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute,
+		Multiplier:      2,
+		Jitter:          0.5,
+		MaxAttempts:     10,
+		MaxElapsed:      time.Minute * 15,
+	}
+}
+
+// Backoff returns the wait after the attempt, with random in [0, 1) choosing the jitter.
+func (p Policy) Backoff(attempt int, random float64) time.Duration {
+	wait := float64(p.InitialInterval)
+	for i := 1; i < attempt && p.Multiplier > 1; i++ {
+		wait *= p.Multiplier
+		if p.MaxInterval > 0 && wait >= float64(p.MaxInterval) {
+			break
+		}
+	}
+	if p.MaxInterval > 0 && wait > float64(p.MaxInterval) {
+		wait = float64(p.MaxInterval)
+	}
+	wait += wait * p.Jitter * (2*random - 1)
+	return time.Duration(wait)
+}
+
+// permanent marks an error that is not worth retrying.
+type permanent struct {
+	err error
+}
+
+func (e *permanent) Error() string   { return e.err.Error() }
+func (e *permanent) Unwrap() error   { return e.err }
+func (e *permanent) Permanent() bool { return true }
+
+// Permanent marks the error as fatal, Do returns it without retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanent{err: err}
+}
+
+// Retryable classifies the error. Errors that have a Permanent method returning true,
+// anywhere in their chain, and context cancellations are fatal; the rest are retryable.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var p interface{ Permanent() bool }
+	if errors.As(err, &p) && p.Permanent() {
+		return false
+	}
+	return true
+}
+
+// ExhaustedError is returned when the policy does not allow more attempts, with the last error.
+type ExhaustedError struct {
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("gave up after %d attempts in %v: %v", e.Attempts, e.Elapsed.Round(time.Millisecond), e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	randMu sync.Mutex
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random number in [0, 1).
+func jitter() float64 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return random.Float64()
+}
+
+// now and sleep are replaced in the tests to run without waiting.
+var now = time.Now
+
+// sleep waits for the duration or until the context is done.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do calls the operation until it succeeds, returns a fatal error or the policy does not
+// allow more attempts. The attempts are numbered from 1.
+func Do(ctx context.Context, p Policy, op func(attempt int) error) error {
+	return DoNotify(ctx, p, op, nil)
+}
+
+// DoNotify is Do calling notify, when it is not nil, with the error of every attempt that
+// is retried and the wait before the next one. The errors of the last attempt are not
+// notified, they are returned.
+func DoNotify(ctx context.Context, p Policy, op func(attempt int) error, notify func(err error, wait time.Duration)) error {
+	start := now()
+	for attempt := 1; ; attempt++ {
+		err := op(attempt)
+		if err == nil {
+			return nil
+		}
+		if !Retryable(err) {
+			return err
+		}
+		wait := p.Backoff(attempt, jitter())
+		elapsed := now().Sub(start)
+		if (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) || (p.MaxElapsed > 0 && elapsed+wait > p.MaxElapsed) {
+			return &ExhaustedError{Attempts: attempt, Elapsed: elapsed, Err: err}
+		}
+		logger.Warn("attempt failed, retrying", "attempt", attempt, logging.KeyError, err, "wait", wait.Round(time.Millisecond))
+		if notify != nil {
+			notify(err, wait)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
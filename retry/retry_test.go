@@ -0,0 +1,162 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{InitialInterval: time.Second, MaxInterval: time.Second * 10, Multiplier: 2, Jitter: 0.5}
+
+	tests := []struct {
+		name    string
+		attempt int
+		random  float64
+		want    time.Duration
+	}{
+		{name: "first attempt", attempt: 1, random: 0.5, want: time.Second},
+		{name: "doubles", attempt: 3, random: 0.5, want: time.Second * 4},
+		{name: "limited", attempt: 10, random: 0.5, want: time.Second * 10},
+		{name: "lowest jitter", attempt: 2, random: 0, want: time.Second},
+		{name: "highest jitter", attempt: 2, random: 1, want: time.Second * 3},
+		{name: "jitter over the limit", attempt: 20, random: 1, want: time.Second * 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Backoff(tt.attempt, tt.random); got != tt.want {
+				t.Errorf("Backoff(%d, %v) = %v, want %v", tt.attempt, tt.random, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "connection dropped", err: io.EOF, want: true},
+		{name: "permanent", err: Permanent(errors.New("load cert failed")), want: false},
+		{name: "wrapped permanent", err: fmt.Errorf("dial: %w", Permanent(io.EOF)), want: false},
+		{name: "canceled", err: fmt.Errorf("session: %w", context.Canceled), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeTime replaces the clock and sleep of the package and returns the waits.
+func fakeTime(t *testing.T) *[]time.Duration {
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	oldNow, oldSleep := now, sleep
+	now = func() time.Time { return clock }
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		clock = clock.Add(d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { now, sleep = oldNow, oldSleep })
+	return &waits
+}
+
+func TestDo(t *testing.T) {
+	policy := Policy{InitialInterval: time.Second, MaxInterval: time.Minute, Multiplier: 2}
+	fatal := Permanent(errors.New("fatal"))
+
+	tests := []struct {
+		name         string
+		policy       Policy
+		errs         []error
+		wantAttempts int
+		wantErr      error
+		wantWaits    []time.Duration
+		wantExhaust  bool
+	}{
+		{name: "first attempt succeeds", policy: policy, errs: []error{nil}, wantAttempts: 1},
+		{
+			name:         "succeeds after retries",
+			policy:       policy,
+			errs:         []error{io.EOF, io.EOF, nil},
+			wantAttempts: 3,
+			wantWaits:    []time.Duration{time.Second, time.Second * 2},
+		},
+		{name: "fatal error", policy: policy, errs: []error{io.EOF, fatal}, wantAttempts: 2, wantErr: fatal, wantWaits: []time.Duration{time.Second}},
+		{
+			name:         "max attempts",
+			policy:       Policy{InitialInterval: time.Second, Multiplier: 2, MaxAttempts: 3},
+			errs:         []error{io.EOF, io.EOF, io.EOF, nil},
+			wantAttempts: 3,
+			wantErr:      io.EOF,
+			wantExhaust:  true,
+			wantWaits:    []time.Duration{time.Second, time.Second * 2},
+		},
+		{
+			name:         "max elapsed",
+			policy:       Policy{InitialInterval: time.Second, Multiplier: 2, MaxElapsed: time.Second * 5},
+			errs:         []error{io.EOF, io.EOF, io.EOF, nil},
+			wantAttempts: 3,
+			wantErr:      io.EOF,
+			wantExhaust:  true,
+			wantWaits:    []time.Duration{time.Second, time.Second * 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits := fakeTime(t)
+			attempts := 0
+			var notified []time.Duration
+			err := DoNotify(context.TODO(), tt.policy, func(attempt int) error {
+				attempts++
+				if attempt != attempts {
+					t.Errorf("attempt = %d, want %d", attempt, attempts)
+				}
+				return tt.errs[attempt-1]
+			}, func(err error, wait time.Duration) {
+				if err != tt.errs[len(notified)] {
+					t.Errorf("notified error = %v, want %v", err, tt.errs[len(notified)])
+				}
+				notified = append(notified, wait)
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			var exhausted *ExhaustedError
+			if errors.As(err, &exhausted) != tt.wantExhaust {
+				t.Errorf("Do() error = %v, exhausted %v", err, tt.wantExhaust)
+			}
+			if fmt.Sprint(*waits) != fmt.Sprint(tt.wantWaits) || fmt.Sprint(notified) != fmt.Sprint(tt.wantWaits) {
+				t.Errorf("waits = %v and notified %v, want %v", *waits, notified, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestDo_StopsWhenContextIsDone(t *testing.T) {
+	fakeTime(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	attempts := 0
+	err := Do(ctx, Policy{InitialInterval: time.Second}, func(int) error {
+		attempts++
+		return io.EOF
+	})
+	if err != context.Canceled || attempts != 1 {
+		t.Errorf("Do() = %v after %d attempts, want %v after 1", err, attempts, context.Canceled)
+	}
+}
@@ -35,12 +35,24 @@ var prefixDifficultyBytesMap = map[int][]byte{
 	9: {255, 255, 255, 255, 240, 0, 0, 0},
 }
 
+// hexPrefix returns the zeros the hex of a hash starts with when it meets the difficulty,
+// also for the difficulties above the table.
+func hexPrefix(dificulty int) string {
+	if prefix, ok := prefixDifficultyMap[dificulty]; ok {
+		return prefix
+	}
+	if dificulty < 0 {
+		return ""
+	}
+	return strings.Repeat("0", dificulty)
+}
+
 // Check if hex starts with dificulty number of 0s.
 func hexStartsWith(hash [20]byte, dificulty int) bool {
 	// Improve method to use bit manipulation for more optimal comparion.
 	// E.g: Convert to uint64 and compare it's content with expected value from dificulty.
 	sha1_hash := hex.EncodeToString(hash[:])
-	res := strings.HasPrefix(sha1_hash, prefixDifficultyMap[dificulty])
+	res := strings.HasPrefix(sha1_hash, hexPrefix(dificulty))
 	return res
 }
 
@@ -48,12 +60,15 @@ func HexStartsWith2(hash []byte, dificulty int) bool {
 	// Improve method to use bit manipulation for more optimal comparion.
 	// E.g: Convert to uint64 and compare it's content with expected value from dificulty.
 	sha1_hash := hex.EncodeToString(hash)
-	res := strings.HasPrefix(sha1_hash, prefixDifficultyMap[dificulty])
+	res := strings.HasPrefix(sha1_hash, hexPrefix(dificulty))
 	return res
 }
 
 func HexStartsWith3(hash []byte, dificulty int) bool {
 	// return bytes.Equal(prefixDifficultyBytesMap[dificulty], hash[:len(prefixDifficultyBytesMap[dificulty])])
+	if _, ok := prefixDifficultyBytesMap[dificulty]; !ok {
+		return HexStartsWith2(hash, dificulty)
+	}
 
 	for i := 0; i < len(prefixDifficultyBytesMap[dificulty]); i++ {
 		res := hash[i] & prefixDifficultyBytesMap[dificulty][i]
@@ -114,3 +129,107 @@ func CalculateHashAndCheckDifficulty(bytes []byte, difficulty int) bool {
 
 	return CheckDificulty(cksum_in_hex, difficulty)
 }
+
+// NonceSuffixLength is the length of the suffix generated for a nonce. 94^10 is bigger than 2^64,
+// so every nonce has its own suffix.
+const NonceSuffixLength = 10
+
+// nonceAlphabetSize is the number of printable characters from 0x21 "!" to 0x7e "~".
+const nonceAlphabetSize = 94
+
+// progressInterval is the number of hashes between progress reports and context checks in SearchRange.
+const progressInterval = 1 << 14
+
+// ErrNotFound is returned by SearchRange when no suffix in the range meets the difficulty.
+var ErrNotFound = errors.New("no suffix found in range")
+
+// Range is the half open interval [Start, End) of the nonce space.
+type Range struct {
+	Start uint64
+	End   uint64
+}
+
+// Size returns the number of nonces in the range.
+func (r Range) Size() uint64 {
+	if r.End < r.Start {
+		return 0
+	}
+	return r.End - r.Start
+}
+
+// Split divides the range in n consecutive ranges of similar size.
+func (r Range) Split(n int) []Range {
+	if n < 1 {
+		n = 1
+	}
+	size := r.Size()
+	if uint64(n) > size {
+		n = int(size)
+	}
+
+	ranges := make([]Range, 0, n)
+	start := r.Start
+	for i := 0; i < n; i++ {
+		end := start + size/uint64(n)
+		if uint64(i) < size%uint64(n) {
+			end++
+		}
+		ranges = append(ranges, Range{Start: start, End: end})
+		start = end
+	}
+	return ranges
+}
+
+// meetsDifficulty uses the byte masks when they are available for the difficulty.
+func meetsDifficulty(hash []byte, difficulty int) bool {
+	if _, ok := prefixDifficultyBytesMap[difficulty]; ok {
+		return HexStartsWith3(hash, difficulty)
+	}
+	return HexStartsWith2(hash, difficulty)
+}
+
+// NonceSuffix writes in suffix the characters that represent the nonce. The suffix
+// only contains characters from 0x21 "!" to 0x7e "~", so it is valid for the server.
+func NonceSuffix(nonce uint64, suffix []byte) {
+	for i := len(suffix) - 1; i >= 0; i-- {
+		suffix[i] = byte(0x21 + nonce%nonceAlphabetSize)
+		nonce /= nonceAlphabetSize
+	}
+}
+
+// SearchRange calculates the SHA1 of the authdata with the suffix of every nonce in the range
+// and returns the first suffix that meets the difficulty. progress, if not nil, is called
+// regularly with the number of hashes calculated since the last call.
+func SearchRange(ctx context.Context, authdata string, difficulty int, r Range, progress func(hashes uint64)) (string, error) {
+	hashContext := utils.NewHash([]byte(authdata))
+	suffix := make([]byte, NonceSuffixLength)
+
+	var pending uint64
+	for nonce := r.Start; nonce < r.End; nonce++ {
+		NonceSuffix(nonce, suffix)
+		hash := hashContext.Sum(suffix)
+		pending++
+
+		if meetsDifficulty(hash, difficulty) {
+			if progress != nil {
+				progress(pending)
+			}
+			return string(suffix), nil
+		}
+
+		if pending == progressInterval {
+			if progress != nil {
+				progress(pending)
+			}
+			pending = 0
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if progress != nil && pending > 0 {
+		progress(pending)
+	}
+	return "", ErrNotFound
+}
@@ -47,6 +47,15 @@ func TestCalculateAndCheckHash(t *testing.T) {
 			},
 			want: "543935c4-59e1-4b85-b062-4f9b01914336",
 		},
+		{
+			name: "Difficulty above the table",
+			args: args{
+				authdata:   "",
+				suffix:     "l",
+				difficulty: 11,
+			},
+			want: "",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -168,6 +177,14 @@ func TestCheckDificulty(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "should return false above the table",
+			args: args{
+				hash:      [20]byte{7, 195, 66, 190, 110, 86, 14, 127, 67, 132, 46, 46, 33, 183, 116, 230, 29, 133, 240, 71},
+				dificulty: 12,
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -255,3 +272,58 @@ func TestHexStartsWith3(t *testing.T) {
 		})
 	}
 }
+
+func TestNonceSuffix(t *testing.T) {
+	seen := map[string]uint64{}
+	suffix := make([]byte, NonceSuffixLength)
+	for _, nonce := range []uint64{0, 1, 93, 94, 95, 1 << 32, 1<<64 - 1} {
+		NonceSuffix(nonce, suffix)
+		for _, c := range suffix {
+			if c < 0x21 || c > 0x7e {
+				t.Fatalf("NonceSuffix(%d) = %q contains invalid character %q", nonce, suffix, c)
+			}
+		}
+		if other, ok := seen[string(suffix)]; ok {
+			t.Fatalf("NonceSuffix(%d) = NonceSuffix(%d) = %q", nonce, other, suffix)
+		}
+		seen[string(suffix)] = nonce
+	}
+}
+
+func TestRange_Split(t *testing.T) {
+	ranges := Range{Start: 10, End: 21}.Split(3)
+	want := []Range{{10, 14}, {14, 18}, {18, 21}}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("Range.Split() = %v, want %v", ranges, want)
+	}
+
+	if ranges := (Range{Start: 0, End: 2}).Split(4); len(ranges) != 2 {
+		t.Errorf("Range.Split() = %v, want 2 ranges", ranges)
+	}
+}
+
+func TestSearchRange(t *testing.T) {
+	authdata := "cQokBByiRKwFNFhsXUvtTuEwRPwXdFjBeLjelxqPXoQHhIZaXMucoBSBpKFRkDFR"
+
+	var hashes uint64
+	suffix, err := SearchRange(context.TODO(), authdata, 3, Range{Start: 0, End: 1 << 20}, func(n uint64) { hashes += n })
+	if err != nil {
+		t.Fatalf("SearchRange() error = %v", err)
+	}
+	if CalculateAndCheckHash(authdata, suffix, 3) == "" {
+		t.Fatalf("SearchRange() = %q does not meet the difficulty", suffix)
+	}
+	if hashes == 0 {
+		t.Errorf("SearchRange() did not report progress")
+	}
+
+	if _, err := SearchRange(context.TODO(), authdata, 9, Range{Start: 0, End: 100}, nil); err != ErrNotFound {
+		t.Errorf("SearchRange() error = %v, want %v", err, ErrNotFound)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, err := SearchRange(ctx, authdata, 9, Range{Start: 0, End: 1 << 40}, nil); err != context.Canceled {
+		t.Errorf("SearchRange() error = %v, want %v", err, context.Canceled)
+	}
+}
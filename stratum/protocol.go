@@ -0,0 +1,107 @@
+package stratum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/MihaiLupoiu/interview-exasol/connection"
+)
+
+// Methods of the protocol. Every request, response and notification is a JSON object
+// in its own line, as in the Stratum mining protocol.
+const (
+	// MethodSubscribe is the first request of a client, the result is its session ID.
+	MethodSubscribe = "mining.subscribe"
+	// MethodAuthorize identifies the worker with the params [name, password].
+	MethodAuthorize = "mining.authorize"
+	// MethodNotify is sent by the server with the params [job ID, authdata, difficulty, clean]
+	// when there is a new POW to search. Clean is true when the previous jobs are not valid anymore.
+	MethodNotify = "mining.notify"
+	// MethodSetDifficulty is sent by the server before a job with the params [share difficulty].
+	// Suffixes that meet the share difficulty are accepted as shares, the ones that also meet
+	// the difficulty of the job solve it.
+	MethodSetDifficulty = "mining.set_difficulty"
+	// MethodSubmit sends a candidate suffix with the params [name, job ID, suffix].
+	MethodSubmit = "mining.submit"
+	// MethodHashrate reports the hashrate of the client with the params [name, hashes per second].
+	MethodHashrate = "mining.hashrate"
+)
+
+// Error codes of the responses, the same used by Stratum pools.
+const (
+	CodeOther         = 20
+	CodeJobNotFound   = 21
+	CodeDuplicate     = 22
+	CodeLowDifficulty = 23
+	CodeUnauthorized  = 24
+	CodeNotSubscribed = 25
+)
+
+// Request is a call of a method. Notifications are requests without ID.
+type Request struct {
+	ID     *uint64         `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Response is the answer to a request with the same ID.
+type Response struct {
+	ID     *uint64     `json:"id"`
+	Result interface{} `json:"result"`
+	Error  *Error      `json:"error"`
+}
+
+// Error is the error of a response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("stratum error %d: %s", e.Code, e.Message)
+}
+
+// MaxMessageSize is the longest line, without the newline, read by a codec. A longer line
+// fails Receive without being buffered whole.
+const MaxMessageSize = 4096
+
+// Codec reads and writes the lines of the protocol in a connection. Send is safe
+// to use from several gorutines.
+type Codec struct {
+	mu    sync.Mutex
+	lines *connection.LineReader
+	enc   *json.Encoder
+}
+
+// NewCodec returns a codec for the connection.
+func NewCodec(rw io.ReadWriter) *Codec {
+	return &Codec{
+		lines: connection.NewLineReader(rw, MaxMessageSize),
+		enc:   json.NewEncoder(rw),
+	}
+}
+
+// Send writes the request, response or notification followed by a new line.
+func (c *Codec) Send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.enc.Encode(v)
+}
+
+// Receive reads the next line into v, empty lines are skipped. It fails with
+// connection.ErrLineTooLong for a line longer than MaxMessageSize.
+func (c *Codec) Receive(v interface{}) error {
+	for {
+		line, err := c.lines.ReadLine()
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(line) != "" {
+			return json.Unmarshal([]byte(line), v)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package stratum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+// ErrClosed is returned by Solve when the server is closed during the search.
+var ErrClosed = errors.New("stratum server closed")
+
+// Option configures the server.
+type Option func(*Server)
+
+// WithAuthorizer sets the function that checks the name and password of the workers.
+// By default every worker is authorized.
+func WithAuthorizer(authorize func(name, password string) bool) Option {
+	return func(s *Server) {
+		s.authorize = authorize
+	}
+}
+
+// WithShareDifficulty sets the difficulty of the shares, lower than the difficulty of the
+// challenges, so the shares of every client estimate its real hashrate. By default the
+// shares have the difficulty of the challenge.
+func WithShareDifficulty(difficulty int) Option {
+	return func(s *Server) {
+		s.shareDifficulty = difficulty
+	}
+}
+
+// Server hands the POW being solved to the mining clients connected to it and
+// verifies the suffixes they submit.
+type Server struct {
+	listener        net.Listener
+	authorize       func(name, password string) bool
+	shareDifficulty int
+	closed          chan struct{}
+	now             func() time.Time
+
+	mu          sync.Mutex
+	clients     map[*client]struct{}
+	job         *job
+	nextJobID   uint64
+	nextSession uint64
+}
+
+// job is the POW being solved.
+type job struct {
+	id              string
+	authdata        string
+	difficulty      int
+	shareDifficulty int
+	submitted       map[string]struct{}
+	found           chan string
+}
+
+// client is a mining client connected to the server.
+type client struct {
+	session    string
+	name       string
+	addr       string
+	conn       net.Conn
+	codec      *Codec
+	subscribed bool
+	authorized bool
+	accepted   uint64
+	rejected   uint64
+	shares     shares
+}
+
+// ClientStatus is the state of a mining client. The estimated hashrate is calculated
+// from the verified shares, and the client is suspicious when it reports a hashrate
+// its shares do not explain.
+type ClientStatus struct {
+	Session           string
+	Name              string
+	Addr              string
+	Accepted          uint64
+	Rejected          uint64
+	Shares            uint64
+	ReportedHashrate  float64
+	EstimatedHashrate float64
+	Suspicious        bool
+}
+
+// Listen creates a server that accepts mining clients in the address.
+func Listen(addr string, opts ...Option) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return New(listener, opts...), nil
+}
+
+// New creates a server that accepts mining clients from the listener.
+func New(listener net.Listener, opts ...Option) *Server {
+	s := &Server{
+		listener:  listener,
+		authorize: func(name, password string) bool { return true },
+		closed:    make(chan struct{}),
+		now:       time.Now,
+		clients:   make(map[*client]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Addr returns the address where the server is listening.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts mining clients until the server is closed.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closed:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting mining clients and disconnects the connected ones.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closed:
+		return nil
+	default:
+	}
+	close(s.closed)
+
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	return s.listener.Close()
+}
+
+// Clients returns the status of the connected mining clients.
+func (s *Server) Clients() []ClientStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	clients := make([]ClientStatus, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, ClientStatus{
+			Session:           c.session,
+			Name:              c.name,
+			Addr:              c.addr,
+			Accepted:          c.accepted,
+			Rejected:          c.rejected,
+			Shares:            c.shares.count,
+			ReportedHashrate:  c.shares.reported,
+			EstimatedHashrate: c.shares.estimate(now),
+			Suspicious:        c.shares.suspicious(now),
+		})
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Session < clients[j].Session
+	})
+	return clients
+}
+
+// Hashrate returns the sum of the hashrates estimated from the shares of the clients.
+func (s *Server) Hashrate() float64 {
+	var hashrate float64
+	for _, c := range s.Clients() {
+		hashrate += c.EstimatedHashrate
+	}
+	return hashrate
+}
+
+// Solve notifies the challenge to the mining clients and returns the first valid suffix
+// they submit. Suffixes submitted after it returns are rejected.
+func (s *Server) Solve(ctx context.Context, authdata string, difficulty int) (string, error) {
+	s.mu.Lock()
+	s.nextJobID++
+	j := &job{
+		id:              strconv.FormatUint(s.nextJobID, 10),
+		authdata:        authdata,
+		difficulty:      difficulty,
+		shareDifficulty: difficulty,
+		submitted:       make(map[string]struct{}),
+		found:           make(chan string, 1),
+	}
+	if s.shareDifficulty > 0 && s.shareDifficulty < difficulty {
+		j.shareDifficulty = s.shareDifficulty
+	}
+	s.job = j
+	notifications := make(map[*client][]interface{})
+	for c := range s.clients {
+		if c.subscribed && c.authorized {
+			notifications[c] = s.notify(c)
+		}
+	}
+	s.mu.Unlock()
+
+	for c, msgs := range notifications {
+		for _, msg := range msgs {
+			c.send(msg)
+		}
+	}
+
+	var suffix string
+	var err error
+	select {
+	case suffix = <-j.found:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-s.closed:
+		err = ErrClosed
+	}
+
+	s.mu.Lock()
+	if s.job == j {
+		s.job = nil
+		now := s.now()
+		for c := range s.clients {
+			c.shares.stop(now)
+		}
+	}
+	s.mu.Unlock()
+	return suffix, err
+}
+
+// handle processes the requests of the mining client until it disconnects.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	c := &client{
+		addr:  conn.RemoteAddr().String(),
+		conn:  conn,
+		codec: NewCodec(conn),
+	}
+
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	s.nextSession++
+	c.session = strconv.FormatUint(s.nextSession, 16)
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	logger.Info("mining client connected", logging.KeySession, c.session, "addr", c.addr)
+	defer s.unregister(c)
+
+	for {
+		var req Request
+		if err := c.codec.Receive(&req); err != nil {
+			logger.Info("mining client disconnected", logging.KeySession, c.session, logging.KeyError, err)
+			return
+		}
+		for _, reply := range s.process(c, req) {
+			c.send(reply)
+		}
+	}
+}
+
+// process runs the request of the client and returns the messages to send back.
+func (s *Server) process(c *client, req Request) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return []interface{}{failure(req, CodeOther, "params must be an array")}
+		}
+	}
+
+	switch req.Method {
+	case MethodSubscribe:
+		c.subscribed = true
+		replies := []interface{}{Response{ID: req.ID, Result: c.session}}
+		if c.authorized {
+			replies = append(replies, s.notify(c)...)
+		}
+		return replies
+
+	case MethodAuthorize:
+		var name, password string
+		if !stringParams(params, &name, &password) && !stringParams(params, &name) {
+			return []interface{}{failure(req, CodeOther, "expected [name, password]")}
+		}
+		if !s.authorize(name, password) {
+			logger.Warn("mining client not authorized", logging.KeySession, c.session, "name", name)
+			return []interface{}{failure(req, CodeUnauthorized, "unauthorized worker")}
+		}
+		c.name = name
+		c.authorized = true
+		replies := []interface{}{Response{ID: req.ID, Result: true}}
+		if c.subscribed {
+			replies = append(replies, s.notify(c)...)
+		}
+		return replies
+
+	case MethodHashrate:
+		if len(params) != 2 {
+			return []interface{}{failure(req, CodeOther, "expected [name, hashes per second]")}
+		}
+		var hashrate float64
+		if err := json.Unmarshal(params[1], &hashrate); err != nil || hashrate < 0 {
+			return []interface{}{failure(req, CodeOther, "invalid hashrate")}
+		}
+		c.shares.reported = hashrate
+		return []interface{}{Response{ID: req.ID, Result: true}}
+
+	case MethodSubmit:
+		var name, jobID, suffix string
+		if !stringParams(params, &name, &jobID, &suffix) {
+			return []interface{}{failure(req, CodeOther, "expected [name, job ID, suffix]")}
+		}
+		if err := s.submit(c, jobID, suffix); err != nil {
+			c.rejected++
+			return []interface{}{Response{ID: req.ID, Error: err}}
+		}
+		c.accepted++
+		return []interface{}{Response{ID: req.ID, Result: true}}
+
+	default:
+		return []interface{}{failure(req, CodeOther, "unknown method "+req.Method)}
+	}
+}
+
+// submit accounts the suffix of the client as a share and hands it to Solve if it solves the job.
+// Must be called with the lock held.
+func (s *Server) submit(c *client, jobID, suffix string) *Error {
+	switch {
+	case !c.subscribed:
+		return &Error{Code: CodeNotSubscribed, Message: "not subscribed"}
+	case !c.authorized:
+		return &Error{Code: CodeUnauthorized, Message: "unauthorized worker"}
+	case s.job == nil || s.job.id != jobID:
+		return &Error{Code: CodeJobNotFound, Message: "job not found"}
+	case suffix == "" || strings.ContainsAny(suffix, " \t\r\n"):
+		return &Error{Code: CodeOther, Message: "invalid suffix"}
+	}
+
+	j := s.job
+	if _, ok := j.submitted[suffix]; ok {
+		return &Error{Code: CodeDuplicate, Message: "duplicate share"}
+	}
+	if solver.CalculateAndCheckHash(j.authdata, suffix, j.shareDifficulty) == "" {
+		return &Error{Code: CodeLowDifficulty, Message: "low difficulty share"}
+	}
+	// Only the shares are kept, so the suffixes that are not one do not grow the job.
+	j.submitted[suffix] = struct{}{}
+	c.shares.add(j.shareDifficulty)
+	if j.shareDifficulty < j.difficulty && solver.CalculateAndCheckHash(j.authdata, suffix, j.difficulty) == "" {
+		return nil
+	}
+
+	logger.Info("mining client solved job", logging.KeySession, c.session, "name", c.name, "job", j.id)
+	select {
+	case j.found <- suffix:
+	default:
+	}
+	return nil
+}
+
+// unregister removes the client from the server.
+func (s *Server) unregister(c *client) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+// notify starts the share accounting of the client for the current job and returns
+// the notifications of the job. Must be called with the lock held.
+func (s *Server) notify(c *client) []interface{} {
+	j := s.job
+	if j == nil {
+		return nil
+	}
+	c.shares.start(s.now(), j.shareDifficulty)
+
+	difficulty, _ := json.Marshal([]interface{}{j.shareDifficulty})
+	params, _ := json.Marshal([]interface{}{j.id, j.authdata, j.difficulty, true})
+	return []interface{}{
+		Request{Method: MethodSetDifficulty, Params: difficulty},
+		Request{Method: MethodNotify, Params: params},
+	}
+}
+
+// send writes the message to the client and disconnects it if it fails.
+func (c *client) send(msg interface{}) {
+	if err := c.codec.Send(msg); err != nil {
+		logger.Warn("failed to send to mining client", logging.KeySession, c.session, logging.KeyError, err)
+		c.conn.Close()
+	}
+}
+
+// failure returns the error response to the request.
+func failure(req Request, code int, message string) Response {
+	return Response{ID: req.ID, Error: &Error{Code: code, Message: message}}
+}
+
+// stringParams decodes the params into the strings, it fails if the number of params differs.
+func stringParams(params []json.RawMessage, values ...*string) bool {
+	if len(params) != len(values) {
+		return false
+	}
+	for i, value := range values {
+		if err := json.Unmarshal(params[i], value); err != nil {
+			return false
+		}
+	}
+	return true
+}
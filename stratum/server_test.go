@@ -0,0 +1,281 @@
+package stratum
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+const authdata = "cQokBByiRKwFNFhsXUvtTuEwRPwXdFjBeLjelxqPXoQHhIZaXMucoBSBpKFRkDFR"
+
+// message decodes both responses and notifications sent by the server.
+type message struct {
+	ID     *uint64         `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// testClient drives the protocol by hand.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	codec  *Codec
+	nextID uint64
+}
+
+func listen(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0", opts...)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Server) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, codec: NewCodec(conn)}
+}
+
+// call sends the request and returns its response.
+func (c *testClient) call(method string, params ...interface{}) message {
+	c.t.Helper()
+	c.nextID++
+	id := c.nextID
+	raw, _ := json.Marshal(params)
+	if err := c.codec.Send(Request{ID: &id, Method: method, Params: raw}); err != nil {
+		c.t.Fatalf("Send() error = %v", err)
+	}
+	msg := c.receive()
+	if msg.ID == nil || *msg.ID != id {
+		c.t.Fatalf("expected response to %d; got %+v", id, msg)
+	}
+	return msg
+}
+
+func (c *testClient) receive() message {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var msg message
+	if err := c.codec.Receive(&msg); err != nil {
+		c.t.Fatalf("Receive() error = %v", err)
+	}
+	return msg
+}
+
+// notified waits for the notifications of a job and returns its ID, difficulty and share difficulty.
+func (c *testClient) notified() (string, int, int) {
+	c.t.Helper()
+	msg := c.receive()
+	var shareDifficulty []int
+	if msg.Method != MethodSetDifficulty || json.Unmarshal(msg.Params, &shareDifficulty) != nil || len(shareDifficulty) != 1 {
+		c.t.Fatalf("expected %s; got %+v", MethodSetDifficulty, msg)
+	}
+	msg = c.receive()
+	if msg.Method != MethodNotify {
+		c.t.Fatalf("expected %s; got %+v", MethodNotify, msg)
+	}
+	var params []interface{}
+	if err := json.Unmarshal(msg.Params, &params); err != nil || len(params) != 4 {
+		c.t.Fatalf("invalid notify params %s", msg.Params)
+	}
+	if params[1] != authdata {
+		c.t.Fatalf("notified authdata %v, want %s", params[1], authdata)
+	}
+	return params[0].(string), int(params[2].(float64)), shareDifficulty[0]
+}
+
+// validSuffix returns a suffix that solves the challenge.
+func validSuffix(t *testing.T, difficulty int) string {
+	t.Helper()
+	suffix, err := solver.SearchRange(context.TODO(), authdata, difficulty, solver.Range{Start: 0, End: 1 << 20}, nil)
+	if err != nil {
+		t.Fatalf("SearchRange() error = %v", err)
+	}
+	return suffix
+}
+
+type solved struct {
+	suffix string
+	err    error
+}
+
+func solve(s *Server, ctx context.Context, difficulty int) <-chan solved {
+	done := make(chan solved, 1)
+	go func() {
+		suffix, err := s.Solve(ctx, authdata, difficulty)
+		done <- solved{suffix, err}
+	}()
+	return done
+}
+
+func TestServer_SolveWithSubmittedShare(t *testing.T) {
+	s := listen(t)
+	c := dial(t, s)
+	if msg := c.call(MethodSubscribe); msg.Error != nil {
+		t.Fatalf("subscribe error = %v", msg.Error)
+	}
+	if msg := c.call(MethodAuthorize, "rig-1", "x"); msg.Error != nil {
+		t.Fatalf("authorize error = %v", msg.Error)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+	done := solve(s, ctx, 2)
+
+	jobID, difficulty, shareDifficulty := c.notified()
+	if difficulty != 2 || shareDifficulty != 2 {
+		t.Errorf("notified difficulty = %d and share difficulty = %d, want 2", difficulty, shareDifficulty)
+	}
+	suffix := validSuffix(t, 2)
+
+	tests := []struct {
+		name     string
+		jobID    string
+		suffix   string
+		wantCode int
+	}{
+		{name: "unknown job", jobID: "unknown", suffix: suffix, wantCode: CodeJobNotFound},
+		{name: "low difficulty", jobID: jobID, suffix: "not-a-solution", wantCode: CodeLowDifficulty},
+		{name: "whitespace", jobID: jobID, suffix: "a b", wantCode: CodeOther},
+		{name: "low difficulty again", jobID: jobID, suffix: "not-a-solution", wantCode: CodeLowDifficulty},
+		{name: "valid", jobID: jobID, suffix: suffix},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := c.call(MethodSubmit, "rig-1", tt.jobID, tt.suffix)
+			switch {
+			case tt.wantCode == 0 && msg.Error != nil:
+				t.Errorf("submit error = %v", msg.Error)
+			case tt.wantCode != 0 && (msg.Error == nil || msg.Error.Code != tt.wantCode):
+				t.Errorf("submit error = %v, want code %d", msg.Error, tt.wantCode)
+			}
+		})
+	}
+
+	res := <-done
+	if res.err != nil || res.suffix != suffix {
+		t.Errorf("Solve() = %q, %v; want %q", res.suffix, res.err, suffix)
+	}
+
+	clients := s.Clients()
+	if len(clients) != 1 || clients[0].Name != "rig-1" || clients[0].Accepted != 1 || clients[0].Rejected != 4 {
+		t.Errorf("Clients() = %+v", clients)
+	}
+
+	if msg := c.call(MethodSubmit, "rig-1", jobID, validSuffix(t, 1)); msg.Error == nil || msg.Error.Code != CodeJobNotFound {
+		t.Errorf("submit after the job was solved error = %v, want code %d", msg.Error, CodeJobNotFound)
+	}
+}
+
+func TestServer_NotifiesClientsThatJoinDuringTheSearch(t *testing.T) {
+	s := listen(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := solve(s, ctx, 2)
+
+	c := dial(t, s)
+	c.call(MethodSubscribe)
+	c.call(MethodAuthorize, "late", "x")
+	c.notified()
+
+	cancel()
+	if res := <-done; res.err != context.Canceled {
+		t.Errorf("Solve() error = %v, want %v", res.err, context.Canceled)
+	}
+}
+
+func TestServer_Authorization(t *testing.T) {
+	s := listen(t, WithAuthorizer(func(name, password string) bool {
+		return password == "secret"
+	}))
+
+	tests := []struct {
+		name     string
+		params   []interface{}
+		wantCode int
+	}{
+		{name: "right password", params: []interface{}{"rig", "secret"}},
+		{name: "wrong password", params: []interface{}{"rig", "guess"}, wantCode: CodeUnauthorized},
+		{name: "missing name", params: []interface{}{}, wantCode: CodeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, s)
+			c.call(MethodSubscribe)
+			msg := c.call(MethodAuthorize, tt.params...)
+			if tt.wantCode == 0 && msg.Error != nil {
+				t.Errorf("authorize error = %v", msg.Error)
+			}
+			if tt.wantCode != 0 && (msg.Error == nil || msg.Error.Code != tt.wantCode) {
+				t.Errorf("authorize error = %v, want code %d", msg.Error, tt.wantCode)
+			}
+		})
+	}
+
+	c := dial(t, s)
+	c.call(MethodSubscribe)
+	if msg := c.call(MethodSubmit, "rig", "1", "suffix"); msg.Error == nil || msg.Error.Code != CodeUnauthorized {
+		t.Errorf("submit without authorize error = %v, want code %d", msg.Error, CodeUnauthorized)
+	}
+}
+
+func TestServer_DuplicateShare(t *testing.T) {
+	s := listen(t, WithShareDifficulty(1))
+	c := dial(t, s)
+	c.call(MethodSubscribe)
+	c.call(MethodAuthorize, "rig-1", "x")
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	done := solve(s, ctx, 6)
+	jobID, _, _ := c.notified()
+
+	// A share of difficulty 1 that does not solve the job.
+	var share string
+	for start := uint64(0); share == ""; start += 1 << 10 {
+		suffix, err := solver.SearchRange(context.TODO(), authdata, 1, solver.Range{Start: start, End: start + 1<<10}, nil)
+		if err == nil && solver.CalculateAndCheckHash(authdata, suffix, 6) == "" {
+			share = suffix
+		}
+	}
+	if msg := c.call(MethodSubmit, "rig-1", jobID, share); msg.Error != nil {
+		t.Errorf("submit of a share error = %v", msg.Error)
+	}
+	if msg := c.call(MethodSubmit, "rig-1", jobID, share); msg.Error == nil || msg.Error.Code != CodeDuplicate {
+		t.Errorf("submit of the share again error = %v, want code %d", msg.Error, CodeDuplicate)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestServer_DisconnectsLongLines(t *testing.T) {
+	s := listen(t)
+	c := dial(t, s)
+	c.call(MethodSubscribe)
+
+	line := append(bytes.Repeat([]byte("x"), MaxMessageSize+1), '\n')
+	if _, err := c.conn.Write(line); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var msg message
+	if err := c.codec.Receive(&msg); err != io.EOF {
+		t.Errorf("Receive() after a long line = %+v, %v; want the connection closed", msg, err)
+	}
+}
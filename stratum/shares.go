@@ -0,0 +1,78 @@
+package stratum
+
+import (
+	"math"
+	"time"
+)
+
+// minExpectedShares is how many shares the reported hashrate of a client must predict
+// before it is compared with the shares it submitted. With fewer, bad luck is likely.
+const minExpectedShares = 10
+
+// shares accounts the shares submitted by a client while it had a job to search.
+// A share of difficulty d takes on average 16^d hashes to find, so the work of the
+// verified shares divided by the time searching estimates the real hashrate of the
+// client, whatever it reports.
+type shares struct {
+	count       uint64
+	work        float64
+	reported    float64
+	difficulty  int
+	active      time.Duration
+	activeSince time.Time
+}
+
+// start records that the client received a job with the share difficulty.
+func (a *shares) start(now time.Time, difficulty int) {
+	a.stop(now)
+	a.difficulty = difficulty
+	a.activeSince = now
+}
+
+// stop records that the job of the client ended.
+func (a *shares) stop(now time.Time) {
+	if !a.activeSince.IsZero() {
+		a.active += now.Sub(a.activeSince)
+		a.activeSince = time.Time{}
+	}
+}
+
+// add counts a verified share of the difficulty.
+func (a *shares) add(difficulty int) {
+	a.count++
+	a.work += expectedHashes(difficulty)
+}
+
+// elapsed returns how long the client had a job to search.
+func (a *shares) elapsed(now time.Time) time.Duration {
+	elapsed := a.active
+	if !a.activeSince.IsZero() {
+		elapsed += now.Sub(a.activeSince)
+	}
+	return elapsed
+}
+
+// estimate returns the hashrate that explains the shares submitted by the client.
+func (a *shares) estimate(now time.Time) float64 {
+	elapsed := a.elapsed(now).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return a.work / elapsed
+}
+
+// suspicious is true when the reported hashrate should have found enough shares to
+// compare, but the shares explain less than a quarter of it.
+func (a *shares) suspicious(now time.Time) bool {
+	if a.reported <= 0 {
+		return false
+	}
+	expected := a.reported * a.elapsed(now).Seconds() / expectedHashes(a.difficulty)
+	return expected >= minExpectedShares && a.estimate(now) < a.reported/4
+}
+
+// expectedHashes returns the average number of hashes to find a hash with the
+// difficulty leading zeros in hex.
+func expectedHashes(difficulty int) float64 {
+	return math.Pow(16, float64(difficulty))
+}
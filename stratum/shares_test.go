@@ -0,0 +1,148 @@
+package stratum
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/solver"
+)
+
+func TestShares_Estimate(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		shares         int
+		difficulty     int
+		reported       float64
+		elapsed        time.Duration
+		wantEstimate   float64
+		wantSuspicious bool
+	}{
+		{name: "no shares", difficulty: 1, elapsed: time.Second * 10},
+		{name: "honest", shares: 10, difficulty: 1, reported: 16, elapsed: time.Second * 10, wantEstimate: 16},
+		{name: "higher difficulty", shares: 2, difficulty: 2, reported: 40, elapsed: time.Second * 16, wantEstimate: 32},
+		{name: "claims hashrate without shares", difficulty: 1, reported: 1000, elapsed: time.Second * 10, wantSuspicious: true},
+		{name: "too soon to tell", difficulty: 3, reported: 1000, elapsed: time.Second},
+		{name: "claims ten times its shares", shares: 10, difficulty: 1, reported: 160, elapsed: time.Second * 10, wantEstimate: 16, wantSuspicious: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a shares
+			a.start(start, tt.difficulty)
+			a.reported = tt.reported
+			for i := 0; i < tt.shares; i++ {
+				a.add(tt.difficulty)
+			}
+			now := start.Add(tt.elapsed)
+			if got := a.estimate(now); got != tt.wantEstimate {
+				t.Errorf("estimate() = %v, want %v", got, tt.wantEstimate)
+			}
+			if got := a.suspicious(now); got != tt.wantSuspicious {
+				t.Errorf("suspicious() = %v, want %v", got, tt.wantSuspicious)
+			}
+		})
+	}
+}
+
+func TestShares_OnlyCountTimeWithJob(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var a shares
+	a.start(start, 1)
+	a.stop(start.Add(time.Second * 5))
+	a.start(start.Add(time.Minute), 1)
+	if got := a.elapsed(start.Add(time.Minute + time.Second*5)); got != time.Second*10 {
+		t.Errorf("elapsed() = %v, want 10s", got)
+	}
+}
+
+// clock is a fake time safe to use from the server gorutines.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// shareSuffixes returns n suffixes that meet the share difficulty but not the difficulty.
+func shareSuffixes(shareDifficulty, difficulty, n int) []string {
+	var suffixes []string
+	buf := make([]byte, solver.NonceSuffixLength)
+	for nonce := uint64(0); len(suffixes) < n; nonce++ {
+		solver.NonceSuffix(nonce, buf)
+		suffix := string(buf)
+		if solver.CalculateAndCheckHash(authdata, suffix, shareDifficulty) != "" && solver.CalculateAndCheckHash(authdata, suffix, difficulty) == "" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	return suffixes
+}
+
+func TestServer_CountsShares(t *testing.T) {
+	fake := &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := listen(t, WithShareDifficulty(1))
+	s.now = fake.Now
+
+	c := dial(t, s)
+	c.call(MethodSubscribe)
+	c.call(MethodAuthorize, "rig", "x")
+	if msg := c.call(MethodHashrate, "rig", 1e6); msg.Error != nil {
+		t.Fatalf("hashrate error = %v", msg.Error)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+	done := solve(s, ctx, 3)
+
+	jobID, difficulty, shareDifficulty := c.notified()
+	if difficulty != 3 || shareDifficulty != 1 {
+		t.Fatalf("notified difficulty = %d and share difficulty = %d, want 3 and 1", difficulty, shareDifficulty)
+	}
+	for _, suffix := range shareSuffixes(1, 3, 5) {
+		if msg := c.call(MethodSubmit, "rig", jobID, suffix); msg.Error != nil {
+			t.Fatalf("submit share error = %v", msg.Error)
+		}
+	}
+	select {
+	case res := <-done:
+		t.Fatalf("Solve() returned %q, %v with shares below the difficulty", res.suffix, res.err)
+	default:
+	}
+
+	fake.Advance(time.Second * 10)
+	clients := s.Clients()
+	if len(clients) != 1 {
+		t.Fatalf("Clients() = %+v", clients)
+	}
+	got := clients[0]
+	if got.Shares != 5 || got.EstimatedHashrate != 8 || got.ReportedHashrate != 1e6 || !got.Suspicious {
+		t.Errorf("Clients() = %+v, want 5 shares, estimated hashrate 8 and suspicious", got)
+	}
+	if s.Hashrate() != 8 {
+		t.Errorf("Hashrate() = %v, want 8", s.Hashrate())
+	}
+
+	suffix := validSuffix(t, 3)
+	if msg := c.call(MethodSubmit, "rig", jobID, suffix); msg.Error != nil {
+		t.Fatalf("submit solution error = %v", msg.Error)
+	}
+	if res := <-done; res.err != nil || res.suffix != suffix {
+		t.Errorf("Solve() = %q, %v; want %q", res.suffix, res.err, suffix)
+	}
+	if shares := s.Clients()[0].Shares; shares != 6 {
+		t.Errorf("shares = %d, want the solution counted as a share", shares)
+	}
+}
@@ -209,7 +209,7 @@ func testCorutine(authdata string, workers, difficulty, minStringlength, maxStri
 	stop := make(chan bool, 1)
 	// go utils.HashRate(hashrateCounter, stop)
 
-	jobs := miner.GenerateWorkerJobs(wp.GetWorkerCount(), difficulty, minStringlength, maxStringLength, authdata, hashrateCounter)
+	jobs := miner.GenerateWorkerJobs(wp.GetWorkerCount(), difficulty, minStringlength, maxStringLength, authdata, hashrateCounter, nil)
 	go wp.SendBulkJobs(jobs)
 
 	if suff, err := miner.GetResults(wp); err == nil && suff != "" {
@@ -65,12 +65,24 @@ var prefixDifficultyBytesMap = map[int][]byte{
 	9: {255, 255, 255, 255, 240, 0, 0, 0},
 }
 
+// hexPrefix returns the zeros the hex of a hash starts with when it meets the difficulty,
+// also for the difficulties above the table.
+func hexPrefix(dificulty int) string {
+	if prefix, ok := prefixDifficultyMap[dificulty]; ok {
+		return prefix
+	}
+	if dificulty < 0 {
+		return ""
+	}
+	return strings.Repeat("0", dificulty)
+}
+
 // Check if hex starts with dificulty number of 0s.
 func CheckDificultyOriginal(hash [20]byte, dificulty int) bool {
 	// Improve method to use bit manipulation for more optimal comparion.
 	// E.g: Convert to uint64 and compare it's content with expected value from dificulty.
 	sha1_hash := hex.EncodeToString(hash[:])
-	res := strings.HasPrefix(sha1_hash, prefixDifficultyMap[dificulty])
+	res := strings.HasPrefix(sha1_hash, hexPrefix(dificulty))
 	return res
 }
 
@@ -78,12 +90,15 @@ func CheckDificulty1(hash []byte, dificulty int) bool {
 	// Improve method to use bit manipulation for more optimal comparion.
 	// E.g: Convert to uint64 and compare it's content with expected value from dificulty.
 	sha1_hash := hex.EncodeToString(hash)
-	res := strings.HasPrefix(sha1_hash, prefixDifficultyMap[dificulty])
+	res := strings.HasPrefix(sha1_hash, hexPrefix(dificulty))
 	return res
 }
 
 func CheckDificulty(hash []byte, dificulty int) bool {
 	// return bytes.Equal(prefixDifficultyBytesMap[dificulty], hash[:len(prefixDifficultyBytesMap[dificulty])])
+	if _, ok := prefixDifficultyBytesMap[dificulty]; !ok {
+		return CheckDificulty1(hash, dificulty)
+	}
 
 	for i := 0; i < len(prefixDifficultyBytesMap[dificulty]); i++ {
 		res := hash[i] & prefixDifficultyBytesMap[dificulty][i]
@@ -103,7 +118,7 @@ func HashRate(counter *ratecounter.RateCounter, stop chan bool) {
 	for {
 		select {
 		case <-stop:
-			fmt.Println("Closing HashRate gorutine")
+			logger.Debug("closing HashRate goroutine")
 			return
 		case <-t.C:
 			fmt.Print("\033[u\033[K")
@@ -104,6 +104,30 @@ func TestHexStartsWith3(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "Testing invalid dificulty 10 hash",
+			args: args{
+				hash:      []byte{0, 0, 0, 0, 7, 86, 14, 127, 67, 132, 46, 46, 33, 183, 116, 230, 29, 133, 240, 71},
+				dificulty: 10,
+			},
+			want: false,
+		},
+		{
+			name: "Testing valid dificulty 12 hash",
+			args: args{
+				hash:      []byte{0, 0, 0, 0, 0, 0, 14, 127, 67, 132, 46, 46, 33, 183, 116, 230, 29, 133, 240, 71},
+				dificulty: 12,
+			},
+			want: true,
+		},
+		{
+			name: "Testing invalid dificulty 41 hash",
+			args: args{
+				hash:      make([]byte, 20),
+				dificulty: 41,
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
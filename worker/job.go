@@ -1,15 +1,32 @@
 package worker
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// ErrNoResult is returned in RaceFirst mode when all the jobs finished without a value.
+var ErrNoResult = errors.New("no job returned a result")
+
+// DeadlineExceeded is the error of the jobs skipped because their deadline passed
+// before a worker could start them.
+var DeadlineExceeded = errors.New("job deadline exceeded before it started")
 
 // ExecutionFn is interface for what job will be executed.
 type ExecutionFn func(ctx context.Context, args interface{}) (interface{}, error)
 
 // Job is the definition of how work wil be passed and what funtion to execute.
+// Jobs with higher Priority are started first and a job with a Deadline is
+// skipped if it is not started before it.
 type Job struct {
-	ID     string
-	ExecFn ExecutionFn
-	Args   interface{}
+	ID       string
+	ExecFn   ExecutionFn
+	Args     interface{}
+	Priority int
+	Deadline time.Time
 }
 
 // Result is the result of the job execution.
@@ -19,8 +36,46 @@ type Result struct {
 	JobID string
 }
 
+// PanicError is the error returned when the execution function of a job panics.
+type PanicError struct {
+	JobID string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job %s panicked: %v", e.JobID, e.Value)
+}
+
+// isPanic reports if the error was produced by a recovered panic.
+func isPanic(err error) bool {
+	var panicErr *PanicError
+	return errors.As(err, &panicErr)
+}
+
+// expired reports if the deadline of the job has passed.
+func (j Job) expired(now time.Time) bool {
+	return !j.Deadline.IsZero() && !now.Before(j.Deadline)
+}
+
 // execute will execute the function and return the result.
-func (j Job) execute(ctx context.Context) Result {
+// A panic in the function is recovered and returned as a PanicError.
+func (j Job) execute(ctx context.Context) (res Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = Result{
+				Err:   &PanicError{JobID: j.ID, Value: r, Stack: debug.Stack()},
+				JobID: j.ID,
+			}
+		}
+	}()
+
+	if !j.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, j.Deadline)
+		defer cancel()
+	}
+
 	value, err := j.ExecFn(ctx, j.Args)
 	if err != nil {
 		return Result{
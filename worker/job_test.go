@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -74,3 +76,45 @@ func TestJob_execute(t *testing.T) {
 		})
 	}
 }
+
+func panicking(ctx context.Context, args interface{}) (interface{}, error) {
+	panic("boom")
+}
+
+func TestJob_executePanic(t *testing.T) {
+	j := Job{
+		ID:     jobID,
+		ExecFn: panicking,
+	}
+
+	got := j.execute(context.TODO())
+	if got.JobID != jobID {
+		t.Errorf("Job.execute() JobID = %v, want %v", got.JobID, jobID)
+	}
+
+	panicErr, ok := got.Err.(*PanicError)
+	if !ok {
+		t.Fatalf("Job.execute() error = %v, want *PanicError", got.Err)
+	}
+	if panicErr.JobID != jobID || panicErr.Value != "boom" {
+		t.Errorf("Job.execute() PanicError = %+v", panicErr)
+	}
+	if !strings.Contains(string(panicErr.Stack), "panicking") {
+		t.Errorf("Job.execute() stack does not contain the panicking function:\n%s", panicErr.Stack)
+	}
+}
+
+func TestJob_executeDeadline(t *testing.T) {
+	j := Job{
+		ID: jobID,
+		ExecFn: func(ctx context.Context, args interface{}) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		Deadline: time.Now().Add(time.Millisecond * 10),
+	}
+
+	if got := j.execute(context.TODO()); got.Err != context.DeadlineExceeded {
+		t.Fatalf("expected error: %v; got: %v", context.DeadlineExceeded, got.Err)
+	}
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// queuedJob is a job waiting in the queue. seq keeps the FIFO order between jobs
+// with the same priority.
+type queuedJob struct {
+	job Job
+	seq uint64
+}
+
+// jobHeap orders the jobs by priority and then by arrival.
+type jobHeap []queuedJob
+
+func (h jobHeap) Len() int { return len(h) }
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].job.Priority != h[j].job.Priority {
+		return h[i].job.Priority > h[j].job.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h jobHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x interface{}) { *h = append(*h, x.(queuedJob)) }
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// queue holds the jobs waiting for a worker and keeps track of the ones being executed,
+// so a job handed back by a retired worker is never lost.
+type queue struct {
+	mu       sync.Mutex
+	items    jobHeap
+	seq      uint64
+	inflight int
+	closed   bool
+	wake     chan struct{}
+	drained  chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{
+		wake:    make(chan struct{}),
+		drained: make(chan struct{}),
+	}
+}
+
+// broadcast wakes up all the workers waiting for a job. Must be called with the lock held.
+func (q *queue) broadcast() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+
+	if q.closed && len(q.items) == 0 && q.inflight == 0 {
+		select {
+		case <-q.drained:
+		default:
+			close(q.drained)
+		}
+	}
+}
+
+// push adds a job after the queued jobs with the same or higher priority.
+func (q *queue) push(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	heap.Push(&q.items, queuedJob{job: job, seq: q.seq})
+	q.broadcast()
+}
+
+// close marks that no more jobs will be pushed.
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.broadcast()
+}
+
+// pop waits for the job with the highest priority. It returns false when the context is done or
+// when the queue is closed and there are no jobs left to execute.
+func (q *queue) pop(ctx context.Context) (Job, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := heap.Pop(&q.items).(queuedJob)
+			q.inflight++
+			q.mu.Unlock()
+			return item.job, true
+		}
+		if q.closed && q.inflight == 0 {
+			q.mu.Unlock()
+			return Job{}, false
+		}
+		wake := q.wake
+		q.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return Job{}, false
+		}
+	}
+}
+
+// counts returns the number of jobs waiting and being executed.
+func (q *queue) counts() (queued, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items), q.inflight
+}
+
+// done marks a job returned by pop as finished.
+func (q *queue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.inflight--
+	q.broadcast()
+}
+
+// handback puts a job returned by pop before the other jobs with the same priority
+// so another worker resumes it.
+func (q *queue) handback(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	heap.Push(&q.items, queuedJob{job: job})
+	q.inflight--
+	q.broadcast()
+}
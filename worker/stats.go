@@ -0,0 +1,204 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are the upper bounds of the job duration histogram.
+// Durations above the last bound are counted in an extra bucket.
+var DurationBuckets = []time.Duration{
+	time.Millisecond,
+	time.Millisecond * 10,
+	time.Millisecond * 100,
+	time.Second,
+	time.Second * 10,
+	time.Minute,
+	time.Minute * 10,
+	time.Hour,
+}
+
+// Hooks is notified when a worker starts and ends a job. The methods are called from
+// the worker gorutine, so they should return quickly.
+type Hooks interface {
+	OnJobStart(workerID int, job Job)
+	OnJobEnd(workerID int, job Job, res Result, duration time.Duration)
+}
+
+// WithHooks sets the hooks notified about the execution of the jobs.
+func WithHooks(hooks Hooks) Option {
+	return func(wp *Pool) {
+		wp.hooks = hooks
+	}
+}
+
+// Stats is a snapshot of the state of the worker pool.
+type Stats struct {
+	Workers    int
+	Paused     bool
+	Queued     int
+	Running    int
+	Completed  uint64
+	Failed     uint64
+	Skipped    uint64
+	HandedBack uint64
+	WorkerBusy []WorkerStats
+	Durations  Histogram
+}
+
+// WorkerStats is the activity of one worker since the pool started.
+type WorkerStats struct {
+	ID      int
+	Jobs    uint64
+	Busy    time.Duration
+	Running bool
+	Retired bool
+}
+
+// Histogram counts the job durations. Counts has one more element than Bounds
+// for the durations above the last bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// Busy returns the time all the workers spent executing jobs.
+func (s Stats) Busy() time.Duration {
+	var busy time.Duration
+	for _, w := range s.WorkerBusy {
+		busy += w.Busy
+	}
+	return busy
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("workers=%d queued=%d running=%d completed=%d failed=%d skipped=%d handedBack=%d busy=%s",
+		s.Workers, s.Queued, s.Running, s.Completed, s.Failed, s.Skipped, s.HandedBack, s.Busy().Round(time.Millisecond))
+}
+
+// collector keeps the counters used to build the stats of the pool.
+type collector struct {
+	mu         sync.Mutex
+	completed  uint64
+	failed     uint64
+	skipped    uint64
+	handedBack uint64
+	workers    map[int]*workerActivity
+	buckets    []uint64
+	count      uint64
+	sum        time.Duration
+}
+
+// workerActivity is the activity of one worker.
+type workerActivity struct {
+	jobs    uint64
+	busy    time.Duration
+	started time.Time
+	retired bool
+}
+
+func newCollector() *collector {
+	return &collector{
+		workers: make(map[int]*workerActivity),
+		buckets: make([]uint64, len(DurationBuckets)+1),
+	}
+}
+
+// add registers a new worker.
+func (c *collector) add(workerID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.workers[workerID] = &workerActivity{}
+}
+
+// retire marks the worker as retired.
+func (c *collector) retire(workerID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.workers[workerID].retired = true
+}
+
+// start records that the worker started a job.
+func (c *collector) start(workerID int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.workers[workerID].started = now
+}
+
+// skip records that a job was not started because its deadline passed.
+func (c *collector) skip() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.skipped++
+}
+
+// end records that the worker ended a job and how.
+func (c *collector) end(workerID int, duration time.Duration, res Result, handedBack bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := c.workers[workerID]
+	w.started = time.Time{}
+	w.busy += duration
+	w.jobs++
+
+	switch {
+	case handedBack:
+		c.handedBack++
+		return
+	case res.Err != nil:
+		c.failed++
+	default:
+		c.completed++
+	}
+
+	bucket := sort.Search(len(DurationBuckets), func(i int) bool {
+		return duration <= DurationBuckets[i]
+	})
+	c.buckets[bucket]++
+	c.count++
+	c.sum += duration
+}
+
+// snapshot fills the stats with the counters collected until now.
+func (c *collector) snapshot(stats *Stats, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats.Completed = c.completed
+	stats.Failed = c.failed
+	stats.Skipped = c.skipped
+	stats.HandedBack = c.handedBack
+	stats.Durations = Histogram{
+		Bounds: append([]time.Duration(nil), DurationBuckets...),
+		Counts: append([]uint64(nil), c.buckets...),
+		Count:  c.count,
+		Sum:    c.sum,
+	}
+
+	stats.WorkerBusy = make([]WorkerStats, 0, len(c.workers))
+	for id, w := range c.workers {
+		ws := WorkerStats{
+			ID:      id,
+			Jobs:    w.jobs,
+			Busy:    w.busy,
+			Running: !w.started.IsZero(),
+			Retired: w.retired,
+		}
+		if ws.Running {
+			ws.Busy += now.Sub(w.started)
+		}
+		stats.WorkerBusy = append(stats.WorkerBusy, ws)
+	}
+	sort.Slice(stats.WorkerBusy, func(i, j int) bool {
+		return stats.WorkerBusy[i].ID < stats.WorkerBusy[j].ID
+	})
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingHooks struct {
+	mu      sync.Mutex
+	started map[string]int
+	ended   map[string]Result
+}
+
+func (h *recordingHooks) OnJobStart(workerID int, job Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.started[job.ID] = workerID
+}
+
+func (h *recordingHooks) OnJobEnd(workerID int, job Job, res Result, duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ended[job.ID] = res
+}
+
+func TestPool_Stats(t *testing.T) {
+	hooks := &recordingHooks{started: map[string]int{}, ended: map[string]Result{}}
+	wp := New(workerCount, WithHooks(hooks))
+
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, args interface{}) (interface{}, error) {
+		<-release
+		return args, nil
+	}
+
+	go wp.Run(context.TODO())
+	go func() {
+		for i := 0; i < 4; i++ {
+			wp.SendJob(Job{ID: strconv.Itoa(i), ExecFn: multiplyByTwo, Args: i})
+		}
+		wp.SendJob(Job{ID: "failed", ExecFn: multiplyByTwo, Args: "failed"})
+		wp.SendJob(Job{ID: "blocking", ExecFn: blocking, Args: 0})
+		close(wp.jobs)
+	}()
+
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		for range wp.Results() {
+		}
+	}()
+
+	waitFor(t, "the blocking job", func() bool {
+		stats := wp.Stats()
+		return stats.Running == 1 && stats.Completed == 4 && stats.Failed == 1
+	})
+
+	stats := wp.Stats()
+	if stats.Workers != workerCount || stats.Queued != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(stats.WorkerBusy) != workerCount {
+		t.Fatalf("expected %d workers in stats; got %d", workerCount, len(stats.WorkerBusy))
+	}
+	busyWorkers := 0
+	for _, w := range stats.WorkerBusy {
+		if w.Running {
+			busyWorkers++
+		}
+	}
+	if busyWorkers != 1 {
+		t.Fatalf("expected 1 busy worker; got %d", busyWorkers)
+	}
+
+	close(release)
+	<-consumed
+
+	stats = wp.Stats()
+	if stats.Running != 0 || stats.Completed != 5 || stats.Failed != 1 {
+		t.Fatalf("unexpected stats after run: %+v", stats)
+	}
+	if stats.Durations.Count != 6 || len(stats.Durations.Counts) != len(DurationBuckets)+1 {
+		t.Fatalf("unexpected histogram: %+v", stats.Durations)
+	}
+	var jobs uint64
+	for _, w := range stats.WorkerBusy {
+		jobs += w.Jobs
+	}
+	if jobs != 6 {
+		t.Fatalf("expected 6 jobs in worker stats; got %d", jobs)
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.started) != 6 || len(hooks.ended) != 6 {
+		t.Fatalf("expected hooks for 6 jobs; got %d starts and %d ends", len(hooks.started), len(hooks.ended))
+	}
+	if hooks.ended["failed"].Err != errDefault {
+		t.Fatalf("expected error: %v; got: %v", errDefault, hooks.ended["failed"].Err)
+	}
+}
+
+func TestPool_StatsHandedBack(t *testing.T) {
+	wp := New(1)
+
+	waitForCancel := func(ctx context.Context, args interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	go wp.Run(ctx)
+	wp.SendJob(Job{ID: "0", ExecFn: waitForCancel})
+	waitFor(t, "the job to start", func() bool { return wp.Stats().Running == 1 })
+
+	wp.Resize(0)
+	waitFor(t, "the job to be handed back", func() bool {
+		stats := wp.Stats()
+		return stats.HandedBack == 1 && stats.Queued == 1 && stats.Running == 0
+	})
+
+	stats := wp.Stats()
+	if len(stats.WorkerBusy) != 1 || !stats.WorkerBusy[0].Retired {
+		t.Fatalf("expected the worker to be retired: %+v", stats.WorkerBusy)
+	}
+	if stats.Completed != 0 || stats.Failed != 0 || stats.Durations.Count != 0 {
+		t.Fatalf("handed back jobs should not be counted as finished: %+v", stats)
+	}
+}
@@ -2,42 +2,272 @@ package worker
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"sync"
+	"time"
+
+	"github.com/MihaiLupoiu/interview-exasol/logging"
+)
+
+// Mode defines how the pool handles the results of the jobs.
+type Mode int
+
+const (
+	// Default forwards every job result to the results channel.
+	Default Mode = iota
+	// RaceFirst cancels all the workers as soon as one job returns a non-error value
+	// and only forwards that result once every worker has exited.
+	RaceFirst
 )
 
+// PanicPolicy defines what the pool does when a job panics.
+type PanicPolicy int
+
+const (
+	// PanicDrop reports the PanicError as the result of the job and continues with the next one.
+	PanicDrop PanicPolicy = iota
+	// PanicRestart executes the job again up to the maximum number of restarts before dropping it.
+	PanicRestart
+	// PanicFail reports the PanicError and cancels the whole pool.
+	PanicFail
+)
+
+// defaultMaxRestarts is the number of times a panicking job is restarted with PanicRestart.
+const defaultMaxRestarts = 3
+
+// Option configures the worker pool.
+type Option func(*Pool)
+
+// WithMode sets the mode in which the pool will run.
+func WithMode(mode Mode) Option {
+	return func(wp *Pool) {
+		wp.mode = mode
+	}
+}
+
+// WithPanicPolicy sets what the pool does when a job panics.
+func WithPanicPolicy(policy PanicPolicy) Option {
+	return func(wp *Pool) {
+		wp.panicPolicy = policy
+	}
+}
+
+// WithMaxRestarts sets how many times a panicking job is restarted with PanicRestart.
+func WithMaxRestarts(restarts int) Option {
+	return func(wp *Pool) {
+		wp.maxRestarts = restarts
+	}
+}
+
 type Pool struct {
+	mode        Mode
+	panicPolicy PanicPolicy
+	maxRestarts int
+	hooks       Hooks
+	jobs        chan Job
+	results     chan Result
+	Done        chan struct{}
+	state       *state
+}
+
+// state is the part of the pool that changes while it runs and is shared by all its copies.
+type state struct {
+	mu           sync.Mutex
 	workersCount int
-	jobs         chan Job
-	results      chan Result
-	Done         chan struct{}
+	running      bool
+	stopped      bool
+	paused       bool
+	ctx          context.Context
+	wg           sync.WaitGroup
+	nextID       int
+	workers      []*handle
+	spawn        func(h *handle)
+	queue        *queue
+	stats        *collector
+}
+
+// handle is used to retire a running worker.
+type handle struct {
+	id     int
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func New(wcount int) Pool {
-	return Pool{
-		workersCount: wcount,
-		jobs:         make(chan Job, wcount),
-		results:      make(chan Result, wcount),
-		Done:         make(chan struct{}),
+func New(wcount int, opts ...Option) Pool {
+	wp := Pool{
+		maxRestarts: defaultMaxRestarts,
+		jobs:        make(chan Job, wcount),
+		results:     make(chan Result, wcount),
+		Done:        make(chan struct{}),
+		state:       &state{workersCount: wcount, stats: newCollector()},
 	}
+	for _, opt := range opts {
+		opt(&wp)
+	}
+	return wp
 }
 
 // GetWorkerCount returns the number of workers configured.
 func (wp Pool) GetWorkerCount() int {
-	return wp.workersCount
+	wp.state.mu.Lock()
+	defer wp.state.mu.Unlock()
+
+	return wp.state.workersCount
+}
+
+// Stats returns a snapshot of the jobs and workers of the pool.
+func (wp Pool) Stats() Stats {
+	s := wp.state
+	s.mu.Lock()
+	stats := Stats{
+		Workers: s.workersCount,
+		Queued:  len(wp.jobs),
+		Paused:  s.paused,
+	}
+	q := s.queue
+	s.mu.Unlock()
+
+	if q != nil {
+		queued, running := q.counts()
+		stats.Queued += queued
+		stats.Running = running
+	}
+	s.stats.snapshot(&stats, time.Now())
+	return stats
+}
+
+// Resize changes the number of workers while the pool is running. New workers start
+// immediately and retired workers either finish their current job or hand it back to
+// the queue if it stops because of the retirement. It does not wait for retired workers
+// to exit, so it is safe to call while consuming results.
+func (wp Pool) Resize(wcount int) {
+	if wcount < 0 {
+		wcount = 0
+	}
+
+	s := wp.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workersCount = wcount
+	if s.paused {
+		return
+	}
+	s.scale(wcount)
+}
+
+// Pause retires every worker until Resume, their jobs are handed back to the queue if they
+// stop because of it. Jobs that ignore the cancellation finish before their worker exits.
+func (wp Pool) Pause() {
+	s := wp.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = true
+	s.scale(0)
+}
+
+// Resume starts again the workers retired by Pause.
+func (wp Pool) Resume() {
+	s := wp.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = false
+	s.scale(s.workersCount)
+}
+
+// Paused reports if the pool is paused.
+func (wp Pool) Paused() bool {
+	wp.state.mu.Lock()
+	defer wp.state.mu.Unlock()
+
+	return wp.state.paused
+}
+
+// scale starts or retires workers until there are wcount. Must be called with the lock held.
+func (s *state) scale(wcount int) {
+	if !s.running || s.stopped {
+		return
+	}
+	for len(s.workers) < wcount {
+		s.add()
+	}
+	for len(s.workers) > wcount {
+		last := len(s.workers) - 1
+		s.workers[last].cancel()
+		s.stats.retire(s.workers[last].id)
+		s.workers = s.workers[:last]
+	}
+}
+
+// add starts a new worker. Must be called with the lock held.
+func (s *state) add() {
+	ctx, cancel := context.WithCancel(s.ctx)
+	h := &handle{id: s.nextID, ctx: ctx, cancel: cancel}
+	s.nextID++
+	s.stats.add(h.id)
+	s.workers = append(s.workers, h)
+	s.wg.Add(1)
+	s.spawn(h)
+}
+
+// start launches the configured number of workers.
+func (s *state) start(ctx context.Context, q *queue, spawn func(h *handle)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctx = ctx
+	s.queue = q
+	s.spawn = spawn
+	s.running = true
+	if !s.paused {
+		s.scale(s.workersCount)
+	}
+}
+
+// stop prevents new workers from starting and waits for the running ones to exit.
+func (s *state) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.wg.Wait()
 }
 
 // Run will start the gorutines that will wait for jobs and
 // the function will wait as well for all the jobs to finish.
 func (wp Pool) Run(ctx context.Context) {
-	var wg sync.WaitGroup
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	q := newQueue()
+	race := &race{cancel: cancel}
+
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		wp.feed(runCtx, q)
+	}()
+
+	wp.state.start(runCtx, q, func(h *handle) {
+		go wp.worker(runCtx, h, q, cancel, race)
+	})
 
-	for i := 0; i < wp.workersCount; i++ {
-		wg.Add(1)
-		go worker(ctx, &wg, wp.jobs, wp.results)
+	select {
+	case <-runCtx.Done():
+	case <-q.drained:
+	}
+	wp.state.stop()
+	<-fed
+
+	if wp.mode == RaceFirst {
+		wp.results <- race.result(ctx)
+		close(wp.results)
+		close(wp.Done)
+		return
 	}
 
-	wg.Wait()
 	close(wp.Done)
 	close(wp.results)
 }
@@ -47,6 +277,17 @@ func (wp Pool) SendJob(job Job) {
 	wp.jobs <- job
 }
 
+// SendJobContext sends one job to be executed by the worker pool, or returns the error
+// of the context if it is done first.
+func (wp Pool) SendJobContext(ctx context.Context, job Job) error {
+	select {
+	case wp.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // SendBulkJobs sends multiple jobs to be executed by the worker pool
 func (wp Pool) SendBulkJobs(jobsBulk []Job) {
 	for _, job := range jobsBulk {
@@ -60,22 +301,161 @@ func (wp Pool) Results() <-chan Result {
 	return wp.results
 }
 
-// worker is the function that executes the job.
-func worker(ctx context.Context, wg *sync.WaitGroup, jobs <-chan Job, results chan<- Result) {
-	defer wg.Done()
+// feed moves the jobs sent to the pool into the queue until the jobs channel is closed.
+func (wp Pool) feed(ctx context.Context, q *queue) {
 	for {
 		select {
-		case job, ok := <-jobs:
+		case job, ok := <-wp.jobs:
 			if !ok {
+				q.close()
 				return
 			}
-			results <- job.execute(ctx)
+			q.push(job)
 		case <-ctx.Done():
-			fmt.Printf("cancelled worker. Error detail: %v\n", ctx.Err())
-			results <- Result{
-				Err: ctx.Err(),
+			return
+		}
+	}
+}
+
+// process executes the job applying the panic policy of the pool.
+func (wp Pool) process(ctx context.Context, job Job) Result {
+	for restarts := 0; ; restarts++ {
+		res := job.execute(ctx)
+		if !isPanic(res.Err) || wp.panicPolicy != PanicRestart || restarts >= wp.maxRestarts {
+			return res
+		}
+		logger.Warn("restarting job", "job", job.ID, logging.KeyError, res.Err)
+	}
+}
+
+// failed reports if the result must stop the whole pool.
+func (wp Pool) failed(res Result) bool {
+	return wp.panicPolicy == PanicFail && isPanic(res.Err)
+}
+
+// worker is the function that executes the job. In RaceFirst mode the results are
+// reported to the race instead of the results channel.
+func (wp Pool) worker(ctx context.Context, h *handle, q *queue, cancel context.CancelFunc, race *race) {
+	defer wp.state.wg.Done()
+	for {
+		job, ok := q.pop(h.ctx)
+		if !ok {
+			if ctx.Err() != nil && wp.mode != RaceFirst {
+				logger.Debug("cancelled worker", logging.KeyError, ctx.Err())
+				wp.results <- Result{
+					Err: ctx.Err(),
+				}
 			}
 			return
 		}
+
+		start := time.Now()
+		if job.expired(start) {
+			q.done()
+			wp.state.stats.skip()
+			if !wp.report(Result{Err: DeadlineExceeded, JobID: job.ID}, cancel, race) {
+				return
+			}
+			continue
+		}
+
+		wp.state.stats.start(h.id, start)
+		if wp.hooks != nil {
+			wp.hooks.OnJobStart(h.id, job)
+		}
+
+		res := wp.process(h.ctx, job)
+		// The worker was retired while executing the job.
+		handedBack := ctx.Err() == nil && h.ctx.Err() != nil && errors.Is(res.Err, context.Canceled)
+
+		duration := time.Since(start)
+		wp.state.stats.end(h.id, duration, res, handedBack)
+		if wp.hooks != nil {
+			wp.hooks.OnJobEnd(h.id, job, res, duration)
+		}
+
+		if handedBack {
+			q.handback(job)
+			return
+		}
+		q.done()
+
+		if !wp.report(res, cancel, race) {
+			return
+		}
+	}
+}
+
+// report sends the result to the results channel, or to the race in RaceFirst mode.
+// It returns false if the worker must stop.
+func (wp Pool) report(res Result, cancel context.CancelFunc, race *race) bool {
+	switch {
+	case wp.mode == RaceFirst && wp.failed(res):
+		race.fail(res)
+		return false
+	case wp.mode == RaceFirst:
+		race.report(res)
+	default:
+		wp.results <- res
+		if wp.failed(res) {
+			cancel()
+		}
+	}
+	return true
+}
+
+// race keeps the first successful result and the last failure of a RaceFirst run.
+type race struct {
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	winner  *Result
+	fatal   *Result
+	lastErr *Result
+}
+
+// report stores the result and cancels the siblings if it is the first success.
+func (r *race) report(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if res.Err != nil {
+		if r.winner == nil {
+			r.lastErr = &res
+		}
+		return
+	}
+
+	if r.winner == nil {
+		r.winner = &res
+		r.cancel()
+	}
+}
+
+// fail stores the result that stopped the pool and cancels the siblings.
+func (r *race) fail(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.winner == nil && r.fatal == nil {
+		r.fatal = &res
+		r.cancel()
+	}
+}
+
+// result returns the winner, or the reason why there is none.
+func (r *race) result(ctx context.Context) Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case r.winner != nil:
+		return *r.winner
+	case r.fatal != nil:
+		return *r.fatal
+	case ctx.Err() != nil:
+		return Result{Err: ctx.Err()}
+	case r.lastErr != nil:
+		return *r.lastErr
 	}
+	return Result{Err: ErrNoResult}
 }
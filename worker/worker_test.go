@@ -3,7 +3,9 @@ package worker
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -106,3 +108,384 @@ func TestWorkerPool_Cancel(t *testing.T) {
 		}
 	}
 }
+
+func TestWorkerPool_RaceFirst(t *testing.T) {
+	wp := New(4, WithMode(RaceFirst))
+
+	var exited int32
+	waitForCancel := func(ctx context.Context, args interface{}) (interface{}, error) {
+		<-ctx.Done()
+		atomic.AddInt32(&exited, 1)
+		return nil, ctx.Err()
+	}
+
+	go wp.Run(context.TODO())
+
+	jobs := []Job{
+		{ID: "0", ExecFn: waitForCancel},
+		{ID: "1", ExecFn: waitForCancel},
+		{ID: "2", ExecFn: multiplyByTwo, Args: 21},
+		{ID: "3", ExecFn: waitForCancel},
+	}
+	go wp.SendBulkJobs(jobs)
+
+	r, ok := <-wp.Results()
+	if !ok {
+		t.Fatal("results closed without a winner")
+	}
+	if r.Err != nil || r.JobID != "2" || r.Value.(int) != 42 {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	if got := atomic.LoadInt32(&exited); got != 3 {
+		t.Fatalf("expected all 3 siblings to exit before the result, got %d", got)
+	}
+
+	if _, ok := <-wp.Results(); ok {
+		t.Fatal("expected only one result in RaceFirst mode")
+	}
+	<-wp.Done
+}
+
+func TestWorkerPool_RaceFirstNoWinner(t *testing.T) {
+	wp := New(workerCount, WithMode(RaceFirst))
+
+	go wp.Run(context.TODO())
+	go wp.SendBulkJobs([]Job{
+		{ID: "0", ExecFn: multiplyByTwo, Args: "0"},
+		{ID: "1", ExecFn: multiplyByTwo, Args: "1"},
+	})
+
+	r := <-wp.Results()
+	if r.Err != errDefault {
+		t.Fatalf("expected error: %v; got: %v", errDefault, r.Err)
+	}
+	<-wp.Done
+}
+
+func TestWorkerPool_RaceFirstDeadline(t *testing.T) {
+	wp := New(workerCount, WithMode(RaceFirst))
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*10)
+	defer cancel()
+
+	go wp.Run(ctx)
+
+	r := <-wp.Results()
+	if r.Err != context.DeadlineExceeded {
+		t.Fatalf("expected error: %v; got: %v", context.DeadlineExceeded, r.Err)
+	}
+	<-wp.Done
+}
+
+func TestWorkerPool_PanicDrop(t *testing.T) {
+	wp := New(workerCount)
+
+	go wp.Run(context.TODO())
+	go wp.SendBulkJobs([]Job{
+		{ID: "0", ExecFn: panicking},
+		{ID: "1", ExecFn: multiplyByTwo, Args: 1},
+	})
+
+	var panics, values int
+	for r := range wp.Results() {
+		switch {
+		case isPanic(r.Err):
+			panics++
+		case r.Err == nil && r.Value.(int) == 2:
+			values++
+		default:
+			t.Fatalf("unexpected result: %+v", r)
+		}
+	}
+	if panics != 1 || values != 1 {
+		t.Fatalf("expected 1 panic and 1 value; got %d panics and %d values", panics, values)
+	}
+}
+
+func TestWorkerPool_PanicRestart(t *testing.T) {
+	wp := New(workerCount, WithPanicPolicy(PanicRestart), WithMaxRestarts(2))
+
+	var calls int32
+	panicTwice := func(ctx context.Context, args interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			panic("boom")
+		}
+		return "ok", nil
+	}
+
+	var panicCalls int32
+	alwaysPanic := func(ctx context.Context, args interface{}) (interface{}, error) {
+		atomic.AddInt32(&panicCalls, 1)
+		panic("boom")
+	}
+
+	go wp.Run(context.TODO())
+	go wp.SendBulkJobs([]Job{
+		{ID: "recovers", ExecFn: panicTwice},
+		{ID: "dropped", ExecFn: alwaysPanic},
+	})
+
+	for r := range wp.Results() {
+		switch r.JobID {
+		case "recovers":
+			if r.Err != nil || r.Value != "ok" {
+				t.Fatalf("expected the job to succeed after restarts; got: %+v", r)
+			}
+		case "dropped":
+			if !isPanic(r.Err) {
+				t.Fatalf("expected a PanicError; got: %+v", r)
+			}
+		default:
+			t.Fatalf("unexpected result: %+v", r)
+		}
+	}
+	if got := atomic.LoadInt32(&panicCalls); got != 3 {
+		t.Fatalf("expected 1 execution and 2 restarts; got %d executions", got)
+	}
+}
+
+func TestWorkerPool_PanicFail(t *testing.T) {
+	wp := New(workerCount, WithPanicPolicy(PanicFail))
+
+	waitForCancel := func(ctx context.Context, args interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	go wp.Run(context.TODO())
+	go wp.SendBulkJobs([]Job{
+		{ID: "0", ExecFn: waitForCancel},
+		{ID: "1", ExecFn: panicking},
+	})
+
+	var panics int
+	for r := range wp.Results() {
+		if isPanic(r.Err) {
+			panics++
+		} else if r.Err != context.Canceled {
+			t.Fatalf("expected error: %v; got: %v", context.Canceled, r.Err)
+		}
+	}
+	if panics != 1 {
+		t.Fatalf("expected 1 panic; got %d", panics)
+	}
+}
+
+func TestWorkerPool_RaceFirstPanicFail(t *testing.T) {
+	wp := New(workerCount, WithMode(RaceFirst), WithPanicPolicy(PanicFail))
+
+	waitForCancel := func(ctx context.Context, args interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	go wp.Run(context.TODO())
+	go wp.SendBulkJobs([]Job{
+		{ID: "0", ExecFn: waitForCancel},
+		{ID: "1", ExecFn: panicking},
+	})
+
+	r := <-wp.Results()
+	if !isPanic(r.Err) || r.JobID != "1" {
+		t.Fatalf("expected a PanicError from job 1; got: %+v", r)
+	}
+	<-wp.Done
+}
+
+// waitFor polls the condition until it is true or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerPool_Resize(t *testing.T) {
+	wp := New(1)
+
+	var running, executions int32
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, args interface{}) (interface{}, error) {
+		atomic.AddInt32(&executions, 1)
+		atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		select {
+		case <-release:
+			return args, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	runningIs := func(n int32) func() bool {
+		return func() bool { return atomic.LoadInt32(&running) == n }
+	}
+
+	go wp.Run(context.TODO())
+	go wp.SendBulkJobs([]Job{
+		{ID: "0", ExecFn: blocking, Args: 0},
+		{ID: "1", ExecFn: blocking, Args: 1},
+		{ID: "2", ExecFn: blocking, Args: 2},
+	})
+	waitFor(t, "1 running job", runningIs(1))
+
+	wp.Resize(3)
+	if got := wp.GetWorkerCount(); got != 3 {
+		t.Fatalf("wrong worker count %v; expected %v", got, 3)
+	}
+	waitFor(t, "3 running jobs", runningIs(3))
+
+	// Retired workers hand back their jobs instead of reporting the cancellation.
+	wp.Resize(1)
+	waitFor(t, "1 running job after scaling down", runningIs(1))
+	select {
+	case r := <-wp.Results():
+		t.Fatalf("unexpected result after scaling down: %+v", r)
+	default:
+	}
+
+	wp.Resize(3)
+	waitFor(t, "3 running jobs after scaling up", runningIs(3))
+	close(release)
+
+	seen := map[string]bool{}
+	for r := range wp.Results() {
+		if r.Err != nil {
+			t.Fatalf("unexpected error: %v", r.Err)
+		}
+		if seen[r.JobID] {
+			t.Fatalf("job %s reported twice", r.JobID)
+		}
+		seen[r.JobID] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected 3 results; got %d", len(seen))
+	}
+	if got := atomic.LoadInt32(&executions); got != 5 {
+		t.Fatalf("expected 2 handed back jobs to be executed again; got %d executions", got)
+	}
+}
+
+func TestWorkerPool_Pause(t *testing.T) {
+	wp := New(2, WithMode(RaceFirst))
+
+	var running, executions int32
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, args interface{}) (interface{}, error) {
+		atomic.AddInt32(&executions, 1)
+		atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		select {
+		case <-release:
+			return args, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	runningIs := func(n int32) func() bool {
+		return func() bool { return atomic.LoadInt32(&running) == n }
+	}
+
+	go wp.Run(context.TODO())
+	go wp.SendBulkJobs([]Job{
+		{ID: "0", ExecFn: blocking, Args: 0},
+		{ID: "1", ExecFn: blocking, Args: 1},
+	})
+	waitFor(t, "2 running jobs", runningIs(2))
+
+	wp.Pause()
+	waitFor(t, "no running jobs while paused", runningIs(0))
+	if stats := wp.Stats(); !wp.Paused() || !stats.Paused || stats.Queued != 2 {
+		t.Fatalf("paused pool stats = %+v, want paused with the 2 jobs queued", stats)
+	}
+
+	// A resize while paused is applied on Resume.
+	wp.Resize(1)
+	time.Sleep(time.Millisecond * 10)
+	if got := atomic.LoadInt32(&running); got != 0 {
+		t.Fatalf("%d jobs running after a resize while paused, want 0", got)
+	}
+
+	wp.Resume()
+	waitFor(t, "1 running job after resuming", runningIs(1))
+	close(release)
+
+	r := <-wp.Results()
+	if r.Err != nil {
+		t.Fatalf("unexpected error: %v", r.Err)
+	}
+	if got := atomic.LoadInt32(&executions); got < 3 {
+		t.Fatalf("expected the jobs handed back on pause to run again; got %d executions", got)
+	}
+}
+
+func TestWorkerPool_ResizeWhileConsuming(t *testing.T) {
+	wp := New(workerCount)
+
+	go wp.Run(context.TODO())
+
+	const totalJobs = 200
+	go func() {
+		for i := 0; i < totalJobs; i++ {
+			wp.SendJob(Job{
+				ID:     strconv.Itoa(i),
+				ExecFn: multiplyByTwo,
+				Args:   i,
+			})
+			wp.Resize(i%4 + 1)
+		}
+		close(wp.jobs)
+	}()
+
+	received := 0
+	for r := range wp.Results() {
+		if r.Err != nil {
+			t.Fatalf("unexpected error: %v", r.Err)
+		}
+		received++
+	}
+	if received != totalJobs {
+		t.Fatalf("expected %d results; got %d", totalJobs, received)
+	}
+}
+
+func TestWorkerPool_PriorityAndDeadline(t *testing.T) {
+	wp := New(1)
+
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, args interface{}) (interface{}, error) {
+		<-release
+		return args, nil
+	}
+
+	go wp.Run(context.TODO())
+	wp.SendJob(Job{ID: "blocking", ExecFn: blocking, Args: 0})
+	waitFor(t, "the blocking job to start", func() bool { return wp.Stats().Running == 1 })
+
+	wp.SendJob(Job{ID: "search", ExecFn: multiplyByTwo, Args: 1})
+	wp.SendJob(Job{ID: "expired", ExecFn: multiplyByTwo, Args: 2, Priority: 5, Deadline: time.Now().Add(-time.Second)})
+	wp.SendJob(Job{ID: "verify", ExecFn: multiplyByTwo, Args: 3, Priority: 10, Deadline: time.Now().Add(time.Hour)})
+	wp.SendJob(Job{ID: "search2", ExecFn: multiplyByTwo, Args: 4})
+	close(wp.jobs)
+	waitFor(t, "the jobs to be queued", func() bool { return wp.Stats().Queued == 4 })
+	close(release)
+
+	var order []string
+	for r := range wp.Results() {
+		order = append(order, r.JobID)
+		if r.JobID == "expired" && r.Err != DeadlineExceeded {
+			t.Fatalf("expected error: %v; got: %v", DeadlineExceeded, r.Err)
+		}
+	}
+
+	want := []string{"blocking", "verify", "expired", "search", "search2"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("wrong execution order %v; expected %v", order, want)
+	}
+	if stats := wp.Stats(); stats.Skipped != 1 || stats.Completed != 4 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}